@@ -8,6 +8,7 @@ package backoff
 import (
 	"math/rand"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -60,7 +61,11 @@ func LinearJitterBackoff(i int) time.Duration {
 	return jitter(i)
 }
 
-var random *rand.Rand
+var (
+	// random is not safe for concurrent use, so it is guarded by randomMu
+	random   *rand.Rand
+	randomMu sync.Mutex
+)
 
 func init() {
 	random = rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -70,7 +75,9 @@ func init() {
 func jitter(i int) time.Duration {
 	ms := i * 1000
 	maxJitter := ms/3 + 1
+	randomMu.Lock()
 	ms += random.Intn(2*maxJitter) - maxJitter
+	randomMu.Unlock()
 	if ms <= 0 {
 		ms = 1
 	}
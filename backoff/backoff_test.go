@@ -3,6 +3,7 @@
 package backoff
 
 import (
+	"sync"
 	"testing"
 	"time"
 )
@@ -32,3 +33,19 @@ func TestDefaultBackoff(t *testing.T) {
 		}
 	}
 }
+
+func TestLinearJitterBackoff_concurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 1; j < 100; j++ {
+				if v := LinearJitterBackoff(3); v < 1900*time.Millisecond || v > 4100*time.Millisecond {
+					t.Errorf("unexpected backoff: %v", v)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,291 @@
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+Package circuitbreaker 实现后端的熔断器, 可以在Backend的ExtraConfig中配置.
+
+	"extra_config": {
+		"github_com/luraproject/lura/circuitbreaker": {
+			"max_errors": 5,
+			"error_rate": 0.5,
+			"min_requests": 20,
+			"interval": "60s",
+			"timeout": "10s",
+			"half_open_requests": 1,
+			"log_status_change": true
+		}
+	}
+
+连续失败次数达到max_errors, 或者interval内的请求数达到min_requests且错误率达到error_rate时熔断器打开;
+打开timeout之后进入半开状态, 放行half_open_requests个探测请求, 全部成功后关闭, 任一失败则再次打开.
+*/
+package circuitbreaker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+)
+
+// Namespace 熔断器在ExtraConfig中的配置键.
+const Namespace = "github_com/luraproject/lura/circuitbreaker"
+
+// 默认配置.
+const (
+	DefaultInterval    = time.Minute
+	DefaultTimeout     = 10 * time.Second
+	DefaultMinRequests = 20
+)
+
+// ErrNoConfigFound 没有配置熔断器.
+var ErrNoConfigFound = errors.New("circuitbreaker: no configuration found")
+
+// ErrOpen 熔断器打开, 或半开状态下探测请求已满.
+var ErrOpen = errors.New("circuitbreaker: the circuit is open")
+
+// State 熔断器的状态.
+type State int
+
+const (
+	// StateClosed 关闭: 放行所有请求
+	StateClosed State = iota
+	// StateOpen 打开: 拒绝所有请求
+	StateOpen
+	// StateHalfOpen 半开: 放行有限的探测请求
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("unknown state %d", int(s))
+	}
+}
+
+// Result 请求的结果.
+type Result int
+
+const (
+	// Success 请求成功
+	Success Result = iota
+	// Failure 请求失败
+	Failure
+	// Ignored 请求不计入统计, 如调用方取消的请求
+	Ignored
+)
+
+// Config 熔断器配置.
+type Config struct {
+	// MaxErrors 打开熔断器的连续失败次数, 为0时不检查
+	MaxErrors int `json:"max_errors"`
+	// ErrorRate 打开熔断器的错误率, 取值(0, 1], 为0时不检查
+	ErrorRate float64 `json:"error_rate"`
+	// MinRequests 计算错误率所需的最少请求数
+	MinRequests int `json:"min_requests"`
+	// Interval 关闭状态下统计请求数和错误数的周期
+	Interval time.Duration `json:"-"`
+	// Timeout 熔断器打开后进入半开状态的等待时间
+	Timeout time.Duration `json:"-"`
+	// HalfOpenRequests 半开状态下放行的探测请求数
+	HalfOpenRequests int `json:"half_open_requests"`
+	// LogStatusChange 是否记录状态变化的日志
+	LogStatusChange bool `json:"log_status_change"`
+}
+
+// GetConfig 从ExtraConfig中解析熔断器配置, 没有配置时返回ErrNoConfigFound.
+func GetConfig(e config.ExtraConfig) (*Config, error) {
+	v, ok := e[Namespace]
+	if !ok {
+		return nil, ErrNoConfigFound
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	aux := struct {
+		*Config
+		Interval string `json:"interval"`
+		Timeout  string `json:"timeout"`
+	}{Config: cfg}
+	if err = json.Unmarshal(b, &aux); err != nil {
+		return nil, err
+	}
+
+	if cfg.Interval, err = parseDuration(aux.Interval, DefaultInterval); err != nil {
+		return nil, fmt.Errorf("circuitbreaker: invalid interval: %s", err.Error())
+	}
+	if cfg.Timeout, err = parseDuration(aux.Timeout, DefaultTimeout); err != nil {
+		return nil, fmt.Errorf("circuitbreaker: invalid timeout: %s", err.Error())
+	}
+	if cfg.MaxErrors < 0 || cfg.ErrorRate < 0 || cfg.ErrorRate > 1 {
+		return nil, fmt.Errorf("circuitbreaker: invalid thresholds")
+	}
+	if cfg.MaxErrors == 0 && cfg.ErrorRate == 0 {
+		return nil, fmt.Errorf("circuitbreaker: either max_errors or error_rate is required")
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = DefaultMinRequests
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	return cfg, nil
+}
+
+func parseDuration(s string, d time.Duration) (time.Duration, error) {
+	if s == "" {
+		return d, nil
+	}
+	v, err := time.ParseDuration(s)
+	if err == nil && v <= 0 {
+		err = fmt.Errorf("'%s' must be positive", s)
+	}
+	return v, err
+}
+
+// CircuitBreaker 熔断器, 并发安全.
+type CircuitBreaker struct {
+	cfg      Config
+	onChange func(from, to State)
+	now      func() time.Time
+
+	mu          sync.Mutex
+	state       State
+	generation  uint64    // 状态变化的次数, 用于忽略状态变化之前放行的请求
+	expiry      time.Time // 关闭状态下统计周期的结束时间, 打开状态下进入半开的时间
+	requests    int
+	failures    int
+	consecutive int
+	probes      int
+	successes   int
+}
+
+// New 创建熔断器. onChange在状态变化时被调用, 可以为nil.
+func New(cfg Config, onChange func(from, to State)) *CircuitBreaker {
+	cb := &CircuitBreaker{cfg: cfg, onChange: onChange, now: time.Now}
+	cb.expiry = cb.now().Add(cfg.Interval)
+	return cb
+}
+
+// State 返回熔断器当前的状态.
+func (cb *CircuitBreaker) State() State {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.refresh(cb.now())
+	return cb.state
+}
+
+// Allow 判断是否放行请求. 放行时返回的函数必须在请求结束后调用, 以记录请求的结果;
+// 拒绝时返回ErrOpen.
+func (cb *CircuitBreaker) Allow() (func(Result), error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	now := cb.now()
+	cb.refresh(now)
+
+	switch cb.state {
+	case StateOpen:
+		return nil, ErrOpen
+	case StateHalfOpen:
+		if cb.probes >= cb.cfg.HalfOpenRequests {
+			return nil, ErrOpen
+		}
+		cb.probes++
+	}
+	generation := cb.generation
+	return func(result Result) {
+		cb.mu.Lock()
+		defer cb.mu.Unlock()
+		now := cb.now()
+		cb.refresh(now)
+		// 忽略状态变化之前放行的请求
+		if cb.generation != generation {
+			return
+		}
+		if result == Ignored {
+			if cb.state == StateHalfOpen {
+				cb.probes--
+			}
+			return
+		}
+		cb.record(now, result == Success)
+	}, nil
+}
+
+func (cb *CircuitBreaker) record(now time.Time, success bool) {
+	if cb.state == StateHalfOpen {
+		if !success {
+			cb.setState(now, StateOpen)
+			return
+		}
+		cb.successes++
+		if cb.successes >= cb.cfg.HalfOpenRequests {
+			cb.setState(now, StateClosed)
+		}
+		return
+	}
+
+	cb.requests++
+	if success {
+		cb.consecutive = 0
+		return
+	}
+	cb.failures++
+	cb.consecutive++
+	if cb.cfg.MaxErrors > 0 && cb.consecutive >= cb.cfg.MaxErrors {
+		cb.setState(now, StateOpen)
+		return
+	}
+	if cb.cfg.ErrorRate > 0 && cb.requests >= cb.cfg.MinRequests &&
+		float64(cb.failures)/float64(cb.requests) >= cb.cfg.ErrorRate {
+		cb.setState(now, StateOpen)
+	}
+}
+
+// refresh 处理随时间发生的变化: 统计周期结束时清零, 打开超时后进入半开状态.
+func (cb *CircuitBreaker) refresh(now time.Time) {
+	switch cb.state {
+	case StateClosed:
+		if !now.Before(cb.expiry) {
+			cb.expiry = now.Add(cb.cfg.Interval)
+			cb.requests, cb.failures = 0, 0
+		}
+	case StateOpen:
+		if !now.Before(cb.expiry) {
+			cb.setState(now, StateHalfOpen)
+		}
+	}
+}
+
+func (cb *CircuitBreaker) setState(now time.Time, state State) {
+	from := cb.state
+	cb.state = state
+	cb.generation++
+	switch state {
+	case StateClosed:
+		cb.reset(now.Add(cb.cfg.Interval))
+	case StateOpen:
+		cb.reset(now.Add(cb.cfg.Timeout))
+	default:
+		cb.reset(time.Time{})
+	}
+	if cb.onChange != nil && from != state {
+		cb.onChange(from, state)
+	}
+}
+
+func (cb *CircuitBreaker) reset(expiry time.Time) {
+	cb.expiry = expiry
+	cb.requests, cb.failures, cb.consecutive = 0, 0, 0
+	cb.probes, cb.successes = 0, 0
+}
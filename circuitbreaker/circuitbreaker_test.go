@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package circuitbreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+)
+
+func TestGetConfig(t *testing.T) {
+	if _, err := GetConfig(config.ExtraConfig{}); err != ErrNoConfigFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+	cfg, err := GetConfig(config.ExtraConfig{Namespace: map[string]interface{}{"max_errors": 3, "timeout": "5s"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxErrors != 3 || cfg.Timeout != 5*time.Second || cfg.Interval != DefaultInterval || cfg.HalfOpenRequests != 1 {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	for _, v := range []map[string]interface{}{
+		{},
+		{"error_rate": 1.5},
+		{"max_errors": 3, "timeout": "soon"},
+		{"max_errors": 3, "interval": "-1s"},
+	} {
+		if _, err := GetConfig(config.ExtraConfig{Namespace: v}); err == nil {
+			t.Errorf("%v: expecting an error", v)
+		}
+	}
+}
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newTestBreaker(cfg Config) (*CircuitBreaker, *clock, *[]string) {
+	c := &clock{now: time.Now()}
+	changes := []string{}
+	cb := New(cfg, func(from, to State) { changes = append(changes, from.String()+"->"+to.String()) })
+	cb.now = c.Now
+	cb.expiry = c.now.Add(cfg.Interval)
+	return cb, c, &changes
+}
+
+func call(cb *CircuitBreaker, success bool) error {
+	done, err := cb.Allow()
+	if err != nil {
+		return err
+	}
+	if success {
+		done(Success)
+	} else {
+		done(Failure)
+	}
+	return nil
+}
+
+func TestCircuitBreaker_consecutiveFailures(t *testing.T) {
+	cb, c, changes := newTestBreaker(Config{MaxErrors: 2, Interval: time.Minute, Timeout: time.Second, HalfOpenRequests: 1})
+
+	call(cb, false)
+	call(cb, true)
+	call(cb, false)
+	if cb.State() != StateClosed {
+		t.Fatal("the failures were not consecutive")
+	}
+	call(cb, false)
+	if cb.State() != StateOpen {
+		t.Fatal("the circuit should be open")
+	}
+	if err := call(cb, true); err != ErrOpen {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	c.now = c.now.Add(time.Second)
+	done, err := cb.Allow()
+	if err != nil || cb.State() != StateHalfOpen {
+		t.Fatalf("the probe should be allowed: %v", err)
+	}
+	if _, err := cb.Allow(); err != ErrOpen {
+		t.Error("only one probe should be allowed")
+	}
+	done(Ignored)
+	if cb.State() != StateHalfOpen {
+		t.Fatal("the ignored probe should not change the state")
+	}
+	done, err = cb.Allow()
+	if err != nil {
+		t.Fatalf("the ignored probe should release its slot: %v", err)
+	}
+	done(Failure)
+	if cb.State() != StateOpen {
+		t.Fatal("the failed probe should open the circuit")
+	}
+
+	c.now = c.now.Add(time.Second)
+	call(cb, true)
+	if cb.State() != StateClosed {
+		t.Fatal("the successful probe should close the circuit")
+	}
+	want := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if len(*changes) != len(want) {
+		t.Fatalf("unexpected changes: %v", *changes)
+	}
+	for i := range want {
+		if (*changes)[i] != want[i] {
+			t.Errorf("unexpected change #%d: %s", i, (*changes)[i])
+		}
+	}
+}
+
+func TestCircuitBreaker_errorRate(t *testing.T) {
+	cb, c, _ := newTestBreaker(Config{ErrorRate: 0.5, MinRequests: 4, Interval: time.Minute, Timeout: time.Second, HalfOpenRequests: 1})
+
+	call(cb, false)
+	call(cb, true)
+	call(cb, false)
+	// 统计周期结束, 计数清零
+	c.now = c.now.Add(time.Minute)
+	call(cb, true)
+	call(cb, false)
+	call(cb, true)
+	if cb.State() != StateClosed {
+		t.Fatal("the circuit should be closed")
+	}
+	call(cb, false)
+	if cb.State() != StateOpen {
+		t.Fatal("the circuit should be open")
+	}
+}
+
+func TestCircuitBreaker_staleResult(t *testing.T) {
+	cb, _, _ := newTestBreaker(Config{MaxErrors: 1, Interval: time.Minute, Timeout: time.Second, HalfOpenRequests: 1})
+	done, _ := cb.Allow()
+	call(cb, false)
+	done(Success)
+	if cb.State() != StateOpen {
+		t.Error("the result of a request allowed before the change should be ignored")
+	}
+}
@@ -175,7 +175,8 @@ type ServiceConfig struct {
 	ClientTLS *ClientTLS `mapstructure:"client_tls"`
 }
 
-// NormalizeEndpoints 处理[]*EndpointConfig每个元素, 标准化Endpoint, 设置QueryString.
+// NormalizeEndpoints 处理[]*EndpointConfig每个元素, 标准化Endpoint, 设置QueryString,
+// 并将插件执行条件中引用的请求头加入HeadersToPass.
 func (s *ServiceConfig) NormalizeEndpoints() {
 	subject := NewURIParser()
 	for _, e := range s.Endpoints {
@@ -183,9 +184,45 @@ func (s *ServiceConfig) NormalizeEndpoints() {
 		ne := subject.GetEndpointPath(e.Endpoint, params)
 		e.Endpoint = ne
 		e.QueryString = []string{"*"}
+		e.HeadersToPass = appendMatchHeaders(e.HeadersToPass, e.Plugins)
 	}
 }
 
+// appendMatchHeaders 将插件执行条件中的请求头加入headers, 已经传递全部请求头时原样返回.
+func appendMatchHeaders(headers []string, plugins []*PluginConfig) []string {
+	for _, p := range plugins {
+		if p == nil || p.Match == nil {
+			continue
+		}
+		names := make([]string, 0, len(p.Match.Header))
+		for k := range p.Match.Header {
+			names = append(names, textproto.CanonicalMIMEHeaderKey(k))
+		}
+		sort.Strings(names)
+		headers = AppendHeaders(headers, names...)
+	}
+	return headers
+}
+
+// AppendHeaders 将names中尚未传递的请求头按规范格式加入headers, 已经传递全部请求头时原样返回.
+func AppendHeaders(headers []string, names ...string) []string {
+	seen := make(map[string]struct{}, len(headers))
+	for _, h := range headers {
+		if h == "*" {
+			return headers
+		}
+		seen[textproto.CanonicalMIMEHeaderKey(h)] = struct{}{}
+	}
+	for _, h := range names {
+		h = textproto.CanonicalMIMEHeaderKey(h)
+		if _, ok := seen[h]; !ok {
+			seen[h] = struct{}{}
+			headers = append(headers, h)
+		}
+	}
+	return headers
+}
+
 // AsyncAgent defines the configuration of a single subscriber/consumer to be initialized
 // and maintained by the lura service
 type AsyncAgent struct {
@@ -238,8 +275,12 @@ type EndpointConfig struct {
 	HeadersToPass []string `mapstructure:"input_headers"`
 	// OutputEncoding defines the encoding strategy to use for the endpoint responses
 	OutputEncoding string `mapstructure:"output_encoding"`
+	// MaxBodySize 请求报文的最大字节数, 超限时返回413. 为0时使用路由器的全局限制(仅gin支持), 没有全局限制时不限制
+	MaxBodySize int64 `mapstructure:"max_body_size"`
 	// Plugins plugin list with configuration
 	Plugins []*PluginConfig `json:"plugins,omitempty" mapstructure:"plugins"`
+	// Source 定义该接口的插件配置文件
+	Source string `json:"-" mapstructure:"-"`
 }
 
 // PluginConfig is plugin's configuration.
@@ -250,6 +291,28 @@ type PluginConfig struct {
 	Name string `mapstructure:"name"`
 	// Index 这个索引值用来对插件进行排序
 	Index int `mapstructure:"index"`
+	// Timeout 插件的最长执行时间, 为0时不限制. 配置文件中可以写作"3s"或纳秒数
+	Timeout time.Duration `mapstructure:"timeout"`
+	// OnTimeout 插件超时后的处理策略: "fail"(默认)中止插件链, "skip"跳过该插件继续执行
+	OnTimeout string `mapstructure:"on_timeout"`
+	// Match 插件的执行条件, 为nil时插件处理所有请求
+	Match *PluginMatch `mapstructure:"match"`
+	// Parsed 由Config解码得到的类型化配置, 插件工厂声明了配置结构时由网关填充
+	Parsed interface{} `json:"-" mapstructure:"-"`
+}
+
+// PluginMatch 插件的执行条件, 所有配置了的条件都满足时插件才会执行.
+type PluginMatch struct {
+	// Method 请求方法, 满足其一即可
+	Method []string `mapstructure:"method"`
+	// Header 请求头, 值为空时只要求请求头存在, 否则要求与其相等
+	Header map[string]string `mapstructure:"header"`
+	// Query 查询参数, 值为空时只要求参数存在, 否则要求与其相等
+	Query map[string]string `mapstructure:"query"`
+	// Param 路径参数, 值为空时只要求参数存在, 否则要求与其相等
+	Param map[string]string `mapstructure:"param"`
+	// DataType Request.Data中的数据类型, 满足其一即可
+	DataType []string `mapstructure:"data_type"`
 }
 
 // EndpointPluginList is a endpoint's plugin list.
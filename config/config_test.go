@@ -210,7 +210,7 @@ func TestConfig_init(t *testing.T) {
 		t.Error(err.Error())
 	}
 
-	if hash != "0O1SlXMLFZwKikXa02ymwM301C8q0P4ekbb5PzsBbxM=" {
+	if hash != "LQfQthiEBHfBtmrRasohn2UsVsPvIlmZhgqbwotVxcQ=" {
 		t.Errorf("unexpected hash: %s", hash)
 	}
 }
@@ -304,3 +304,41 @@ func TestConfig_initKOInvalidDebugPattern(t *testing.T) {
 
 	invalidPattern = dp
 }
+
+func TestServiceConfig_NormalizeEndpoints(t *testing.T) {
+	match := &PluginMatch{Header: map[string]string{"x-device-type": "camera", "User-Identify": ""}}
+	s := ServiceConfig{Endpoints: []*EndpointConfig{
+		{Endpoint: "/VIID/Faces", Plugins: []*PluginConfig{{Name: "a", Match: match}, {Name: "b"}}},
+		{Endpoint: "/VIID/APEs", HeadersToPass: []string{"User-Identify"}, Plugins: []*PluginConfig{{Name: "a", Match: match}}},
+		{Endpoint: "/VIID/Images", HeadersToPass: []string{"*"}, Plugins: []*PluginConfig{{Name: "a", Match: match}}},
+		{Endpoint: "/VIID/Motors"},
+	}}
+	s.NormalizeEndpoints()
+
+	for i, want := range []string{
+		"[User-Identify X-Device-Type]",
+		"[User-Identify X-Device-Type]",
+		"[*]",
+		"[]",
+	} {
+		if have := fmt.Sprint(s.Endpoints[i].HeadersToPass); have != want {
+			t.Errorf("%s: unexpected headers to pass. have: %s, want: %s", s.Endpoints[i].Endpoint, have, want)
+		}
+	}
+}
+
+func TestAppendHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		headers []string
+		names   []string
+		want    string
+	}{
+		{nil, []string{"authorization"}, "[Authorization]"},
+		{[]string{"User-Identify"}, []string{"user-identify", "Content-Type"}, "[User-Identify Content-Type]"},
+		{[]string{"*"}, []string{"Authorization"}, "[*]"},
+	} {
+		if have := fmt.Sprint(AppendHeaders(tc.headers, tc.names...)); have != tc.want {
+			t.Errorf("unexpected headers. have: %s, want: %s", have, tc.want)
+		}
+	}
+}
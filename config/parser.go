@@ -269,6 +269,7 @@ type parseableEndpointConfig struct {
 	ExtraConfig     *ExtraConfig        `json:"extra_config,omitempty"`
 	HeadersToPass   []string            `json:"input_headers"`
 	OutputEncoding  string              `json:"output_encoding"`
+	MaxBodySize     int64               `json:"max_body_size"`
 }
 
 func (p *parseableEndpointConfig) normalize() *EndpointConfig {
@@ -281,6 +282,7 @@ func (p *parseableEndpointConfig) normalize() *EndpointConfig {
 		QueryString:     p.QueryString,
 		HeadersToPass:   p.HeadersToPass,
 		OutputEncoding:  p.OutputEncoding,
+		MaxBodySize:     p.MaxBodySize,
 	}
 	if p.ExtraConfig != nil {
 		e.ExtraConfig = *p.ExtraConfig
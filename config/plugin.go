@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PluginFileSuffix 接口插件配置文件的后缀.
+const PluginFileSuffix = ".json"
+
+// ListPluginFiles 列出目录下所有的接口插件配置文件, 按文件名排序.
+func ListPluginFiles(dirName string) ([]string, error) {
+	files, err := os.ReadDir(dirName)
+	if err != nil {
+		return nil, err
+	}
+
+	fileList := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), PluginFileSuffix) {
+			continue
+		}
+		fileList = append(fileList, filepath.Join(dirName, file.Name()))
+	}
+	sort.Strings(fileList)
+	return fileList, nil
+}
+
+// ReadPluginDir 读取目录下所有的接口插件配置文件.
+// 解析失败的文件会被跳过, 其错误信息汇总在返回的error中.
+func ReadPluginDir(dirName string) ([]*EndpointConfig, error) {
+	array := make([]*EndpointConfig, 0)
+
+	fileList, err := ListPluginFiles(dirName)
+	if err != nil {
+		return nil, err
+	}
+
+	var errString string
+	for _, p := range fileList {
+		plugin, err := ReadPluginFile(p)
+		if plugin == nil {
+			if err != nil {
+				errString += err.Error() + ";"
+			}
+			continue
+		}
+		array = append(array, plugin...)
+	}
+	if errString == "" {
+		return array, nil
+	}
+	return array, fmt.Errorf("%s", errString)
+}
+
+// ReadPluginFile 读取单个接口插件配置文件.
+func ReadPluginFile(fileName string) ([]*EndpointConfig, error) {
+	plugin := &EndpointPluginList{}
+	bytes, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(bytes, plugin); err != nil {
+		return nil, CheckErr(err, fileName)
+	}
+	for _, e := range plugin.Plugin {
+		e.Source = fileName
+	}
+	return plugin.Plugin, nil
+}
+
+const (
+	// PluginTimeoutFail 插件超时后中止插件链并返回错误
+	PluginTimeoutFail = "fail"
+	// PluginTimeoutSkip 插件超时后跳过该插件, 继续执行后续插件
+	PluginTimeoutSkip = "skip"
+)
+
+// UnmarshalJSON 解析插件配置, Timeout支持"3s"这样的字符串或纳秒数.
+func (p *PluginConfig) UnmarshalJSON(b []byte) error {
+	type plain PluginConfig
+	aux := struct {
+		*plain
+		Timeout interface{} `json:"Timeout"`
+	}{plain: (*plain)(p)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	switch v := aux.Timeout.(type) {
+	case nil:
+		p.Timeout = 0
+	case float64:
+		p.Timeout = time.Duration(v)
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("plugin '%s': invalid timeout: %s", p.Name, err.Error())
+		}
+		p.Timeout = d
+	default:
+		return fmt.Errorf("plugin '%s': invalid timeout: %v", p.Name, v)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadPluginDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.json":   `{"Plugin":[{"Endpoint":"/a","Method":"POST","Plugins":[{"Name":"x","Index":1}]}]}`,
+		"b.json":   `{"Plugin":[{"Endpoint":"/b","Method":"GET"},{"Endpoint":"/c","Method":"PUT"}]}`,
+		"c.json":   `{"Plugin":[`,
+		"d.txt":    `{"Plugin":[{"Endpoint":"/d","Method":"GET"}]}`,
+		"e.json.1": `{}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	endpoints, err := ReadPluginDir(dir)
+	if err == nil {
+		t.Error("expecting an error for the malformed file")
+	}
+	if len(endpoints) != 3 {
+		t.Errorf("unexpected number of endpoints: %d", len(endpoints))
+		return
+	}
+	for i, path := range []string{"/a", "/b", "/c"} {
+		if endpoints[i].Endpoint != path {
+			t.Errorf("unexpected endpoint #%d: %s", i, endpoints[i].Endpoint)
+		}
+	}
+	if len(endpoints[0].Plugins) != 1 || endpoints[0].Plugins[0].Name != "x" || endpoints[0].Plugins[0].Index != 1 {
+		t.Errorf("unexpected plugins: %+v", endpoints[0].Plugins)
+	}
+}
+
+func TestReadPluginDir_noFolder(t *testing.T) {
+	if _, err := ReadPluginDir(filepath.Join(t.TempDir(), "unknown")); err == nil {
+		t.Error("expecting an error")
+	}
+}
+
+func TestPluginConfig_UnmarshalJSON(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		`{"Name":"x"}`:                                      0,
+		`{"Name":"x","Timeout":"3s"}`:                       3 * time.Second,
+		`{"Name":"x","timeout":1000000}`:                    time.Millisecond,
+		`{"Name":"x","Timeout":"500ms","OnTimeout":"skip"}`: 500 * time.Millisecond,
+	} {
+		var p PluginConfig
+		if err := json.Unmarshal([]byte(in), &p); err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if p.Name != "x" || p.Timeout != want {
+			t.Errorf("%s: unexpected config %+v", in, p)
+		}
+	}
+
+	var p PluginConfig
+	if err := json.Unmarshal([]byte(`{"Name":"x","Timeout":"soon"}`), &p); err == nil {
+		t.Error("expecting an error")
+	}
+}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+Package health 汇总各子系统的运行状态, 由路由器的健康检查接口(/__health)输出.
+*/
+package health
+
+import (
+	"sort"
+	"sync"
+)
+
+// ReportsKey 各子系统的状态在/__health接口中所在的键, 与接口自带的字段分开, 避免同名覆盖.
+const ReportsKey = "reports"
+
+// Reporter 返回子系统当前的状态, 结果会被序列化为JSON.
+type Reporter func() interface{}
+
+var (
+	mu        = &sync.RWMutex{}
+	reporters = map[string]Reporter{}
+)
+
+// Register 注册子系统的状态报告, 同名的报告会被替换.
+func Register(name string, r Reporter) {
+	mu.Lock()
+	reporters[name] = r
+	mu.Unlock()
+}
+
+// Unregister 注销子系统的状态报告.
+func Unregister(name string) {
+	mu.Lock()
+	delete(reporters, name)
+	mu.Unlock()
+}
+
+// Names 返回已注册的报告名称.
+func Names() []string {
+	mu.RLock()
+	names := make([]string, 0, len(reporters))
+	for name := range reporters {
+		names = append(names, name)
+	}
+	mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Report 收集所有子系统的状态.
+func Report() map[string]interface{} {
+	mu.RLock()
+	defer mu.RUnlock()
+	report := make(map[string]interface{}, len(reporters))
+	for name, r := range reporters {
+		report[name] = r()
+	}
+	return report
+}
@@ -0,0 +1,28 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	Register("b", func() interface{} { return 2 })
+	Register("a", func() interface{} { return 1 })
+	Register("a", func() interface{} { return 3 })
+	defer Unregister("b")
+	defer Unregister("a")
+
+	if have, want := fmt.Sprint(Names()), "[a b]"; have != want {
+		t.Errorf("unexpected names. have: %s, want: %s", have, want)
+	}
+	if have, want := fmt.Sprint(Report()), "map[a:3 b:2]"; have != want {
+		t.Errorf("unexpected report. have: %s, want: %s", have, want)
+	}
+
+	Unregister("b")
+	if len(Report()) != 1 {
+		t.Errorf("unexpected report: %v", Report())
+	}
+}
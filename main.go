@@ -2,22 +2,28 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
 	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/gin-contrib/pprof"
 	"github.com/luraproject/lura/v2/config"
 	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/plugin/dedup"
+	"github.com/luraproject/lura/v2/plugin/devicesession"
+	"github.com/luraproject/lura/v2/plugin/digestauth"
 	"github.com/luraproject/lura/v2/plugin/identifycheck"
+	"github.com/luraproject/lura/v2/plugin/imageoffload"
+	"github.com/luraproject/lura/v2/plugin/subscribe"
 	"github.com/luraproject/lura/v2/router/gin"
 	"github.com/luraproject/lura/v2/vicg"
 )
 
+// pluginDir 插件配置文件目录, 文件变化时自动热加载
+const pluginDir = "plugin"
+
+// soPluginDir Go插件(.so)目录, 启动时从中加载插件工厂
+const soPluginDir = "plugin/so"
+
 // 配置文件: plugin\plugin.json
 // 在上述配置文件中配置HTTP接口的处理插件
 func main() {
@@ -32,9 +38,10 @@ func main() {
 		Port:            9000,
 		SequentialStart: true,
 		ExtraConfig:     map[string]interface{}{"Hello": "world"},
+		OutputEncoding:  gin.ViidStatusList,
 	}
 	var err error
-	srvConf.Endpoints, err = ReadPluginDir("plugin")
+	srvConf.Endpoints, err = config.ReadPluginDir(pluginDir)
 	if err != nil {
 		log.Info(err)
 		return
@@ -42,64 +49,24 @@ func main() {
 	srvConf.NormalizeEndpoints()
 	// 全局插件工厂
 	factory := map[string]vicg.VicgPluginFactory{
-		"IdentifyCheck": identifycheck.Factory{},
+		"IdentifyCheck": identifycheck.Factory{Logger: log},
+		"DigestAuth":    digestauth.Factory{},
+		"DeviceSession": devicesession.Factory{},
+		"Subscribe":     subscribe.Factory{},
+		"ImageOffload":  imageoffload.Factory{},
+		"Dedup":         dedup.NewFactory(log),
+	}
+	if _, err := os.Stat(soPluginDir); err == nil {
+		if _, err = vicg.LoadPlugins(soPluginDir, ".so", factory, log); err != nil {
+			log.Warning(err)
+		}
 	}
 	f := func(cfg *gin.Config) {
+		// 带有/__health接口的引擎
+		cfg.Engine = gin.NewEngine(srvConf, gin.EngineOptions{Logger: log, Writer: os.Stdout})
 		pprof.Register(cfg.Engine) // 注册pprof
 	}
-	router := gin.DefaultVicgFactory(vicg.DefaultVicgFactory(log, factory), log, f).NewWithContext(ctx)
+	router := gin.DefaultVicgFactory(vicg.DefaultVicgFactory(log, factory), log, f,
+		gin.WithPluginReload(pluginDir, gin.DefaultReloadInterval)).NewWithContext(ctx)
 	router.Run(srvConf)
 }
-
-func ReadPluginDir(dirName string) ([]*config.EndpointConfig, error) {
-	array := make([]*config.EndpointConfig, 0)
-	var fileList = make([]string, 0)
-
-	files, err := os.ReadDir(dirName)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, file := range files {
-		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
-			continue
-		}
-		fileList = append(fileList, filepath.Join(dirName, file.Name()))
-	}
-	var errString string
-	for _, p := range fileList {
-		plugin, err := readPluginFile(p)
-		if plugin == nil {
-			if err != nil {
-				errString += err.Error() + ";"
-			}
-			continue
-		}
-		array = append(array, plugin...)
-	}
-	if errString == "" {
-		return array, nil
-	}
-	return array, fmt.Errorf("%s", errString)
-}
-
-func readPluginFile(fileName string) ([]*config.EndpointConfig, error) {
-	plugin := &config.EndpointPluginList{}
-	file, err := os.Open(fileName)
-	if err != nil {
-		return nil, err
-	}
-
-	defer file.Close()
-
-	bytes, err := io.ReadAll(file)
-	if err != nil {
-		return nil, err
-	}
-
-	err = json.Unmarshal(bytes, plugin)
-	if err != nil {
-		return nil, err
-	}
-	return plugin.Plugin, nil
-}
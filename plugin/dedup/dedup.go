@@ -0,0 +1,184 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/vicg"
+	"github.com/luraproject/lura/v2/vicg/dedup"
+)
+
+/* ************************** 重复上传去重插件 ******************** */
+
+// 重复对象的处理方式.
+const (
+	// ModeDrop 从请求中删除重复的对象
+	ModeDrop = "drop"
+	// ModeFlag 保留重复的对象, 只在Request.Private中标记
+	ModeFlag = "flag"
+)
+
+// DuplicatesKey 重复对象的编号在Request.Private中的键, 值为[]string.
+const DuplicatesKey = "Dedup.Duplicates"
+
+// recordedKey 本次请求记录的键在Request.Private中的键, 请求失败时删除.
+const recordedKey = "Dedup.Recorded"
+
+// DuplicateMessage 重复对象应答状态的描述.
+const DuplicateMessage = "duplicate object"
+
+// DefaultTTL 对象编号的默认保留时间.
+const DefaultTTL = 10 * time.Minute
+
+// Config 插件配置.
+type Config struct {
+	// TTL 对象编号的保留时间, 如"10m"
+	TTL string `json:"TTL" validate:"required"`
+	// Mode 重复对象的处理方式
+	Mode string `json:"Mode" validate:"oneof=drop flag"`
+	// Types 需要去重的对象类型, 为空时处理所有类型
+	Types []string `json:"Types"`
+}
+
+// Validate 实现配置的额外校验.
+func (c *Config) Validate() error {
+	if d, err := time.ParseDuration(c.TTL); err != nil || d <= 0 {
+		return fmt.Errorf("field 'TTL': invalid duration '%s'", c.TTL)
+	}
+	return nil
+}
+
+// Factory 插件工厂, 同一个工厂创建的插件共享Store.
+type Factory struct {
+	Store  dedup.Store
+	Logger logging.Logger
+}
+
+// Plugin defines
+type Plugin struct {
+	name   string
+	index  int
+	ttl    time.Duration
+	mode   string
+	types  map[string]struct{}
+	store  dedup.Store
+	logger logging.Logger
+}
+
+// NewFactory 创建使用进程内存储的插件工厂.
+func NewFactory(logger logging.Logger) Factory {
+	return Factory{Store: dedup.NewInMemoryStore(), Logger: logger}
+}
+
+// NewConfig 实现vicg.ConfigurableFactory接口.
+func (e Factory) NewConfig() interface{} {
+	return &Config{TTL: DefaultTTL.String(), Mode: ModeDrop}
+}
+
+func (e Factory) New(cfg *config.PluginConfig, infra interface{}) (vicg.VicgPlugin, error) {
+	if e.Store == nil {
+		return nil, fmt.Errorf("the plugin '%s' requires a dedup store", cfg.Name)
+	}
+	c := Config{TTL: DefaultTTL.String(), Mode: ModeDrop}
+	if p, ok := cfg.Parsed.(*Config); ok {
+		c = *p
+	}
+	ttl, err := time.ParseDuration(c.TTL)
+	if err != nil {
+		return nil, err
+	}
+	logger := e.Logger
+	if logger == nil {
+		logger = logging.NoOp
+	}
+	p := &Plugin{
+		name:   cfg.Name,
+		index:  cfg.Index,
+		ttl:    ttl,
+		mode:   c.Mode,
+		store:  e.Store,
+		logger: logger,
+	}
+	if len(c.Types) > 0 {
+		p.types = make(map[string]struct{}, len(c.Types))
+		for _, t := range c.Types {
+			p.types[t] = struct{}{}
+		}
+	}
+	return p, nil
+}
+
+// HandleHTTPMessage 记录对象编号, 重复的对象按照Mode处理并在应答状态列表中报告.
+// 存储出错时不做去重, 以免丢失数据.
+func (e *Plugin) HandleHTTPMessage(ctx context.Context, request *proxy.Request, response *proxy.Response) error {
+	var duplicates, recorded []string
+	dropped := false
+	for dataType, objects := range request.Data {
+		if _, ok := e.types[dataType]; e.types != nil && !ok {
+			continue
+		}
+		kept := objects[:0:0]
+		for _, o := range objects {
+			id, _ := o[dataType+"ID"].(string)
+			if id == "" {
+				kept = append(kept, o)
+				continue
+			}
+			key := dataType + ":" + id
+			added, err := e.store.Add(ctx, key, e.ttl)
+			if err != nil {
+				e.logger.Warning(fmt.Sprintf("[VICG: %s] Recording '%s' failed: %s", e.name, key, err.Error()))
+				added = true
+			} else if added {
+				recorded = append(recorded, key)
+			}
+			if added {
+				kept = append(kept, o)
+				continue
+			}
+			duplicates = append(duplicates, id)
+			response.AddResponseStatus(proxy.NewResponseStatus(request.Path, id, proxy.ViidStatusOK, DuplicateMessage))
+			if e.mode == ModeFlag {
+				kept = append(kept, o)
+			}
+		}
+		if len(kept) != len(objects) {
+			request.Data[dataType] = kept
+			dropped = true
+		}
+	}
+
+	if request.Private == nil {
+		request.Private = map[string]interface{}{}
+	}
+	request.Private[recordedKey] = recorded
+	if len(duplicates) > 0 {
+		request.Private[DuplicatesKey] = duplicates
+	}
+	if !dropped {
+		return nil
+	}
+	return vicg.EncodeRequest(request)
+}
+
+func (e *Plugin) Priority() int {
+	return e.index
+}
+
+// Finally 请求失败时删除本次记录的对象编号, 设备重试时不会被当作重复上传.
+func (e *Plugin) Finally(ctx context.Context, request *proxy.Request, response *proxy.Response, err error) {
+	if err == nil && (response == nil || response.Metadata.StatusCode < http.StatusBadRequest) {
+		return
+	}
+	recorded, _ := request.Private[recordedKey].([]string)
+	for _, key := range recorded {
+		if err := e.store.Remove(context.Background(), key); err != nil {
+			e.logger.Warning(fmt.Sprintf("[VICG: %s] Removing '%s' failed: %s", e.name, key, err.Error()))
+		}
+	}
+}
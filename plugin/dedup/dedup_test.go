@@ -0,0 +1,89 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/vicg"
+)
+
+func newRequest(ids ...string) *proxy.Request {
+	faces := make([]map[string]interface{}, len(ids))
+	for i, id := range ids {
+		faces[i] = map[string]interface{}{"FaceID": id}
+	}
+	return &proxy.Request{Path: "/VIID/Faces", Data: map[string][]map[string]interface{}{"Face": faces}}
+}
+
+func TestPlugin_drop(t *testing.T) {
+	p, err := NewFactory(logging.NoOp).New(&config.PluginConfig{Name: "Dedup", Parsed: &Config{TTL: "1m", Mode: ModeDrop}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := &proxy.Response{}
+	request := newRequest("f1", "f2", "f1")
+	if err = p.HandleHTTPMessage(context.Background(), request, response); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.Data["Face"]) != 2 || len(response.StatusList) != 1 || response.StatusList[0].ID != "f1" {
+		t.Errorf("unexpected result: %v %+v", request.Data, response.StatusList)
+	}
+	body, _ := io.ReadAll(request.Body)
+	if strings.Count(string(body), `"FaceID"`) != 2 {
+		t.Errorf("unexpected body: %s", body)
+	}
+
+	response = &proxy.Response{}
+	request = newRequest("f2", "f3")
+	if err = p.HandleHTTPMessage(context.Background(), request, response); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.Data["Face"]) != 1 || request.Data["Face"][0]["FaceID"] != "f3" {
+		t.Errorf("unexpected data: %v", request.Data)
+	}
+	if d, _ := request.Private[DuplicatesKey].([]string); len(d) != 1 || d[0] != "f2" {
+		t.Errorf("unexpected duplicates: %v", request.Private[DuplicatesKey])
+	}
+
+	// 请求失败时, 本次记录的f3被删除, 设备可以重试
+	p.(vicg.Finalizer).Finally(context.Background(), request, response, errors.New("backend failed"))
+	request = newRequest("f3")
+	if err = p.HandleHTTPMessage(context.Background(), request, &proxy.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.Data["Face"]) != 1 {
+		t.Errorf("the object of the failed request should not be a duplicate: %v", request.Data)
+	}
+}
+
+func TestPlugin_flag(t *testing.T) {
+	p, err := NewFactory(logging.NoOp).New(&config.PluginConfig{Name: "Dedup", Parsed: &Config{TTL: "1m", Mode: ModeFlag, Types: []string{"Face"}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.HandleHTTPMessage(context.Background(), newRequest("f1"), &proxy.Response{})
+
+	response := &proxy.Response{}
+	request := newRequest("f1")
+	request.Data["MotorVehicle"] = []map[string]interface{}{{"MotorVehicleID": "m1"}, {"MotorVehicleID": "m1"}}
+	if err = p.HandleHTTPMessage(context.Background(), request, response); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.Data["Face"]) != 1 || len(request.Data["MotorVehicle"]) != 2 || len(response.StatusList) != 1 || request.Body != nil {
+		t.Errorf("unexpected result: %v %+v", request.Data, response.StatusList)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cfg := &Config{TTL: "soon", Mode: ModeDrop}
+	if errs := vicg.DecodePluginConfig(nil, cfg); len(errs) == 0 {
+		t.Error("expecting an error")
+	}
+}
@@ -0,0 +1,164 @@
+package devicesession
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/plugin/digestauth"
+	"github.com/luraproject/lura/v2/plugin/identifycheck"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/vicg"
+	"github.com/luraproject/lura/v2/vicg/session"
+)
+
+/* ************************** 设备会话插件 ******************** */
+
+// 插件的动作.
+const (
+	// ActionRegister 注册接口: 创建会话
+	ActionRegister = "register"
+	// ActionKeepalive 保活接口: 延长会话
+	ActionKeepalive = "keepalive"
+	// ActionUnregister 注销接口: 删除会话
+	ActionUnregister = "unregister"
+	// ActionCheck 数据接口: 拒绝没有有效会话的设备
+	ActionCheck = "check"
+)
+
+// 插件的错误码.
+const (
+	// ErrCodeNotRegistered 设备未注册或会话已过期
+	ErrCodeNotRegistered = "DEVICE_NOT_REGISTERED"
+	// ErrCodeUnauthenticated 注册、保活、注销请求没有经过认证
+	ErrCodeUnauthenticated = "DEVICE_UNAUTHENTICATED"
+	// ErrCodeDeviceMismatch 请求对象中的设备编码与认证的设备不一致
+	ErrCodeDeviceMismatch = "DEVICE_MISMATCH"
+)
+
+// dataTypes 各动作对应的请求对象类型.
+var dataTypes = map[string]string{
+	ActionRegister:   "Register",
+	ActionKeepalive:  "Keepalive",
+	ActionUnregister: "UnRegister",
+}
+
+// Config 插件配置.
+// 注册、保活、注销接口的设备身份来自IdentifyCheck或DigestAuth插件, 它们的Index必须小于本插件,
+// 请求对象中的DeviceID只用于核对, 不作为设备身份.
+type Config struct {
+	// Action 插件的动作
+	Action string `json:"Action" validate:"oneof=register keepalive unregister check"`
+}
+
+type Factory struct {
+}
+
+// Plugin defines
+type Plugin struct {
+	name     string
+	index    int
+	action   string
+	sessions *session.Manager
+}
+
+// RequestHeaders 实现vicg.HeadersFactory接口.
+func (e Factory) RequestHeaders() []string {
+	return []string{"User-Identify"}
+}
+
+// NewConfig 实现vicg.ConfigurableFactory接口.
+func (e Factory) NewConfig() interface{} {
+	return &Config{Action: ActionCheck}
+}
+
+func (e Factory) New(cfg *config.PluginConfig, infra interface{}) (vicg.VicgPlugin, error) {
+	i, ok := infra.(*vicg.Infra)
+	if !ok || i.Sessions == nil {
+		return nil, fmt.Errorf("the plugin '%s' requires the device session manager", cfg.Name)
+	}
+	action := ActionCheck
+	if c, ok := cfg.Parsed.(*Config); ok {
+		action = c.Action
+	}
+	return &Plugin{
+		name:     cfg.Name,
+		index:    cfg.Index,
+		action:   action,
+		sessions: i.Sessions,
+	}, nil
+}
+
+func (e *Plugin) HandleHTTPMessage(ctx context.Context, request *proxy.Request, response *proxy.Response) error {
+	deviceID, err := deviceID(request, e.action)
+	if err != nil {
+		return err
+	}
+
+	switch e.action {
+	case ActionRegister:
+		e.sessions.Register(deviceID, request.SourceIP())
+	case ActionKeepalive:
+		if !e.sessions.Keepalive(deviceID) {
+			return notRegistered(deviceID)
+		}
+	case ActionUnregister:
+		if !e.sessions.Unregister(deviceID) {
+			return notRegistered(deviceID)
+		}
+	default:
+		if _, ok := e.sessions.Get(deviceID); !ok {
+			return notRegistered(deviceID)
+		}
+		return nil
+	}
+	response.SetResponseStatus(proxy.NewResponseStatus(request.Path, deviceID, proxy.ViidStatusOK, "OK"))
+	return nil
+}
+
+func (e *Plugin) Priority() int {
+	return e.index
+}
+
+// deviceID 返回请求的设备编码. 注册、保活、注销接口只使用认证插件确认的设备身份,
+// 请求对象中的DeviceID必须与之一致; 数据接口没有认证的身份时使用User-Identify.
+func deviceID(request *proxy.Request, action string) (string, error) {
+	id := identity(request)
+	t, ok := dataTypes[action]
+	if !ok {
+		if id == "" {
+			id = request.HeaderGet("User-Identify")
+		}
+		if id == "" {
+			return "", vicg.NewPluginError(http.StatusBadRequest, ErrCodeNotRegistered, proxy.ViidStatusInvalidJSONContent, "missing device id")
+		}
+		return id, nil
+	}
+	if id == "" {
+		return "", vicg.NewPluginError(http.StatusUnauthorized, ErrCodeUnauthenticated, proxy.ViidStatusInvalidOperation, "the device is not authenticated")
+	}
+	if objects := request.Data[t]; len(objects) > 0 {
+		if claimed, _ := objects[0]["DeviceID"].(string); claimed != "" && claimed != id {
+			return "", vicg.NewPluginError(http.StatusForbidden, ErrCodeDeviceMismatch, proxy.ViidStatusInvalidOperation,
+				fmt.Sprintf("the device '%s' cannot act as '%s'", id, claimed))
+		}
+	}
+	return id, nil
+}
+
+// identity 返回认证插件确认的设备身份: IdentifyCheck解析的设备, 或者DigestAuth认证通过的用户名.
+func identity(request *proxy.Request) string {
+	if d, ok := request.Private[identifycheck.DeviceKey].(*identifycheck.Device); ok && d != nil && d.ID != "" {
+		return d.ID
+	}
+	if username, ok := request.Private[digestauth.UsernameKey].(string); ok {
+		return username
+	}
+	return ""
+}
+
+func notRegistered(deviceID string) error {
+	return vicg.NewPluginError(http.StatusUnauthorized, ErrCodeNotRegistered, proxy.ViidStatusInvalidOperation,
+		fmt.Sprintf("the device '%s' is not registered or its session expired", deviceID))
+}
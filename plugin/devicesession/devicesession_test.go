@@ -0,0 +1,89 @@
+package devicesession
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/plugin/digestauth"
+	"github.com/luraproject/lura/v2/plugin/identifycheck"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/vicg"
+	"github.com/luraproject/lura/v2/vicg/session"
+)
+
+func TestPlugin(t *testing.T) {
+	infra := &vicg.Infra{Sessions: session.NewManager(time.Minute)}
+	plugins := map[string]vicg.VicgPlugin{}
+	for _, action := range []string{ActionRegister, ActionKeepalive, ActionUnregister, ActionCheck} {
+		p, err := Factory{}.New(&config.PluginConfig{Name: "DeviceSession", Parsed: &Config{Action: action}}, infra)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plugins[action] = p
+	}
+
+	handle := func(action string, request *proxy.Request) int {
+		err := plugins[action].HandleHTTPMessage(context.Background(), request, &proxy.Response{})
+		var pe *vicg.PluginError
+		if errors.As(err, &pe) {
+			return pe.StatusCode()
+		}
+		return 0
+	}
+	object := func(dataType string) *proxy.Request {
+		return &proxy.Request{
+			Data:    map[string][]map[string]interface{}{dataType: {{"DeviceID": "31010000001190000001"}}},
+			Private: map[string]interface{}{digestauth.UsernameKey: "31010000001190000001"},
+		}
+	}
+	upload := &proxy.Request{Headers: map[string][]string{"User-Identify": {"31010000001190000001"}}}
+
+	if status := handle(ActionCheck, upload); status != http.StatusUnauthorized {
+		t.Errorf("unexpected status code for an unregistered device: %d", status)
+	}
+	if status := handle(ActionKeepalive, object("Keepalive")); status != http.StatusUnauthorized {
+		t.Errorf("unexpected status code for an unregistered keepalive: %d", status)
+	}
+	if status := handle(ActionRegister, object("Register")); status != 0 {
+		t.Errorf("unexpected status code for the register: %d", status)
+	}
+	if status := handle(ActionKeepalive, object("Keepalive")); status != 0 {
+		t.Errorf("unexpected status code for the keepalive: %d", status)
+	}
+	if status := handle(ActionCheck, upload); status != 0 {
+		t.Errorf("unexpected status code for a registered device: %d", status)
+	}
+	if status := handle(ActionUnregister, object("UnRegister")); status != 0 {
+		t.Errorf("unexpected status code for the unregister: %d", status)
+	}
+	if status := handle(ActionCheck, upload); status != http.StatusUnauthorized {
+		t.Errorf("unexpected status code for an unregistered device: %d", status)
+	}
+	if status := handle(ActionCheck, &proxy.Request{}); status != http.StatusBadRequest {
+		t.Errorf("unexpected status code for a missing device id: %d", status)
+	}
+
+	// 注册请求的设备身份来自认证插件, 而不是请求报文
+	forged := object("Register")
+	forged.Private = nil
+	if status := handle(ActionRegister, forged); status != http.StatusUnauthorized {
+		t.Errorf("unexpected status code for an unauthenticated register: %d", status)
+	}
+	forged.Private = map[string]interface{}{identifycheck.DeviceKey: &identifycheck.Device{ID: "31010000001190000002"}}
+	if status := handle(ActionRegister, forged); status != http.StatusForbidden {
+		t.Errorf("unexpected status code for a forged register: %d", status)
+	}
+	if status := handle(ActionCheck, upload); status != http.StatusUnauthorized {
+		t.Errorf("the forged register created a session: %d", status)
+	}
+}
+
+func TestFactory_noInfra(t *testing.T) {
+	if _, err := (Factory{}).New(&config.PluginConfig{Name: "DeviceSession"}, nil); err == nil {
+		t.Error("expecting an error")
+	}
+}
@@ -0,0 +1,381 @@
+package digestauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/vicg"
+)
+
+/* ************************** HTTP摘要认证插件 ******************** */
+
+// ErrCodeUnauthorized 摘要认证失败的错误码.
+const ErrCodeUnauthorized = "DIGEST_AUTH_FAILED"
+
+// UsernameKey 认证通过的用户名在Request.Private中的键.
+const UsernameKey = "DigestAuth.Username"
+
+// 支持的摘要算法.
+const (
+	AlgorithmMD5    = "MD5"
+	AlgorithmSHA256 = "SHA-256"
+)
+
+// 默认配置.
+const (
+	DefaultRealm       = "VIID"
+	DefaultNonceExpiry = 5 * time.Minute
+)
+
+// Config 插件配置.
+type Config struct {
+	// Realm 认证域
+	Realm string `json:"Realm"`
+	// Algorithms 支持的摘要算法, 按优先级排列, 默认只支持MD5
+	Algorithms []string `json:"Algorithms" validate:"min=1"`
+	// NonceExpiry nonce的有效期, 如"5m"
+	NonceExpiry string `json:"NonceExpiry"`
+	// Users 用户名与密码
+	Users map[string]string `json:"Users"`
+	// CredentialsFile 用户凭证文件, 格式为{"Users":{"用户名":"密码"}}, 与Users合并
+	CredentialsFile string `json:"CredentialsFile"`
+}
+
+// Validate 实现配置的额外校验.
+func (c *Config) Validate() error {
+	if c.Realm == "" {
+		return fmt.Errorf("field 'Realm': is required")
+	}
+	for _, a := range c.Algorithms {
+		if _, ok := hashes[a]; !ok {
+			return fmt.Errorf("field 'Algorithms': unsupported algorithm '%s'", a)
+		}
+	}
+	if c.NonceExpiry != "" {
+		if _, err := time.ParseDuration(c.NonceExpiry); err != nil {
+			return fmt.Errorf("field 'NonceExpiry': %s", err.Error())
+		}
+	}
+	if len(c.Users) == 0 && c.CredentialsFile == "" {
+		return fmt.Errorf("either 'Users' or 'CredentialsFile' is required")
+	}
+	return nil
+}
+
+var hashes = map[string]func() hash.Hash{
+	AlgorithmMD5:    md5.New,
+	AlgorithmSHA256: sha256.New,
+}
+
+type Factory struct {
+}
+
+// Plugin defines
+type Plugin struct {
+	name       string
+	index      int
+	realm      string
+	algorithms []string
+	users      map[string]string
+	nonces     *nonceStore
+}
+
+// RequestHeaders 实现vicg.HeadersFactory接口.
+func (e Factory) RequestHeaders() []string {
+	return []string{"Authorization"}
+}
+
+// NewConfig 实现vicg.ConfigurableFactory接口.
+func (e Factory) NewConfig() interface{} {
+	return &Config{Realm: DefaultRealm, Algorithms: []string{AlgorithmMD5}}
+}
+
+func (e Factory) New(cfg *config.PluginConfig, infra interface{}) (vicg.VicgPlugin, error) {
+	c, ok := cfg.Parsed.(*Config)
+	if !ok {
+		return nil, fmt.Errorf("the plugin '%s' requires a config", cfg.Name)
+	}
+	users := map[string]string{}
+	if c.CredentialsFile != "" {
+		b, err := os.ReadFile(c.CredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		f := struct {
+			Users map[string]string `json:"Users"`
+		}{}
+		if err = json.Unmarshal(b, &f); err != nil {
+			return nil, fmt.Errorf("the credentials file '%s': %s", c.CredentialsFile, err.Error())
+		}
+		for k, v := range f.Users {
+			users[k] = v
+		}
+	}
+	for k, v := range c.Users {
+		users[k] = v
+	}
+	expiry := DefaultNonceExpiry
+	if c.NonceExpiry != "" {
+		expiry, _ = time.ParseDuration(c.NonceExpiry)
+	}
+	nonces, err := newNonceStore(expiry)
+	if err != nil {
+		return nil, err
+	}
+	return &Plugin{
+		name:       cfg.Name,
+		index:      cfg.Index,
+		realm:      c.Realm,
+		algorithms: c.Algorithms,
+		users:      users,
+		nonces:     nonces,
+	}, nil
+}
+
+func (e *Plugin) HandleHTTPMessage(ctx context.Context, request *proxy.Request, response *proxy.Response) error {
+	auth := request.HeaderGet("Authorization")
+	if auth == "" {
+		return e.challenge(response, false, "authorization required")
+	}
+	params, ok := parseAuthorization(auth)
+	if !ok {
+		return e.challenge(response, false, "invalid authorization header")
+	}
+
+	algorithm := params["algorithm"]
+	if algorithm == "" {
+		algorithm = AlgorithmMD5
+	}
+	h, ok := hashes[algorithm]
+	if !ok || !contains(e.algorithms, algorithm) {
+		return e.challenge(response, false, "unsupported algorithm")
+	}
+	if params["realm"] != e.realm || params["qop"] != "auth" || !matchURI(params["uri"], request) {
+		return e.challenge(response, false, "invalid authorization parameters")
+	}
+	password, ok := e.users[params["username"]]
+	if !ok {
+		return e.challenge(response, false, "invalid credentials")
+	}
+
+	ha1 := digest(h, params["username"], e.realm, password)
+	ha2 := digest(h, request.Method, params["uri"])
+	expected := digest(h, ha1, params["nonce"], params["nc"], params["cnonce"], params["qop"], ha2)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(params["response"]))) != 1 {
+		return e.challenge(response, false, "invalid credentials")
+	}
+
+	nc, err := strconv.ParseUint(params["nc"], 16, 64)
+	if err != nil {
+		return e.challenge(response, false, "invalid nonce count")
+	}
+	switch e.nonces.use(params["nonce"], nc) {
+	case nonceExpired, nonceUnknown:
+		// 摘要正确但nonce无效, 客户端可以直接用新的nonce重试
+		return e.challenge(response, true, "nonce expired")
+	case nonceReplayed:
+		return e.challenge(response, false, "nonce count replayed")
+	}
+
+	if request.Private == nil {
+		request.Private = map[string]interface{}{}
+	}
+	request.Private[UsernameKey] = params["username"]
+	return nil
+}
+
+func (e *Plugin) Priority() int {
+	return e.index
+}
+
+// challenge 设置认证质询并返回认证失败的错误.
+func (e *Plugin) challenge(response *proxy.Response, stale bool, msg string) error {
+	nonce, err := e.nonces.issue()
+	if err != nil {
+		return vicg.WrapPluginError(err, http.StatusInternalServerError, ErrCodeUnauthorized, proxy.ViidStatusOtherError)
+	}
+	values := make([]string, len(e.algorithms))
+	for i, a := range e.algorithms {
+		v := fmt.Sprintf(`Digest realm="%s", qop="auth", nonce="%s", algorithm=%s`, e.realm, nonce, a)
+		if stale {
+			v += ", stale=true"
+		}
+		values[i] = v
+	}
+	if response.Metadata.Headers == nil {
+		response.Metadata.Headers = map[string][]string{}
+	}
+	response.Metadata.Headers["WWW-Authenticate"] = values
+	return vicg.NewPluginError(http.StatusUnauthorized, ErrCodeUnauthorized, proxy.ViidStatusInvalidOperation, msg)
+}
+
+// matchURI 摘要中的uri必须与请求的URI一致.
+func matchURI(uri string, request *proxy.Request) bool {
+	if request.URL != nil {
+		return uri == request.URL.RequestURI() || uri == request.URL.Path
+	}
+	return uri == request.Path
+}
+
+func digest(h func() hash.Hash, parts ...string) string {
+	d := h()
+	d.Write([]byte(strings.Join(parts, ":")))
+	return hex.EncodeToString(d.Sum(nil))
+}
+
+// parseAuthorization 解析Authorization: Digest k1="v1", k2=v2.
+func parseAuthorization(s string) (map[string]string, bool) {
+	const prefix = "Digest "
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return nil, false
+	}
+	s = s[len(prefix):]
+	params := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			break
+		}
+		eq := strings.Index(s, "=")
+		if eq <= 0 {
+			return nil, false
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end == -1 {
+				return nil, false
+			}
+			value, s = s[1:end+1], s[end+2:]
+		} else {
+			end := strings.Index(s, ",")
+			if end == -1 {
+				end = len(s)
+			}
+			value, s = strings.TrimSpace(s[:end]), s[end:]
+		}
+		params[key] = value
+	}
+	for _, k := range []string{"username", "realm", "nonce", "uri", "response"} {
+		if params[k] == "" {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+/* ************************** nonce管理 ******************** */
+
+const (
+	nonceOK = iota
+	nonceUnknown
+	nonceExpired
+	nonceReplayed
+)
+
+type nonceState struct {
+	expires time.Time
+	nc      uint64
+}
+
+// nonceSize nonce的字节数: 8字节签发时间, 8字节随机数, 以及前两者的HMAC-SHA256.
+const nonceSize = 16 + sha256.Size
+
+// nonceStore 签发和校验nonce.
+// nonce自带签发时间和签名, 校验时不需要查表; 只有通过了摘要认证的nonce才会被记录,
+// 用于检查nonce计数防止重放, 过期的记录每个有效期清理一次.
+type nonceStore struct {
+	key    []byte
+	expiry time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	used      map[string]*nonceState
+	lastSweep time.Time
+}
+
+func newNonceStore(expiry time.Duration) (*nonceStore, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &nonceStore{key: key, expiry: expiry, now: time.Now, used: map[string]*nonceState{}}, nil
+}
+
+// issue 签发新的nonce.
+func (s *nonceStore) issue() (string, error) {
+	b := make([]byte, 16, nonceSize)
+	binary.BigEndian.PutUint64(b, uint64(s.now().UnixNano()))
+	if _, err := rand.Read(b[8:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(append(b, s.sign(b)...)), nil
+}
+
+func (s *nonceStore) sign(b []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(b)
+	return mac.Sum(nil)
+}
+
+// use 使用nonce, nonce计数必须严格递增.
+func (s *nonceStore) use(nonce string, nc uint64) int {
+	b, err := hex.DecodeString(nonce)
+	if err != nil || len(b) != nonceSize || !hmac.Equal(b[16:], s.sign(b[:16])) {
+		return nonceUnknown
+	}
+	now := s.now()
+	expires := time.Unix(0, int64(binary.BigEndian.Uint64(b))).Add(s.expiry)
+	if now.After(expires) {
+		return nonceExpired
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > s.expiry {
+		for k, v := range s.used {
+			if now.After(v.expires) {
+				delete(s.used, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	state, ok := s.used[nonce]
+	if !ok {
+		state = &nonceState{expires: expires}
+		s.used[nonce] = state
+	}
+	if nc <= state.nc {
+		return nonceReplayed
+	}
+	state.nc = nc
+	return nonceOK
+}
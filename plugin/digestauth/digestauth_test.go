@@ -0,0 +1,187 @@
+package digestauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/vicg"
+)
+
+func newTestPlugin(t *testing.T, raw map[string]interface{}) *Plugin {
+	t.Helper()
+	c := Factory{}.NewConfig()
+	if errs := vicg.DecodePluginConfig(raw, c); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	p, err := Factory{}.New(&config.PluginConfig{Name: "DigestAuth", Index: 1, Parsed: c}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*Plugin)
+}
+
+// challengeNonce 从质询中取出nonce.
+func challengeNonce(t *testing.T, response *proxy.Response) string {
+	t.Helper()
+	h := response.Metadata.Headers["WWW-Authenticate"]
+	if len(h) == 0 {
+		t.Fatal("no challenge")
+	}
+	params, _ := parseAuthorization(h[0] + `, username="x", uri="x", response="x"`)
+	return params["nonce"]
+}
+
+func authorization(h func() hash.Hash, algorithm, user, password, nonce, nc, uri string) string {
+	ha1 := digest(h, user, DefaultRealm, password)
+	ha2 := digest(h, "POST", uri)
+	resp := digest(h, ha1, nonce, nc, "abc", "auth", ha2)
+	return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, qop=auth, nc=%s, cnonce="abc", response="%s"`,
+		user, DefaultRealm, nonce, uri, algorithm, nc, resp)
+}
+
+func handle(p *Plugin, auth string) (*proxy.Request, *proxy.Response, error) {
+	u, _ := url.Parse("/VIID/System/Register?x=1")
+	request := &proxy.Request{Method: "POST", URL: u, Path: u.Path, Headers: map[string][]string{}}
+	if auth != "" {
+		request.Headers["Authorization"] = []string{auth}
+	}
+	response := &proxy.Response{}
+	return request, response, p.HandleHTTPMessage(context.Background(), request, response)
+}
+
+func TestPlugin(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "users.json")
+	if err := os.WriteFile(file, []byte(`{"Users":{"device":"secret"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPlugin(t, map[string]interface{}{
+		"Algorithms":      []interface{}{AlgorithmSHA256, AlgorithmMD5},
+		"CredentialsFile": file,
+	})
+
+	_, response, err := handle(p, "")
+	var pe *vicg.PluginError
+	if !errors.As(err, &pe) || pe.StatusCode() != 401 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h := response.Metadata.Headers["WWW-Authenticate"]; len(h) != 2 || !strings.Contains(h[0], "algorithm=SHA-256") {
+		t.Errorf("unexpected challenge: %v", h)
+	}
+	nonce := challengeNonce(t, response)
+
+	for _, a := range []string{AlgorithmMD5, AlgorithmSHA256} {
+		nc := "00000001"
+		if a == AlgorithmSHA256 {
+			nc = "00000002"
+		}
+		request, _, err := handle(p, authorization(hashes[a], a, "device", "secret", nonce, nc, "/VIID/System/Register?x=1"))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", a, err)
+			continue
+		}
+		if request.Private[UsernameKey] != "device" {
+			t.Errorf("%s: unexpected private data: %v", a, request.Private)
+		}
+	}
+
+	for name, auth := range map[string]string{
+		"replay":    authorization(hashes[AlgorithmMD5], AlgorithmMD5, "device", "secret", nonce, "00000002", "/VIID/System/Register?x=1"),
+		"password":  authorization(hashes[AlgorithmMD5], AlgorithmMD5, "device", "wrong", nonce, "00000003", "/VIID/System/Register?x=1"),
+		"user":      authorization(hashes[AlgorithmMD5], AlgorithmMD5, "other", "secret", nonce, "00000003", "/VIID/System/Register?x=1"),
+		"uri":       authorization(hashes[AlgorithmMD5], AlgorithmMD5, "device", "secret", nonce, "00000003", "/VIID/Faces"),
+		"malformed": `Digest username="device`,
+	} {
+		if _, _, err := handle(p, auth); err == nil {
+			t.Errorf("%s: expecting an error", name)
+		}
+	}
+}
+
+func TestPlugin_nonceExpiry(t *testing.T) {
+	p := newTestPlugin(t, map[string]interface{}{
+		"Users":       map[string]interface{}{"device": "secret"},
+		"NonceExpiry": "1ms",
+	})
+	_, response, _ := handle(p, "")
+	nonce := challengeNonce(t, response)
+	time.Sleep(5 * time.Millisecond)
+
+	_, response, err := handle(p, authorization(hashes[AlgorithmMD5], AlgorithmMD5, "device", "secret", nonce, "00000001", "/VIID/System/Register"))
+	if err == nil {
+		t.Fatal("expecting an error")
+	}
+	if h := response.Metadata.Headers["WWW-Authenticate"]; len(h) != 1 || !strings.HasSuffix(h[0], "stale=true") {
+		t.Errorf("unexpected challenge: %v", h)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	for _, raw := range []map[string]interface{}{
+		{},
+		{"Users": map[string]interface{}{"a": "b"}, "Algorithms": []interface{}{"SHA-1"}},
+		{"Users": map[string]interface{}{"a": "b"}, "NonceExpiry": "soon"},
+	} {
+		if errs := vicg.DecodePluginConfig(raw, Factory{}.NewConfig()); len(errs) == 0 {
+			t.Errorf("%v: expecting an error", raw)
+		}
+	}
+}
+
+func TestNonceStore(t *testing.T) {
+	s, err := newNonceStore(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	nonce, err := s.issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.used) != 0 {
+		t.Error("issuing a nonce should not store it")
+	}
+	forged := []byte(nonce)
+	forged[0] ^= 1
+	for name, tc := range map[string]struct {
+		nonce string
+		nc    uint64
+		want  int
+	}{
+		"forged":    {nonce: string(forged), nc: 1, want: nonceUnknown},
+		"malformed": {nonce: "abc", nc: 1, want: nonceUnknown},
+	} {
+		if have := s.use(tc.nonce, tc.nc); have != tc.want {
+			t.Errorf("%s: unexpected result. have: %d, want: %d", name, have, tc.want)
+		}
+	}
+	if have := s.use(nonce, 1); have != nonceOK {
+		t.Errorf("unexpected result: %d", have)
+	}
+	if have := s.use(nonce, 1); have != nonceReplayed {
+		t.Errorf("unexpected result: %d", have)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if have := s.use(nonce, 2); have != nonceExpired {
+		t.Errorf("unexpected result: %d", have)
+	}
+	fresh, _ := s.issue()
+	if have := s.use(fresh, 1); have != nonceOK {
+		t.Errorf("unexpected result: %d", have)
+	}
+	if len(s.used) != 1 {
+		t.Errorf("the expired nonces were not swept: %d", len(s.used))
+	}
+}
@@ -3,41 +3,250 @@ package identifycheck
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
 	"github.com/luraproject/lura/v2/proxy"
 	"github.com/luraproject/lura/v2/vicg"
 )
 
 /* ************************** 校验请求者身份插件 ******************** */
 
+// 身份校验失败的错误码.
+const (
+	// ErrCodeIdentifyCheckFailed 身份标识格式错误
+	ErrCodeIdentifyCheckFailed = "IDENTIFY_CHECK_FAILED"
+	// ErrCodeIdentifyDenied 身份标识格式正确, 但不允许访问
+	ErrCodeIdentifyDenied = "IDENTIFY_DENIED"
+)
+
+// DeviceKey 解析得到的设备信息在Request.Private中的键, 值为*Device.
+const DeviceKey = "IdentifyCheck.Device"
+
+// DefaultLength 身份标识的默认长度.
+const DefaultLength = 20
+
+// DefaultReloadInterval 设备注册表文件变化的默认检查间隔.
+const DefaultReloadInterval = 3 * time.Second
+
+// GA/T 1400 身份标识的结构: 8位行政区划及基层单位代码, 2位行业代码, 3位类型代码, 7位序号.
+const (
+	regionLength   = 8
+	industryLength = 2
+	typeCodeLength = 3
+)
+
+// Config 插件配置.
+type Config struct {
+	// Length 身份标识的长度
+	Length int `json:"Length" validate:"min=1"`
+	// Structure 是否按照GA/T 1400的结构校验身份标识, 此时长度必须为20且全部为数字. 默认为true
+	Structure bool `json:"Structure"`
+	// Regions 允许的行政区划代码前缀, 为空时不限制
+	Regions []string `json:"Regions"`
+	// TypeCodes 允许的3位类型代码, 为空时不限制
+	TypeCodes []string `json:"TypeCodes"`
+	// Allow 允许访问的身份标识, 为空时不限制
+	Allow []string `json:"Allow"`
+	// Deny 禁止访问的身份标识
+	Deny []string `json:"Deny"`
+	// Registry 设备注册表文件, 配置后只允许注册表中的设备访问
+	Registry string `json:"Registry"`
+	// ReloadInterval 检查注册表文件变化的间隔, 如"10s"
+	ReloadInterval string `json:"ReloadInterval"`
+}
+
+// Validate 实现配置的额外校验.
+func (c *Config) Validate() error {
+	if (len(c.Regions) > 0 || len(c.TypeCodes) > 0) && !c.Structure {
+		return fmt.Errorf("'Regions' and 'TypeCodes' require 'Structure'")
+	}
+	if c.Structure && c.Length != DefaultLength {
+		return fmt.Errorf("'Structure' requires 'Length' to be %d", DefaultLength)
+	}
+	for _, t := range c.TypeCodes {
+		if len(t) != typeCodeLength || !isDigits(t) {
+			return fmt.Errorf("field 'TypeCodes': invalid type code '%s'", t)
+		}
+	}
+	if c.ReloadInterval != "" {
+		if _, err := time.ParseDuration(c.ReloadInterval); err != nil {
+			return fmt.Errorf("field 'ReloadInterval': %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// Device 身份标识对应的设备信息.
+type Device struct {
+	// ID 身份标识
+	ID string `json:"ID"`
+	// Region 行政区划及基层单位代码, 只在按结构校验时填充
+	Region string `json:"-"`
+	// TypeCode 类型代码, 只在按结构校验时填充
+	TypeCode string `json:"-"`
+	// Name 设备名称, 来自注册表
+	Name string `json:"Name"`
+	// Extra 注册表中设备的其他信息
+	Extra map[string]interface{} `json:"Extra"`
+}
+
 type Factory struct {
+	// Logger 记录注册表重新加载的情况, 可以为nil
+	Logger logging.Logger
 }
 
 // Plugin defines
 type Plugin struct {
-	name  string
-	index int
-	infra interface{}
+	name     string
+	index    int
+	infra    interface{}
+	cfg      *Config
+	allow    map[string]struct{}
+	deny     map[string]struct{}
+	registry *registry
+}
+
+// RequestHeaders 实现vicg.HeadersFactory接口.
+func (e Factory) RequestHeaders() []string {
+	return []string{"User-Identify"}
+}
+
+// NewConfig 实现vicg.ConfigurableFactory接口.
+func (e Factory) NewConfig() interface{} {
+	return &Config{Length: DefaultLength, Structure: true}
 }
 
 func (e Factory) New(cfg *config.PluginConfig, infra interface{}) (vicg.VicgPlugin, error) {
-	return &Plugin{
+	c, ok := cfg.Parsed.(*Config)
+	if !ok {
+		c = e.NewConfig().(*Config)
+	}
+	p := &Plugin{
 		index: cfg.Index,
 		name:  cfg.Name,
 		infra: infra,
-	}, nil
+		cfg:   c,
+		allow: toSet(c.Allow),
+		deny:  toSet(c.Deny),
+	}
+	if c.Registry != "" {
+		interval := DefaultReloadInterval
+		if c.ReloadInterval != "" {
+			interval, _ = time.ParseDuration(c.ReloadInterval)
+		}
+		logger := e.Logger
+		if logger == nil {
+			logger = logging.NoOp
+		}
+		r, err := newRegistry(c.Registry, interval, logger)
+		if err != nil {
+			return nil, err
+		}
+		p.registry = r
+	}
+	return p, nil
 }
 
 func (e *Plugin) HandleHTTPMessage(ctx context.Context, request *proxy.Request, response *proxy.Response) error {
 	identify := request.HeaderGet("User-Identify")
-	if len(identify) != 20 {
-		return fmt.Errorf("identify check failed")
+	device, err := e.check(identify)
+	if err != nil {
+		return err
 	}
-
+	if request.Private == nil {
+		request.Private = map[string]interface{}{}
+	}
+	request.Private[DeviceKey] = device
 	return nil
 }
 
+// check 校验身份标识, 返回对应的设备信息.
+func (e *Plugin) check(identify string) (*Device, error) {
+	if len(identify) != e.cfg.Length {
+		return nil, checkFailed("identify check failed")
+	}
+	device := &Device{ID: identify}
+	if e.cfg.Structure {
+		if !isDigits(identify) {
+			return nil, checkFailed("identify check failed: not all digits")
+		}
+		device.Region = identify[:regionLength]
+		device.TypeCode = identify[regionLength+industryLength : regionLength+industryLength+typeCodeLength]
+		if len(e.cfg.Regions) > 0 && !hasAnyPrefix(device.Region, e.cfg.Regions) {
+			return nil, denied("the region '%s' is not allowed", device.Region)
+		}
+		if len(e.cfg.TypeCodes) > 0 && !contains(e.cfg.TypeCodes, device.TypeCode) {
+			return nil, denied("the type code '%s' is not allowed", device.TypeCode)
+		}
+	}
+	if _, ok := e.deny[identify]; ok {
+		return nil, denied("the identify '%s' is denied", identify)
+	}
+	if len(e.allow) > 0 {
+		if _, ok := e.allow[identify]; !ok {
+			return nil, denied("the identify '%s' is not allowed", identify)
+		}
+	}
+	if e.registry != nil {
+		d, ok := e.registry.lookup(identify)
+		if !ok {
+			return nil, denied("the identify '%s' is not registered", identify)
+		}
+		device.Name = d.Name
+		if d.Extra != nil {
+			device.Extra = vicg.DeepCopy(d.Extra).(map[string]interface{})
+		}
+	}
+	return device, nil
+}
+
 func (e *Plugin) Priority() int {
 	return e.index
 }
+
+func checkFailed(msg string) error {
+	return vicg.NewPluginError(http.StatusUnauthorized, ErrCodeIdentifyCheckFailed, proxy.ViidStatusInvalidOperation, msg)
+}
+
+func denied(format string, a ...interface{}) error {
+	return vicg.NewPluginError(http.StatusForbidden, ErrCodeIdentifyDenied, proxy.ViidStatusInvalidOperation, fmt.Sprintf(format, a...))
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func toSet(list []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(list))
+	for _, v := range list {
+		set[v] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,153 @@
+package identifycheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/vicg"
+)
+
+func newTestPlugin(t *testing.T, raw map[string]interface{}) *Plugin {
+	t.Helper()
+	c := Factory{}.NewConfig()
+	if errs := vicg.DecodePluginConfig(raw, c); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	p, err := Factory{}.New(&config.PluginConfig{Name: "IdentifyCheck", Index: 1, Parsed: c}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*Plugin)
+}
+
+func handle(p *Plugin, identify string) (*proxy.Request, int, error) {
+	request := &proxy.Request{Headers: map[string][]string{"User-Identify": {identify}}}
+	err := p.HandleHTTPMessage(context.Background(), request, &proxy.Response{})
+	var pe *vicg.PluginError
+	if errors.As(err, &pe) {
+		return request, pe.StatusCode(), err
+	}
+	return request, 0, err
+}
+
+func TestPlugin_structure(t *testing.T) {
+	p := newTestPlugin(t, map[string]interface{}{
+		"Structure": true,
+		"Regions":   []interface{}{"3101"},
+		"TypeCodes": []interface{}{"119", "120"},
+		"Deny":      []interface{}{"31010000001190000002"},
+	})
+
+	for identify, status := range map[string]int{
+		"31010000001190000001": 0,
+		"3101000000119000000a": http.StatusUnauthorized,
+		"3101000000119000001":  http.StatusUnauthorized,
+		"32010000001190000001": http.StatusForbidden,
+		"31010000001210000001": http.StatusForbidden,
+		"31010000001190000002": http.StatusForbidden,
+	} {
+		if _, have, _ := handle(p, identify); have != status {
+			t.Errorf("%s: unexpected status code. have: %d, want: %d", identify, have, status)
+		}
+	}
+
+	request, _, _ := handle(p, "31010000001200000001")
+	d, ok := request.Private[DeviceKey].(*Device)
+	if !ok || d.Region != "31010000" || d.TypeCode != "120" {
+		t.Errorf("unexpected device: %+v", request.Private)
+	}
+}
+
+func TestPlugin_registry(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "devices.json")
+	write := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"Devices":[{"ID":"31010000001190000001","Name":"gate"}]}`)
+
+	p := newTestPlugin(t, map[string]interface{}{"Registry": file, "ReloadInterval": "1ms"})
+	request, status, _ := handle(p, "31010000001190000001")
+	if d, ok := request.Private[DeviceKey].(*Device); status != 0 || !ok || d.Name != "gate" {
+		t.Errorf("unexpected device: %+v", request.Private)
+	}
+	if _, status, _ := handle(p, "31010000001190000002"); status != http.StatusForbidden {
+		t.Errorf("unexpected status code: %d", status)
+	}
+
+	// 损坏的文件不影响原有的注册表
+	write(`{"Devices":[`)
+	time.Sleep(5 * time.Millisecond)
+	if _, status, _ := handle(p, "31010000001190000001"); status != 0 {
+		t.Errorf("unexpected status code: %d", status)
+	}
+
+	write(`{"Devices":[{"ID":"31010000001190000002","Name":"door"}]}`)
+	time.Sleep(5 * time.Millisecond)
+	if _, status, _ := handle(p, "31010000001190000002"); status != 0 {
+		t.Errorf("unexpected status code: %d", status)
+	}
+	if _, status, _ := handle(p, "31010000001190000001"); status != http.StatusForbidden {
+		t.Errorf("unexpected status code: %d", status)
+	}
+}
+
+func TestPlugin_registryEntries(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "devices.json")
+	content := `{"Devices":[null,{"Name":"no id"},{"ID":"31010000001190000001","Extra":{"Tags":["gate"]}}]}`
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPlugin(t, map[string]interface{}{"Registry": file})
+
+	request, status, _ := handle(p, "31010000001190000001")
+	d, ok := request.Private[DeviceKey].(*Device)
+	if status != 0 || !ok {
+		t.Fatalf("unexpected device: %+v", request.Private)
+	}
+	d.Extra["Tags"].([]interface{})[0] = "door"
+	d.Extra["Owner"] = "x"
+
+	request, _, _ = handle(p, "31010000001190000001")
+	if d := request.Private[DeviceKey].(*Device); len(d.Extra) != 1 || d.Extra["Tags"].([]interface{})[0] != "gate" {
+		t.Errorf("the registry was modified through a request: %+v", d.Extra)
+	}
+}
+
+func TestFactory_NewConfig(t *testing.T) {
+	c := Factory{}.NewConfig().(*Config)
+	if !c.Structure || c.Length != DefaultLength {
+		t.Errorf("unexpected default config: %+v", c)
+	}
+	// 默认按结构校验
+	p := newTestPlugin(t, map[string]interface{}{})
+	if _, status, _ := handle(p, "3101000000119000000a"); status != http.StatusUnauthorized {
+		t.Errorf("unexpected status code: %d", status)
+	}
+	p = newTestPlugin(t, map[string]interface{}{"Structure": false})
+	if _, status, _ := handle(p, "3101000000119000000a"); status != 0 {
+		t.Errorf("unexpected status code: %d", status)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	for _, raw := range []map[string]interface{}{
+		{"Regions": []interface{}{"3101"}, "Structure": false},
+		{"Length": 18},
+		{"Structure": true, "Length": 18},
+		{"Structure": true, "TypeCodes": []interface{}{"1a9"}},
+		{"ReloadInterval": "soon"},
+	} {
+		if errs := vicg.DecodePluginConfig(raw, Factory{}.NewConfig()); len(errs) == 0 {
+			t.Errorf("%v: expecting an error", raw)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package identifycheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/luraproject/lura/v2/logging"
+)
+
+/* ************************** 设备注册表 ******************** */
+
+// registryFile 注册表文件的格式.
+type registryFile struct {
+	Devices []*Device `json:"Devices"`
+}
+
+// registry 本地设备注册表, 查询时按间隔检查文件是否变化并重新加载.
+// 重新加载失败时继续使用原有的注册表.
+type registry struct {
+	file     string
+	interval time.Duration
+	logger   logging.Logger
+
+	mu      sync.RWMutex
+	devices map[string]*Device
+	modTime time.Time
+	size    int64
+	checked time.Time
+}
+
+func newRegistry(file string, interval time.Duration, logger logging.Logger) (*registry, error) {
+	r := &registry{file: file, interval: interval, logger: logger}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// lookup 查询设备.
+func (r *registry) lookup(id string) (*Device, bool) {
+	r.mu.RLock()
+	stale := time.Since(r.checked) >= r.interval
+	r.mu.RUnlock()
+	if stale {
+		r.refresh()
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	d, ok := r.devices[id]
+	return d, ok
+}
+
+// refresh 文件发生变化时重新加载.
+func (r *registry) refresh() {
+	r.mu.Lock()
+	if time.Since(r.checked) < r.interval {
+		r.mu.Unlock()
+		return
+	}
+	r.checked = time.Now()
+	r.mu.Unlock()
+
+	info, err := os.Stat(r.file)
+	if err != nil {
+		r.logger.Warning("[IdentifyCheck] Keeping the device registry:", err.Error())
+		return
+	}
+	r.mu.RLock()
+	changed := !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+	r.mu.RUnlock()
+	if !changed {
+		return
+	}
+	if err := r.load(); err != nil {
+		r.logger.Warning("[IdentifyCheck] Keeping the device registry:", err.Error())
+		return
+	}
+	r.logger.Info("[IdentifyCheck] Device registry reloaded from", r.file)
+}
+
+// load 读取注册表文件.
+func (r *registry) load() error {
+	info, err := os.Stat(r.file)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(r.file)
+	if err != nil {
+		return err
+	}
+	f := registryFile{}
+	if err = json.Unmarshal(b, &f); err != nil {
+		return fmt.Errorf("the device registry '%s': %s", r.file, err.Error())
+	}
+	devices := make(map[string]*Device, len(f.Devices))
+	for i, d := range f.Devices {
+		if d == nil || d.ID == "" {
+			r.logger.Warning(fmt.Sprintf("[IdentifyCheck] Skipping the device #%d without an ID in %s", i, r.file))
+			continue
+		}
+		devices[d.ID] = d
+	}
+
+	r.mu.Lock()
+	r.devices = devices
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+	r.checked = time.Now()
+	r.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,174 @@
+package imageoffload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/vicg"
+	"github.com/luraproject/lura/v2/vicg/blob"
+)
+
+/* ***************************************************************************
+* 图片卸载插件
+* 	将Request.Data中base64编码的图片写入存储, 只在报文中保留图片的地址, 减小后续插件和后端
+* 	处理的报文. 插件本身并不节省内存: 报文已经被完整读取和解析, 每张图片还要完整解码一次后
+* 	才能写入存储, 卸载期间的内存占用反而高于原报文. 图片逐张解码, 写入存储后即可释放.
+*************************************************************************** */
+
+// 插件的错误码.
+const (
+	// ErrCodeInvalidImage 图片数据不是有效的base64
+	ErrCodeInvalidImage = "INVALID_IMAGE_DATA"
+	// ErrCodeStoreFailed 图片写入存储失败
+	ErrCodeStoreFailed = "IMAGE_STORE_FAILED"
+)
+
+// 图片对象的字段.
+const (
+	subImageListKey = "SubImageList"
+	subImageInfoKey = "SubImageInfoObject"
+	dataKey         = "Data"
+	storagePathKey  = "StoragePath"
+)
+
+// Config 插件配置.
+type Config struct {
+	// Dir 本地存储的目录, Factory未指定Store时必须配置
+	Dir string `json:"Dir"`
+	// BaseURL 访问图片的地址前缀, 为空时报文中只保留存储键
+	BaseURL string `json:"BaseURL"`
+}
+
+// Factory 插件工厂. Store为空时使用配置的本地目录.
+type Factory struct {
+	Store blob.Store
+}
+
+// Plugin defines
+type Plugin struct {
+	name  string
+	index int
+	store blob.Store
+	now   func() time.Time
+}
+
+// NewConfig 实现vicg.ConfigurableFactory接口.
+func (e Factory) NewConfig() interface{} {
+	return &Config{}
+}
+
+func (e Factory) New(cfg *config.PluginConfig, infra interface{}) (vicg.VicgPlugin, error) {
+	store := e.Store
+	if store == nil {
+		c, ok := cfg.Parsed.(*Config)
+		if !ok || c.Dir == "" {
+			return nil, fmt.Errorf("the plugin '%s' requires a blob store or 'Dir'", cfg.Name)
+		}
+		local, err := blob.NewLocalStore(c.Dir, c.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		store = local
+	}
+	return &Plugin{
+		name:  cfg.Name,
+		index: cfg.Index,
+		store: store,
+		now:   time.Now,
+	}, nil
+}
+
+// HandleHTTPMessage 将对象中base64编码的图片写入存储, 并用StoragePath替换Data.
+// 有图片被卸载时, 请求报文按照卸载后的Request.Data重新编码, 原报文的结构保持不变.
+func (e *Plugin) HandleHTTPMessage(ctx context.Context, request *proxy.Request, response *proxy.Response) error {
+	offloaded := 0
+	for dataType, objects := range request.Data {
+		for _, o := range objects {
+			images := subImages(o)
+			if dataType == "Image" {
+				images = append(images, o)
+			}
+			for _, image := range images {
+				ok, err := e.offload(ctx, image)
+				if err != nil {
+					return err
+				}
+				if ok {
+					offloaded++
+				}
+			}
+		}
+	}
+	if offloaded == 0 {
+		return nil
+	}
+
+	return vicg.EncodeRequest(request)
+}
+
+func (e *Plugin) Priority() int {
+	return e.index
+}
+
+// offload 卸载单个图片, 没有图片数据时返回false.
+func (e *Plugin) offload(ctx context.Context, image map[string]interface{}) (bool, error) {
+	encoded, ok := image[dataKey].(string)
+	if !ok || encoded == "" {
+		return false, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false, vicg.WrapPluginError(err, http.StatusBadRequest, ErrCodeInvalidImage, proxy.ViidStatusInvalidJSONContent)
+	}
+	location, err := e.store.Put(ctx, e.key(image, data), data)
+	if err != nil {
+		return false, vicg.WrapPluginError(err, http.StatusInternalServerError, ErrCodeStoreFailed, proxy.ViidStatusDeviceError)
+	}
+	delete(image, dataKey)
+	image[storagePathKey] = location
+	return true, nil
+}
+
+// key 生成存储键: 日期/图片编号-数据摘要.格式, 没有图片编号时只使用数据的摘要.
+// 图片编号由设备填写, 加上摘要后不同设备的同名图片不会互相覆盖.
+func (e *Plugin) key(image map[string]interface{}, data []byte) string {
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:])
+	if imageID, _ := image["ImageID"].(string); imageID != "" && !strings.ContainsAny(imageID, `/\.`) {
+		id = imageID + "-" + id
+	}
+	format, _ := image["FileFormat"].(string)
+	format = strings.ToLower(format)
+	if format == "" || strings.ContainsAny(format, `/\.`) {
+		format = "jpeg"
+	}
+	return path.Join(e.now().Format("20060102"), id+"."+format)
+}
+
+// subImages 返回对象的SubImageList中的图片.
+func subImages(o map[string]interface{}) []map[string]interface{} {
+	list, ok := o[subImageListKey].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	items, ok := list[subImageInfoKey].([]interface{})
+	if !ok {
+		return nil
+	}
+	images := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if image, ok := item.(map[string]interface{}); ok {
+			images = append(images, image)
+		}
+	}
+	return images
+}
@@ -0,0 +1,125 @@
+package imageoffload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/vicg"
+)
+
+func TestPlugin(t *testing.T) {
+	dir := t.TempDir()
+	p, err := Factory{}.New(&config.PluginConfig{Name: "ImageOffload", Parsed: &Config{Dir: dir, BaseURL: "http://images"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.(*Plugin).now = func() time.Time { return time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local) }
+
+	data, err := vicg.DecodeViidObjects([]byte(`{"FaceListObject":{"FaceObject":[{"FaceID":"f1","SubImageList":{"SubImageInfoObject":[
+		{"ImageID":"i1","FileFormat":"Jpeg","Data":"` + base64.StdEncoding.EncodeToString([]byte("face")) + `"},
+		{"ImageID":"i2","StoragePath":"http://elsewhere/i2.jpeg"}
+	]}}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &proxy.Request{Data: data}
+	if err = p.HandleHTTPMessage(context.Background(), request, &proxy.Response{}); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte("face"))
+	name := "i1-" + hex.EncodeToString(sum[:]) + ".jpeg"
+	b, err := os.ReadFile(filepath.Join(dir, "20210601", name))
+	if err != nil || string(b) != "face" {
+		t.Errorf("unexpected image: %s %v", b, err)
+	}
+	body, _ := io.ReadAll(request.Body)
+	if strings.Contains(string(body), `"Data"`) || !strings.Contains(string(body), `"StoragePath":"http://images/20210601/`+name+`"`) {
+		t.Errorf("unexpected body: %s", body)
+	}
+	if request.ContentLength != int64(len(body)) {
+		t.Errorf("unexpected content length: %d", request.ContentLength)
+	}
+
+	// 另一个设备使用相同的图片编号, 不覆盖已有的图片
+	request = &proxy.Request{Data: map[string][]map[string]interface{}{"Image": {{"ImageID": "i1", "FileFormat": "Jpeg", "Data": "b3RoZXI="}}}}
+	if err = p.HandleHTTPMessage(context.Background(), request, &proxy.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if location := request.Data["Image"][0]["StoragePath"]; location == "http://images/20210601/"+name {
+		t.Errorf("unexpected location: %v", location)
+	}
+	if b, _ = os.ReadFile(filepath.Join(dir, "20210601", name)); string(b) != "face" {
+		t.Errorf("the image should not be overwritten: %s", b)
+	}
+
+	request = &proxy.Request{Data: map[string][]map[string]interface{}{"Image": {{"Data": "not base64!"}}}}
+	err = p.HandleHTTPMessage(context.Background(), request, &proxy.Response{})
+	var pe *vicg.PluginError
+	if !errors.As(err, &pe) || pe.StatusCode() != http.StatusBadRequest || pe.Code != ErrCodeInvalidImage {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPlugin_envelope(t *testing.T) {
+	p, err := Factory{}.New(&config.PluginConfig{Name: "ImageOffload", Parsed: &Config{Dir: t.TempDir()}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.(*Plugin).now = func() time.Time { return time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local) }
+
+	payload := `{"ImageObject":{"ImageID":"i1","Data":"aW1hZ2U="},"DeviceID":"31000000001190000001"}`
+	data, err := vicg.DecodeViidObjects([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &proxy.Request{Data: data, Body: io.NopCloser(strings.NewReader(payload))}
+	if err = p.HandleHTTPMessage(context.Background(), request, &proxy.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("image"))
+	body, _ := io.ReadAll(request.Body)
+	if have, want := string(body), `{"DeviceID":"31000000001190000001","ImageObject":{"ImageID":"i1","StoragePath":"20210601/i1-`+hex.EncodeToString(sum[:])+`.jpeg"}}`; have != want {
+		t.Errorf("unexpected body. have: %s, want: %s", have, want)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Put(context.Context, string, []byte) (string, error) {
+	return "", errors.New("disk full")
+}
+
+func TestPlugin_storeFailed(t *testing.T) {
+	p, err := Factory{Store: failingStore{}}.New(&config.PluginConfig{Name: "ImageOffload"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &proxy.Request{Data: map[string][]map[string]interface{}{"Image": {{"Data": "aW1hZ2U="}}}}
+	err = p.HandleHTTPMessage(context.Background(), request, &proxy.Response{})
+	var pe *vicg.PluginError
+	if !errors.As(err, &pe) || pe.StatusCode() != http.StatusInternalServerError || pe.Code != ErrCodeStoreFailed {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if request.Body != nil {
+		t.Error("the body should not be rewritten")
+	}
+}
+
+func TestFactory_noStore(t *testing.T) {
+	if _, err := (Factory{}).New(&config.PluginConfig{Name: "ImageOffload", Parsed: &Config{}}, nil); err == nil {
+		t.Error("expecting an error")
+	}
+}
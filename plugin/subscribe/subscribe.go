@@ -0,0 +1,188 @@
+package subscribe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/vicg"
+	"github.com/luraproject/lura/v2/vicg/subscribe"
+)
+
+/* ************************** 订阅通知插件 ******************** */
+
+// 插件的动作.
+const (
+	// ActionCreate 订阅接口: 保存请求中的订阅对象, OperateType为取消订阅的对象取消其订阅
+	ActionCreate = "create"
+	// ActionCancel 取消订阅接口: 取消路径参数、IDList或请求对象中OperateType为取消订阅的订阅
+	ActionCancel = "cancel"
+	// ActionList 查询订阅接口: 返回所有的订阅
+	ActionList = "list"
+	// ActionNotify 数据接口: 将上传的对象通知给订阅者
+	ActionNotify = "notify"
+)
+
+// ErrCodeInvalidSubscription 订阅请求无效的错误码.
+const ErrCodeInvalidSubscription = "INVALID_SUBSCRIPTION"
+
+// dataType 订阅对象在Request.Data中的类型.
+const dataType = "Subscribe"
+
+// Config 插件配置.
+type Config struct {
+	// Action 插件的动作
+	Action string `json:"Action" validate:"oneof=create cancel list notify"`
+	// IDParam 取消订阅时携带订阅编号的路径参数
+	IDParam string `json:"IDParam"`
+}
+
+type Factory struct {
+}
+
+// Plugin defines
+type Plugin struct {
+	name          string
+	index         int
+	cfg           Config
+	subscriptions subscribe.Store
+	notifier      *subscribe.Dispatcher
+}
+
+// NewConfig 实现vicg.ConfigurableFactory接口.
+func (e Factory) NewConfig() interface{} {
+	return &Config{Action: ActionNotify, IDParam: "ID"}
+}
+
+func (e Factory) New(cfg *config.PluginConfig, infra interface{}) (vicg.VicgPlugin, error) {
+	i, ok := infra.(*vicg.Infra)
+	if !ok || i.Subscriptions == nil || i.Notifier == nil {
+		return nil, fmt.Errorf("the plugin '%s' requires the subscription store", cfg.Name)
+	}
+	c := Config{Action: ActionNotify, IDParam: "ID"}
+	if p, ok := cfg.Parsed.(*Config); ok {
+		c = *p
+	}
+	return &Plugin{
+		name:          cfg.Name,
+		index:         cfg.Index,
+		cfg:           c,
+		subscriptions: i.Subscriptions,
+		notifier:      i.Notifier,
+	}, nil
+}
+
+func (e *Plugin) HandleHTTPMessage(ctx context.Context, request *proxy.Request, response *proxy.Response) error {
+	switch e.cfg.Action {
+	case ActionCreate:
+		return e.create(request, response)
+	case ActionCancel:
+		return e.cancel(request, response)
+	case ActionList:
+		response.Data = map[string]interface{}{
+			"SubscribeListObject": map[string]interface{}{"SubscribeObject": e.subscriptions.List()},
+		}
+		return nil
+	default:
+		e.notifier.Dispatch(request.Data)
+		return nil
+	}
+}
+
+func (e *Plugin) Priority() int {
+	return e.index
+}
+
+// create 保存请求中的订阅对象, OperateType为取消订阅的对象取消其订阅.
+// 每个对象的结果记录在应答状态列表中.
+func (e *Plugin) create(request *proxy.Request, response *proxy.Response) error {
+	objects := request.Data[dataType]
+	if len(objects) == 0 {
+		return invalid("missing SubscribeObject")
+	}
+	for _, o := range objects {
+		s, err := decode(o)
+		if err == nil && s.OperateType == subscribe.OperateCancel {
+			response.AddResponseStatus(status(request.Path, s.SubscribeID, e.subscriptions.Cancel(s.SubscribeID)))
+			continue
+		}
+		if err == nil {
+			err = e.notifier.CheckReceiver(s.ReceiveAddr)
+		}
+		if err == nil {
+			err = e.subscriptions.Create(s)
+		}
+		response.AddResponseStatus(status(request.Path, s.SubscribeID, err))
+	}
+	return nil
+}
+
+// cancel 取消订阅, 每个订阅的结果记录在应答状态列表中.
+// 路径参数和IDList中的订阅直接取消; 请求对象中的订阅只有OperateType为取消订阅时才会取消.
+func (e *Plugin) cancel(request *proxy.Request, response *proxy.Response) error {
+	if ids := cancelIDs(request, e.cfg.IDParam); len(ids) > 0 {
+		for _, id := range ids {
+			response.AddResponseStatus(status(request.Path, id, e.subscriptions.Cancel(id)))
+		}
+		return nil
+	}
+	objects := request.Data[dataType]
+	if len(objects) == 0 {
+		return invalid("missing SubscribeID")
+	}
+	for _, o := range objects {
+		s, err := decode(o)
+		if err == nil && s.OperateType != subscribe.OperateCancel {
+			err = fmt.Errorf("the OperateType of the subscription '%s' is not %d", s.SubscribeID, subscribe.OperateCancel)
+		}
+		if err == nil {
+			err = e.subscriptions.Cancel(s.SubscribeID)
+		}
+		response.AddResponseStatus(status(request.Path, s.SubscribeID, err))
+	}
+	return nil
+}
+
+// cancelIDs 依次从路径参数和IDList查询参数中获取要取消的订阅编号.
+func cancelIDs(request *proxy.Request, param string) []string {
+	if param != "" {
+		if id := request.Params[strings.ToUpper(param[:1])+param[1:]]; id != "" {
+			return []string{id}
+		}
+	}
+	ids := []string{}
+	for _, id := range strings.Split(request.Query.Get("IDList"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func decode(o map[string]interface{}) (subscribe.Subscription, error) {
+	var s subscribe.Subscription
+	b, err := json.Marshal(o)
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(b, &s)
+	if id, ok := o["SubscribeID"].(string); ok {
+		s.SubscribeID = id
+	}
+	return s, err
+}
+
+func status(path, id string, err error) proxy.ResponseStatus {
+	if err != nil {
+		return proxy.NewResponseStatus(path, id, proxy.ViidStatusInvalidJSONContent, err.Error())
+	}
+	return proxy.NewResponseStatus(path, id, proxy.ViidStatusOK, "OK")
+}
+
+func invalid(msg string) error {
+	return vicg.NewPluginError(http.StatusBadRequest, ErrCodeInvalidSubscription, proxy.ViidStatusInvalidJSONContent, msg)
+}
@@ -0,0 +1,138 @@
+package subscribe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/vicg"
+	"github.com/luraproject/lura/v2/vicg/subscribe"
+)
+
+func TestPlugin(t *testing.T) {
+	store := subscribe.NewInMemoryStore()
+	infra := &vicg.Infra{
+		Subscriptions: store,
+		Notifier:      subscribe.NewDispatcher(store, subscribe.Config{}, logging.NoOp),
+	}
+	plugins := map[string]vicg.VicgPlugin{}
+	for _, action := range []string{ActionCreate, ActionCancel, ActionList} {
+		p, err := Factory{}.New(&config.PluginConfig{Name: "Subscribe", Parsed: &Config{Action: action, IDParam: "ID"}}, infra)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plugins[action] = p
+	}
+
+	response := &proxy.Response{}
+	err := plugins[ActionCreate].HandleHTTPMessage(context.Background(), &proxy.Request{
+		Path: "/VIID/Subscribes",
+		Data: map[string][]map[string]interface{}{"Subscribe": {
+			{"SubscribeID": "s1", "SubscribeDetail": "12", "ReceiveAddr": "http://receiver.example/notify"},
+			{"SubscribeID": "s2", "SubscribeDetail": "12"},
+			{"SubscribeID": "s3", "SubscribeDetail": "12", "ReceiveAddr": "http://169.254.169.254/latest"},
+		}},
+	}, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.StatusList) != 3 || response.StatusList[0].StatusCode != proxy.ViidStatusOK ||
+		response.StatusList[1].StatusCode != proxy.ViidStatusInvalidJSONContent ||
+		response.StatusList[2].StatusCode != proxy.ViidStatusInvalidJSONContent {
+		t.Errorf("unexpected status list: %+v", response.StatusList)
+	}
+
+	response = &proxy.Response{}
+	if err = plugins[ActionList].HandleHTTPMessage(context.Background(), &proxy.Request{}, response); err != nil {
+		t.Fatal(err)
+	}
+	list := response.Data["SubscribeListObject"].(map[string]interface{})["SubscribeObject"].([]subscribe.Subscription)
+	if len(list) != 1 || list[0].SubscribeID != "s1" {
+		t.Errorf("unexpected subscriptions: %+v", list)
+	}
+
+	response = &proxy.Response{}
+	err = plugins[ActionCancel].HandleHTTPMessage(context.Background(), &proxy.Request{
+		Query: url.Values{"IDList": {"s1,s3"}},
+	}, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.StatusList) != 2 || response.StatusList[0].StatusCode != proxy.ViidStatusOK ||
+		response.StatusList[1].StatusCode == proxy.ViidStatusOK {
+		t.Errorf("unexpected status list: %+v", response.StatusList)
+	}
+	if store.List()[0].SubscribeStatus != subscribe.StatusCancelled {
+		t.Errorf("the subscription was not cancelled: %+v", store.List())
+	}
+
+	err = plugins[ActionCancel].HandleHTTPMessage(context.Background(), &proxy.Request{}, &proxy.Response{})
+	var pe *vicg.PluginError
+	if !errors.As(err, &pe) || pe.StatusCode() != http.StatusBadRequest {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPlugin_operateType(t *testing.T) {
+	store := subscribe.NewInMemoryStore()
+	infra := &vicg.Infra{
+		Subscriptions: store,
+		Notifier:      subscribe.NewDispatcher(store, subscribe.Config{}, logging.NoOp),
+	}
+	create, err := Factory{}.New(&config.PluginConfig{Name: "Subscribe", Parsed: &Config{Action: ActionCreate}}, infra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel, err := Factory{}.New(&config.PluginConfig{Name: "Subscribe", Parsed: &Config{Action: ActionCancel}}, infra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscription := func(id, operateType string) map[string]interface{} {
+		return map[string]interface{}{"SubscribeID": id, "SubscribeDetail": "12", "ReceiveAddr": "http://receiver.example/notify", "OperateType": json.Number(operateType)}
+	}
+
+	err = create.HandleHTTPMessage(context.Background(), &proxy.Request{
+		Data: map[string][]map[string]interface{}{"Subscribe": {subscription("s1", "0"), subscription("s2", "0")}},
+	}, &proxy.Response{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 订阅接口中OperateType为1的对象取消订阅
+	response := &proxy.Response{}
+	err = create.HandleHTTPMessage(context.Background(), &proxy.Request{
+		Data: map[string][]map[string]interface{}{"Subscribe": {subscription("s1", "1")}},
+	}, response)
+	if err != nil || len(response.StatusList) != 1 || response.StatusList[0].StatusCode != proxy.ViidStatusOK {
+		t.Errorf("unexpected result: %v %+v", err, response.StatusList)
+	}
+
+	// 取消订阅接口只取消OperateType为1的对象
+	response = &proxy.Response{}
+	err = cancel.HandleHTTPMessage(context.Background(), &proxy.Request{
+		Data: map[string][]map[string]interface{}{"Subscribe": {subscription("s2", "0")}},
+	}, response)
+	if err != nil || len(response.StatusList) != 1 || response.StatusList[0].StatusCode == proxy.ViidStatusOK {
+		t.Errorf("unexpected result: %v %+v", err, response.StatusList)
+	}
+
+	status := map[string]int{}
+	for _, s := range store.List() {
+		status[s.SubscribeID] = s.SubscribeStatus
+	}
+	if status["s1"] != subscribe.StatusCancelled || status["s2"] != subscribe.StatusSubscribing {
+		t.Errorf("unexpected subscriptions: %v", status)
+	}
+}
+
+func TestFactory_noInfra(t *testing.T) {
+	if _, err := (Factory{}).New(&config.PluginConfig{Name: "Subscribe"}, nil); err == nil {
+		t.Error("expecting an error")
+	}
+}
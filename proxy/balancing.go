@@ -4,10 +4,13 @@ package proxy
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 
 	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
 	"github.com/luraproject/lura/v2/sd"
 )
 
@@ -47,16 +50,87 @@ func NewRandomLoadBalancedMiddlewareWithSubscriber(subscriber sd.Subscriber) Mid
 	return newLoadBalancedMiddleware(sd.NewRandomLB(subscriber))
 }
 
+// NewConfiguredLoadBalancedMiddleware 根据Backend的ExtraConfig中的负载均衡策略创建中间件,
+// 没有配置时与NewLoadBalancedMiddlewareWithSubscriber相同.
+// 配置了异常检测时, 连续返回5xx或连接失败的后端会被暂时移出均衡器, 异常检测在ctx结束时释放.
+func NewConfiguredLoadBalancedMiddleware(ctx context.Context, logger logging.Logger, remote *config.Backend, subscriber sd.Subscriber) Middleware {
+	var detector *sd.OutlierDetector
+	if cfg, err := sd.GetOutlierConfig(remote.ExtraConfig); err == nil {
+		logger.Debug(fmt.Sprintf("[BACKEND: %s][Outlier] Consecutive errors: %d, Base ejection time: %s, Max ejection percent: %d",
+			remote.URLPattern, cfg.ConsecutiveErrors, cfg.BaseEjectionTime, cfg.MaxEjectionPercent))
+		detector = sd.NewOutlierDetector(ctx, remote.URLPattern, subscriber, cfg, logger)
+		subscriber = detector
+	} else if err != sd.ErrNoOutlierConfig {
+		logger.Warning(fmt.Sprintf("[BACKEND: %s][Outlier] %s", remote.URLPattern, err.Error()))
+	}
+
+	cfg, err := sd.GetBalancerConfig(remote.ExtraConfig)
+	if err != nil {
+		if err != sd.ErrNoBalancerConfig {
+			logger.Warning(fmt.Sprintf("[BACKEND: %s][Balancer] %s", remote.URLPattern, err.Error()))
+		}
+		return newBalancedMiddleware(balancerHostSelector(sd.NewBalancer(subscriber)), detector)
+	}
+	logger.Debug(fmt.Sprintf("[BACKEND: %s][Balancer] Strategy: %s", remote.URLPattern, cfg.Strategy))
+
+	lb := sd.NewBalancerWithConfig(subscriber, cfg)
+	switch b := lb.(type) {
+	case sd.KeyBalancer:
+		return newBalancedMiddleware(func(request *Request) (string, func(), error) {
+			host, err := b.HostFor(BalancerKey(cfg, request))
+			return host, nil, err
+		}, detector)
+	case sd.TrackingBalancer:
+		return newBalancedMiddleware(func(_ *Request) (string, func(), error) {
+			return b.Acquire()
+		}, detector)
+	default:
+		return newBalancedMiddleware(balancerHostSelector(lb), detector)
+	}
+}
+
+// BalancerKey 返回请求在一致性哈希配置下的键.
+func BalancerKey(cfg *sd.BalancerConfig, request *Request) string {
+	switch cfg.HashBy {
+	case sd.HashByIP:
+		return request.ClientIP(cfg.TrustedProxies)
+	case sd.HashByParam:
+		return request.Params[cfg.Key]
+	default:
+		return request.HeaderGet(cfg.Key)
+	}
+}
+
 func newLoadBalancedMiddleware(lb sd.Balancer) Middleware {
+	return newBalancedMiddleware(balancerHostSelector(lb), nil)
+}
+
+// hostSelector 为请求选择后端, 返回的release不为nil时在请求结束后调用; 带有报文流的应答在报文读取完毕或关闭时结束.
+type hostSelector func(*Request) (string, func(), error)
+
+func balancerHostSelector(lb sd.Balancer) hostSelector {
+	return func(_ *Request) (string, func(), error) {
+		host, err := lb.Host()
+		return host, nil, err
+	}
+}
+
+// newBalancedMiddleware 创建负载均衡中间件, detector不为nil时由后端的HTTP代理向其报告请求的结果.
+func newBalancedMiddleware(selectHost hostSelector, detector *sd.OutlierDetector) Middleware {
 	return func(next ...Proxy) Proxy {
 		if len(next) > 1 {
 			panic(ErrTooManyProxies)
 		}
 		return func(ctx context.Context, request *Request) (*Response, error) {
-			host, err := lb.Host()
+			host, release, err := selectHost(request)
 			if err != nil {
 				return nil, err
 			}
+			if detector != nil {
+				ctx = withOutcomeReporter(ctx, func(failed bool) {
+					detector.Report(host, failed)
+				})
+			}
 			r := request.Clone()
 
 			var b strings.Builder
@@ -64,6 +138,9 @@ func newLoadBalancedMiddleware(lb sd.Balancer) Middleware {
 			b.WriteString(r.Path)
 			r.URL, err = url.Parse(b.String())
 			if err != nil {
+				if release != nil {
+					release()
+				}
 				return nil, err
 			}
 			if len(r.Query) > 0 {
@@ -74,7 +151,50 @@ func newLoadBalancedMiddleware(lb sd.Balancer) Middleware {
 				}
 			}
 
-			return next[0](ctx, &r)
+			resp, err := next[0](ctx, &r)
+			if release != nil {
+				// 应答报文还没有读取时, 请求在报文读取完毕或关闭时才结束
+				if resp != nil && resp.Io != nil {
+					resp.Io = newReleaseBody(resp.Io, release)
+				} else {
+					release()
+				}
+			}
+			return resp, err
+		}
+	}
+}
+
+type outcomeReporterKey struct{}
+
+// outcomeReporter 接收发送到所选后端的请求的结果, failed表示后端返回了5xx或连接失败.
+type outcomeReporter func(failed bool)
+
+// withOutcomeReporter 在ctx中登记report. ctx中已有的报告方依然会收到结果,
+// 例如熔断器和负载均衡中间件同时统计同一个请求.
+func withOutcomeReporter(ctx context.Context, report outcomeReporter) context.Context {
+	if parent, ok := ctx.Value(outcomeReporterKey{}).(outcomeReporter); ok {
+		self := report
+		report = func(failed bool) {
+			self(failed)
+			parent(failed)
+		}
+	}
+	return context.WithValue(ctx, outcomeReporterKey{}, report)
+}
+
+// reportOutcome 向负载均衡中间件报告请求的结果. 调用方取消的请求和其他错误不计入.
+func reportOutcome(ctx context.Context, statusCode int, err error) {
+	report, ok := ctx.Value(outcomeReporterKey{}).(outcomeReporter)
+	if !ok {
+		return
+	}
+	switch {
+	case err != nil:
+		if matchErrorClass(RetryOnConnection, err) {
+			report(true)
 		}
+	default:
+		report(statusCode >= http.StatusInternalServerError)
 	}
 }
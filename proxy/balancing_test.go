@@ -5,12 +5,22 @@ package proxy
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/encoding"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/sd"
 	"github.com/luraproject/lura/v2/sd/dnssrv"
+	"github.com/luraproject/lura/v2/transport/http/client"
 )
 
 func TestNewLoadBalancedMiddleware_ok(t *testing.T) {
@@ -131,6 +141,155 @@ func TestNewRoundRobinLoadBalancedMiddleware_DNSSRV(t *testing.T) {
 	dnssrv.DefaultLookup = defaultLookup
 }
 
+func TestNewConfiguredLoadBalancedMiddleware_consistentHash(t *testing.T) {
+	remote := &config.Backend{
+		URLPattern: "/faces",
+		ExtraConfig: config.ExtraConfig{
+			sd.BalancerNamespace: map[string]interface{}{"strategy": sd.StrategyConsistentHash},
+		},
+	}
+	subscriber := sd.FixedSubscriber([]string{"http://a", "http://b", "http://c"})
+	hosts := map[string]string{}
+	p := NewConfiguredLoadBalancedMiddleware(context.Background(), logging.NoOp, remote, subscriber)(func(_ context.Context, r *Request) (*Response, error) {
+		device := r.HeaderGet(sd.DefaultHashHeader)
+		if h, ok := hosts[device]; ok && h != r.URL.Host {
+			t.Errorf("%s: the device is not sticky: %s %s", device, h, r.URL.Host)
+		}
+		hosts[device] = r.URL.Host
+		return &Response{}, nil
+	})
+	for i := 0; i < 100; i++ {
+		request := &Request{
+			Path:    "/faces",
+			Headers: map[string][]string{sd.DefaultHashHeader: {fmt.Sprintf("device-%d", i%10)}},
+		}
+		if _, err := p(context.Background(), request); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(hosts) != 10 {
+		t.Errorf("unexpected number of devices: %d", len(hosts))
+	}
+}
+
+func TestNewConfiguredLoadBalancedMiddleware_leastOutstanding(t *testing.T) {
+	remote := &config.Backend{
+		ExtraConfig: config.ExtraConfig{
+			sd.BalancerNamespace: map[string]interface{}{"strategy": sd.StrategyLeastOutstanding},
+		},
+	}
+	hosts := []string{}
+	var p Proxy
+	p = NewConfiguredLoadBalancedMiddleware(context.Background(), logging.NoOp, remote, sd.FixedSubscriber([]string{"http://a", "http://b"}))(func(ctx context.Context, r *Request) (*Response, error) {
+		hosts = append(hosts, r.URL.Host)
+		// 第一个请求未完成时, 第二个请求发送到另一个后端
+		if len(hosts) == 1 {
+			return p(ctx, &Request{Path: "/"})
+		}
+		return &Response{}, nil
+	})
+	if _, err := p(context.Background(), &Request{Path: "/"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 || hosts[0] == hosts[1] {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+}
+
+func TestNewConfiguredLoadBalancedMiddleware_leastOutstandingStream(t *testing.T) {
+	remote := &config.Backend{
+		ExtraConfig: config.ExtraConfig{
+			sd.BalancerNamespace: map[string]interface{}{"strategy": sd.StrategyLeastOutstanding},
+		},
+	}
+	hosts := []string{}
+	p := NewConfiguredLoadBalancedMiddleware(context.Background(), logging.NoOp, remote, sd.FixedSubscriber([]string{"http://a", "http://b"}))(func(_ context.Context, r *Request) (*Response, error) {
+		hosts = append(hosts, r.URL.Host)
+		return &Response{Io: io.NopCloser(strings.NewReader("stream"))}, nil
+	})
+
+	// 报文还没有读取时请求未完成, 之后的请求发送到另一个后端
+	stream, err := p(context.Background(), &Request{Path: "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := p(context.Background(), &Request{Path: "/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(resp.Io)
+	}
+	io.ReadAll(stream.Io)
+	resp, _ := p(context.Background(), &Request{Path: "/"})
+	resp.Io.(io.Closer).Close()
+	if len(hosts) != 4 || hosts[1] == hosts[0] || hosts[2] == hosts[0] {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+}
+
+func TestBalancerKey_ip(t *testing.T) {
+	cfg := &sd.BalancerConfig{Strategy: sd.StrategyConsistentHash, HashBy: sd.HashByIP}
+	request := &Request{RemoteAddr: "10.0.0.1:1234", Headers: map[string][]string{"X-Forwarded-For": {"1.2.3.4"}}}
+	if key := BalancerKey(cfg, request); key != "10.0.0.1" {
+		t.Errorf("the forwarded address should be ignored: %s", key)
+	}
+	_, trusted, _ := net.ParseCIDR("10.0.0.0/8")
+	cfg.TrustedProxies = append(cfg.TrustedProxies, trusted)
+	if key := BalancerKey(cfg, request); key != "1.2.3.4" {
+		t.Errorf("unexpected key: %s", key)
+	}
+}
+
+func TestNewConfiguredLoadBalancedMiddleware_invalidConfig(t *testing.T) {
+	remote := &config.Backend{
+		ExtraConfig: config.ExtraConfig{
+			sd.BalancerNamespace: map[string]interface{}{"strategy": "fastest"},
+		},
+	}
+	testLoadBalancedMw(t, NewConfiguredLoadBalancedMiddleware(context.Background(), logging.NoOp, remote, sd.FixedSubscriber([]string{"http://127.0.0.1:8080"})))
+}
+
+func TestNewConfiguredLoadBalancedMiddleware_outlier(t *testing.T) {
+	var failing int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&failing, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer good.Close()
+
+	remote := &config.Backend{
+		URLPattern: "/faces",
+		Decoder:    encoding.JSONDecoder,
+		ExtraConfig: config.ExtraConfig{
+			sd.BalancerNamespace: map[string]interface{}{"strategy": sd.StrategyRoundRobin},
+			sd.OutlierNamespace:  map[string]interface{}{"consecutive_errors": 2},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewConfiguredLoadBalancedMiddleware(ctx, logging.NoOp, remote, sd.FixedSubscriber([]string{bad.URL, good.URL}))(
+		NewHTTPProxy(remote, client.NewHTTPClient, remote.Decoder))
+	defer func() {
+		report := sd.OutlierReport().(map[string]map[string]sd.OutlierStatus)
+		if st := report["/faces"][bad.URL]; !st.Ejected {
+			t.Errorf("unexpected status: %+v", st)
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		p(context.Background(), &Request{Method: "GET", Path: "/faces"})
+	}
+	if n := atomic.LoadInt32(&failing); n != 2 {
+		t.Errorf("unexpected number of requests to the failing host: %d", n)
+	}
+}
+
 type dummyBalancer string
 
 func (d dummyBalancer) Host() (string, error) { return string(d), nil }
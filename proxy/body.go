@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// BodyTooLargeError 请求报文超过最大字节数的错误, 渲染为413应答.
+type BodyTooLargeError struct {
+	// Limit 允许的最大字节数
+	Limit int64
+}
+
+// Error 实现error接口.
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body too large: the limit is %d bytes", e.Limit)
+}
+
+// StatusCode 返回HTTP状态码.
+func (e *BodyTooLargeError) StatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+// ToResponse 根据错误创建应答.
+func (e *BodyTooLargeError) ToResponse(requestURL string) *Response {
+	response := &Response{
+		Metadata: Metadata{
+			Headers:    map[string][]string{"Content-Type": {ViidContentType}},
+			StatusCode: e.StatusCode(),
+		},
+	}
+	response.SetResponseStatus(NewResponseStatus(requestURL, "", ViidStatusOtherError, e.Error()))
+	return response
+}
+
+// LimitedBody 限制最大字节数的请求报文. 读取超过限制时返回BodyTooLargeError,
+// 并记录超限状态, 即使读取方忽略了该错误, 路由器依然可以返回413.
+type LimitedBody struct {
+	body     io.ReadCloser
+	limit    int64
+	n        int64
+	exceeded int32
+}
+
+// LimitBody 限制请求报文的最大字节数. body已经被限制时, 用新的限制替换原有的限制.
+func LimitBody(body io.ReadCloser, limit int64) *LimitedBody {
+	if b, ok := body.(*LimitedBody); ok {
+		body = b.body
+	}
+	return &LimitedBody{body: body, limit: limit}
+}
+
+// Read 实现io.Reader接口.
+func (b *LimitedBody) Read(p []byte) (int, error) {
+	if b.Exceeded() {
+		return 0, &BodyTooLargeError{Limit: b.limit}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// 多读一个字节, 用于判断是否超限
+	if max := b.limit - b.n + 1; int64(len(p)) > max {
+		p = p[:max]
+	}
+	n, err := b.body.Read(p)
+	b.n += int64(n)
+	if b.n > b.limit {
+		atomic.StoreInt32(&b.exceeded, 1)
+		return n - int(b.n-b.limit), &BodyTooLargeError{Limit: b.limit}
+	}
+	return n, err
+}
+
+// Close 实现io.Closer接口.
+func (b *LimitedBody) Close() error {
+	return b.body.Close()
+}
+
+// Exceeded 返回是否读取到了超过限制的数据.
+func (b *LimitedBody) Exceeded() bool {
+	return atomic.LoadInt32(&b.exceeded) == 1
+}
+
+// Limit 返回允许的最大字节数.
+func (b *LimitedBody) Limit() int64 {
+	return b.limit
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLimitBody(t *testing.T) {
+	b := LimitBody(io.NopCloser(strings.NewReader("12345")), 5)
+	data, err := io.ReadAll(b)
+	if err != nil || string(data) != "12345" || b.Exceeded() {
+		t.Errorf("unexpected result: %s %v", data, err)
+	}
+
+	b = LimitBody(io.NopCloser(strings.NewReader("123456789")), 100)
+	b = LimitBody(b, 4)
+	data, err = io.ReadAll(b)
+	var be *BodyTooLargeError
+	if !errors.As(err, &be) || be.Limit != 4 || be.StatusCode() != http.StatusRequestEntityTooLarge {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if string(data) != "1234" || !b.Exceeded() {
+		t.Errorf("unexpected result: %s", data)
+	}
+	if _, err = b.Read(make([]byte, 10)); err == nil {
+		t.Error("expecting an error after the limit")
+	}
+	if response := be.ToResponse("/VIID/Images"); response.Metadata.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("unexpected response: %+v", response)
+	}
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/luraproject/lura/v2/circuitbreaker"
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+)
+
+// CircuitOpenError 熔断器打开时拒绝请求的错误, 渲染为503应答.
+type CircuitOpenError struct {
+	// Backend 被熔断的后端
+	Backend string
+}
+
+// Error 实现error接口.
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("the circuit breaker of the backend '%s' is open", e.Backend)
+}
+
+// Unwrap 返回circuitbreaker.ErrOpen.
+func (e *CircuitOpenError) Unwrap() error {
+	return circuitbreaker.ErrOpen
+}
+
+// StatusCode 返回HTTP状态码.
+func (e *CircuitOpenError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// ToResponse 根据错误创建应答.
+func (e *CircuitOpenError) ToResponse(requestURL string) *Response {
+	response := &Response{
+		Metadata: Metadata{
+			Headers:    map[string][]string{"Content-Type": {ViidContentType}},
+			StatusCode: e.StatusCode(),
+		},
+	}
+	response.SetResponseStatus(NewResponseStatus(requestURL, "", ViidStatusDeviceBusy, e.Error()))
+	return response
+}
+
+// NewCircuitBreakerMiddleware 根据Backend的ExtraConfig创建熔断器中间件, 没有配置时返回EmptyMiddleware.
+// 与负载均衡的异常检测一致, 只有后端返回5xx、连接失败或超时记为失败, 后端返回的4xx记为成功;
+// 调用方取消的请求和其他错误不计入统计.
+func NewCircuitBreakerMiddleware(logger logging.Logger, remote *config.Backend) Middleware {
+	cfg, err := circuitbreaker.GetConfig(remote.ExtraConfig)
+	if err != nil {
+		if err != circuitbreaker.ErrNoConfigFound {
+			logger.Warning(fmt.Sprintf("[BACKEND: %s][CB] %s", remote.URLPattern, err.Error()))
+		}
+		return EmptyMiddleware
+	}
+	logger.Debug(fmt.Sprintf("[BACKEND: %s][CB] Max errors: %d, Error rate: %v, Timeout: %s",
+		remote.URLPattern, cfg.MaxErrors, cfg.ErrorRate, cfg.Timeout))
+
+	var onChange func(from, to circuitbreaker.State)
+	if cfg.LogStatusChange {
+		onChange = func(from, to circuitbreaker.State) {
+			logger.Warning(fmt.Sprintf("[BACKEND: %s][CB] Circuit breaker changed from %s to %s", remote.URLPattern, from, to))
+		}
+	}
+	cb := circuitbreaker.New(*cfg, onChange)
+
+	return func(next ...Proxy) Proxy {
+		if len(next) > 1 {
+			panic(ErrTooManyProxies)
+		}
+		return func(ctx context.Context, request *Request) (*Response, error) {
+			done, err := cb.Allow()
+			if err != nil {
+				return nil, &CircuitOpenError{Backend: remote.URLPattern}
+			}
+			// 后端的HTTP代理报告真实的状态码, 状态码没有保留在错误中时也能区分4xx和5xx
+			var reported int32
+			resp, err := next[0](withOutcomeReporter(ctx, func(failed bool) {
+				if failed {
+					atomic.StoreInt32(&reported, outcomeFailed)
+				} else {
+					atomic.CompareAndSwapInt32(&reported, 0, outcomeSucceeded)
+				}
+			}), request)
+			done(circuitBreakerResult(ctx, atomic.LoadInt32(&reported), resp, err))
+			return resp, err
+		}
+	}
+}
+
+// 后端的HTTP代理报告的请求结果.
+const (
+	outcomeSucceeded int32 = iota + 1
+	outcomeFailed
+)
+
+// circuitBreakerResult 根据请求的结果判断是否计入熔断器的失败.
+func circuitBreakerResult(ctx context.Context, reported int32, resp *Response, err error) circuitbreaker.Result {
+	switch {
+	case errors.Is(err, context.Canceled) && ctx.Err() == context.Canceled:
+		return circuitbreaker.Ignored
+	case err != nil && (matchErrorClass(RetryOnTimeout, err) || matchErrorClass(RetryOnConnection, err)):
+		return circuitbreaker.Failure
+	case reported == outcomeFailed:
+		return circuitbreaker.Failure
+	case reported == outcomeSucceeded:
+		return circuitbreaker.Success
+	}
+	if code := backendStatusCode(resp, err); code != 0 {
+		if code >= http.StatusInternalServerError {
+			return circuitbreaker.Failure
+		}
+		return circuitbreaker.Success
+	}
+	if err != nil {
+		return circuitbreaker.Ignored
+	}
+	return circuitbreaker.Success
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+
+	"github.com/luraproject/lura/v2/circuitbreaker"
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/transport/http/client"
+)
+
+func TestNewCircuitBreakerMiddleware(t *testing.T) {
+	remote := &config.Backend{
+		URLPattern: "/faces",
+		ExtraConfig: config.ExtraConfig{
+			circuitbreaker.Namespace: map[string]interface{}{"max_errors": 2, "timeout": "1m"},
+		},
+	}
+	calls := 0
+	p := NewCircuitBreakerMiddleware(logging.NoOp, remote)(func(ctx context.Context, _ *Request) (*Response, error) {
+		calls++
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	})
+
+	// 调用方取消的请求不计入统计
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 3; i++ {
+		p(ctx, &Request{})
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := p(context.Background(), &Request{}); err == nil || errors.Is(err, circuitbreaker.ErrOpen) {
+			t.Errorf("unexpected error #%d: %v", i, err)
+		}
+	}
+
+	_, err := p(context.Background(), &Request{})
+	var ce *CircuitOpenError
+	if !errors.As(err, &ce) || ce.StatusCode() != http.StatusServiceUnavailable || !errors.Is(err, circuitbreaker.ErrOpen) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 5 {
+		t.Errorf("unexpected number of backend calls: %d", calls)
+	}
+	if response := ce.ToResponse("/VIID/Faces"); response.Metadata.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("unexpected response: %+v", response.Metadata)
+	}
+}
+
+func TestNewCircuitBreakerMiddleware_status(t *testing.T) {
+	remote := &config.Backend{
+		URLPattern: "/faces",
+		ExtraConfig: config.ExtraConfig{
+			circuitbreaker.Namespace: map[string]interface{}{"max_errors": 2, "timeout": "1m"},
+		},
+	}
+	status := http.StatusNotFound
+	p := NewCircuitBreakerMiddleware(logging.NoOp, remote)(func(ctx context.Context, _ *Request) (*Response, error) {
+		// 与后端的HTTP代理一样报告状态码, 错误中不包含状态码
+		reportOutcome(ctx, status, nil)
+		return nil, client.ErrInvalidStatusCode
+	})
+
+	// 后端返回的4xx不会打开熔断器
+	for i := 0; i < 5; i++ {
+		if _, err := p(context.Background(), &Request{}); !errors.Is(err, client.ErrInvalidStatusCode) {
+			t.Errorf("unexpected error #%d: %v", i, err)
+		}
+	}
+	// 其他错误不计入统计
+	other := NewCircuitBreakerMiddleware(logging.NoOp, remote)(func(_ context.Context, _ *Request) (*Response, error) {
+		return nil, errors.New("invalid response")
+	})
+	for i := 0; i < 5; i++ {
+		if _, err := other(context.Background(), &Request{}); err == nil || errors.Is(err, circuitbreaker.ErrOpen) {
+			t.Errorf("unexpected error #%d: %v", i, err)
+		}
+	}
+
+	status = http.StatusBadGateway
+	for i := 0; i < 2; i++ {
+		p(context.Background(), &Request{})
+	}
+	if _, err := p(context.Background(), &Request{}); !errors.Is(err, circuitbreaker.ErrOpen) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewCircuitBreakerMiddleware_noConfig(t *testing.T) {
+	p := NewCircuitBreakerMiddleware(logging.NoOp, &config.Backend{})(dummyProxy(&Response{IsComplete: true}))
+	if resp, err := p(context.Background(), &Request{}); err != nil || !resp.IsComplete {
+		t.Errorf("unexpected result: %v %v", resp, err)
+	}
+}
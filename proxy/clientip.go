@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP 返回客户端IP, 用于按IP限流和哈希. 与SourceIP不同, 只有直接连接的对端是trusted中的代理时
+// 才使用X-Forwarded-For和X-Real-IP: 从X-Forwarded-For的最右端开始跳过可信代理, 第一个不可信的地址即为客户端.
+// 没有配置可信代理时总是使用对端地址, 客户端无法通过请求头伪造.
+func ClientIP(remoteAddr string, header http.Header, trusted []*net.IPNet) string {
+	ip := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		ip = host
+	}
+	if !trustedIP(trusted, ip) {
+		return ip
+	}
+
+	if xff := header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			ip = hop
+			if !trustedIP(trusted, hop) {
+				break
+			}
+		}
+		return ip
+	}
+	if real := strings.TrimSpace(header.Get("X-Real-IP")); net.ParseIP(real) != nil {
+		return real
+	}
+	return ip
+}
+
+// ClientIP 返回请求的客户端IP, 见ClientIP函数.
+func (r *Request) ClientIP(trusted []*net.IPNet) string {
+	if r == nil {
+		return ""
+	}
+	return ClientIP(r.RemoteAddr, r.Headers, trusted)
+}
+
+func trustedIP(trusted []*net.IPNet, s string) bool {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
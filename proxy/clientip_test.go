@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/luraproject/lura/v2/config"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := config.ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		remote  string
+		header  http.Header
+		trusted bool
+		ip      string
+	}{
+		{remote: "1.2.3.4:80", ip: "1.2.3.4"},
+		{remote: "1.2.3.4:80", header: http.Header{"X-Forwarded-For": {"5.6.7.8"}}, ip: "1.2.3.4"},
+		{remote: "1.2.3.4:80", header: http.Header{"X-Forwarded-For": {"5.6.7.8"}}, trusted: true, ip: "1.2.3.4"},
+		{remote: "10.0.0.1:80", header: http.Header{"X-Forwarded-For": {"5.6.7.8"}}, ip: "10.0.0.1"},
+		{remote: "10.0.0.1:80", header: http.Header{"X-Forwarded-For": {"9.9.9.9, 5.6.7.8, 192.168.1.1"}}, trusted: true, ip: "5.6.7.8"},
+		{remote: "10.0.0.1:80", header: http.Header{"X-Forwarded-For": {"9.9.9.9", "10.0.0.2"}}, trusted: true, ip: "9.9.9.9"},
+		{remote: "10.0.0.1:80", header: http.Header{"X-Forwarded-For": {"bad, 10.0.0.2"}}, trusted: true, ip: "10.0.0.2"},
+		{remote: "10.0.0.1:80", header: http.Header{"X-Real-Ip": {"5.6.7.8"}}, trusted: true, ip: "5.6.7.8"},
+		{remote: "10.0.0.1:80", trusted: true, ip: "10.0.0.1"},
+	} {
+		nets := trusted
+		if !tc.trusted {
+			nets = nil
+		}
+		if ip := ClientIP(tc.remote, tc.header, nets); ip != tc.ip {
+			t.Errorf("%s %v: unexpected client IP: %s", tc.remote, tc.header, ip)
+		}
+	}
+}
@@ -3,9 +3,13 @@
 package proxy
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/luraproject/lura/v2/config"
 	"github.com/luraproject/lura/v2/logging"
 	"github.com/luraproject/lura/v2/sd"
+	"github.com/luraproject/lura/v2/sd/healthcheck"
 )
 
 // Factory creates proxies based on the received endpoint configuration.
@@ -17,6 +21,21 @@ type Factory interface {
 	New(cfg *config.EndpointConfig) (Proxy, error)
 }
 
+// ContextFactory 可选实现的接口. 代理中的后台任务(如后端的健康检查)随ctx结束而停止,
+// 路由器在代理被替换或服务退出时结束ctx. Factory.New创建的代理中的后台任务不会停止.
+type ContextFactory interface {
+	Factory
+	NewWithContext(ctx context.Context, cfg *config.EndpointConfig) (Proxy, error)
+}
+
+// NewWithContext 使用f创建代理, f实现了ContextFactory时将ctx传给它.
+func NewWithContext(ctx context.Context, f Factory, cfg *config.EndpointConfig) (Proxy, error) {
+	if cf, ok := f.(ContextFactory); ok {
+		return cf.NewWithContext(ctx, cfg)
+	}
+	return f.New(cfg)
+}
+
 // FactoryFunc type is an adapter to allow the use of ordinary functions as proxy factories.
 // If f is a function with the appropriate signature, FactoryFunc(f) is a Factory that calls f.
 type FactoryFunc func(*config.EndpointConfig) (Proxy, error)
@@ -55,14 +74,19 @@ type defaultFactory struct {
 }
 
 // New implements the Factory interface
-func (pf defaultFactory) New(cfg *config.EndpointConfig) (p Proxy, err error) {
+func (pf defaultFactory) New(cfg *config.EndpointConfig) (Proxy, error) {
+	return pf.NewWithContext(context.Background(), cfg)
+}
+
+// NewWithContext implements the ContextFactory interface
+func (pf defaultFactory) NewWithContext(ctx context.Context, cfg *config.EndpointConfig) (p Proxy, err error) {
 	switch len(cfg.Backend) {
 	case 0:
 		err = ErrNoBackends
 	case 1:
-		p, err = pf.newSingle(cfg)
+		p, err = pf.newSingle(ctx, cfg)
 	default:
-		p, err = pf.newMulti(cfg)
+		p, err = pf.newMulti(ctx, cfg)
 	}
 	if err != nil {
 		return
@@ -73,29 +97,46 @@ func (pf defaultFactory) New(cfg *config.EndpointConfig) (p Proxy, err error) {
 	return
 }
 
-func (pf defaultFactory) newMulti(cfg *config.EndpointConfig) (p Proxy, err error) {
+func (pf defaultFactory) newMulti(ctx context.Context, cfg *config.EndpointConfig) (p Proxy, err error) {
 	backendProxy := make([]Proxy, len(cfg.Backend))
 	for i, backend := range cfg.Backend {
-		backendProxy[i] = pf.newStack(backend)
+		if backendProxy[i], err = pf.newStack(ctx, cfg, backend); err != nil {
+			return
+		}
 	}
 	p = NewMergeDataMiddleware(pf.logger, cfg)(backendProxy...)
 	p = NewFlatmapMiddleware(pf.logger, cfg)(p)
 	return
 }
 
-func (pf defaultFactory) newSingle(cfg *config.EndpointConfig) (Proxy, error) {
-	return pf.newStack(cfg.Backend[0]), nil
+func (pf defaultFactory) newSingle(ctx context.Context, cfg *config.EndpointConfig) (Proxy, error) {
+	return pf.newStack(ctx, cfg, cfg.Backend[0])
 }
 
-func (pf defaultFactory) newStack(backend *config.Backend) (p Proxy) {
+func (pf defaultFactory) newStack(ctx context.Context, cfg *config.EndpointConfig, backend *config.Backend) (p Proxy, err error) {
+	// 限流配置错误时不创建代理, 避免在没有限流的情况下转发请求
+	rateLimit, err := NewBackendRateLimitMiddleware(pf.logger, backend)
+	if err != nil {
+		return nil, err
+	}
 	p = pf.backendFactory(backend)
 	p = NewBackendPluginMiddleware(pf.logger, backend)(p)
 	p = NewGraphQLMiddleware(pf.logger, backend)(p)
 	p = NewFilterHeadersMiddleware(pf.logger, backend)(p)
-	p = NewLoadBalancedMiddlewareWithSubscriber(pf.subscriberFactory(backend))(p)
-	if backend.ConcurrentCalls > 1 {
+	p = NewConfiguredLoadBalancedMiddleware(ctx, pf.logger, backend, healthcheck.Wrap(ctx, pf.logger, cfg.Method+" "+cfg.Endpoint, backend, pf.subscriberFactory(backend)))(p)
+	p = NewCircuitBreakerMiddleware(pf.logger, backend)(p)
+	p = NewRetryMiddleware(pf.logger, backend)(p)
+	// 对冲位于重试之外, 每个对冲请求各自重试
+	hedging, err := GetHedgingConfig(backend)
+	if err != nil {
+		pf.logger.Warning(fmt.Sprintf("[BACKEND: %s][Hedging] %s", backend.URLPattern, err.Error()))
+	}
+	if hedging != nil {
+		p = NewHedgingMiddleware(pf.logger, backend, hedging)(p)
+	} else if backend.ConcurrentCalls > 1 {
 		p = NewConcurrentMiddleware(backend)(p)
 	}
+	p = rateLimit(p)
 	p = NewRequestBuilderMiddleware(backend)(p)
 	return
 }
@@ -49,13 +49,14 @@ func NewFilterHeadersMiddleware(_ logging.Logger, remote *config.Backend) Middle
 				}
 			}
 			return nextProxy(ctx, &Request{
-				Method:  request.Method,
-				URL:     request.URL,
-				Query:   request.Query,
-				Path:    request.Path,
-				Body:    request.Body,
-				Params:  request.Params,
-				Headers: newHeaders,
+				Method:     request.Method,
+				URL:        request.URL,
+				Query:      request.Query,
+				Path:       request.Path,
+				Body:       request.Body,
+				Params:     request.Params,
+				Headers:    newHeaders,
+				RemoteAddr: request.RemoteAddr,
 			})
 		}
 	}
@@ -0,0 +1,248 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+)
+
+// HedgingNamespace 对冲请求在Backend的ExtraConfig中的配置键.
+const HedgingNamespace = "github_com/luraproject/lura/proxy/hedging"
+
+// 对冲请求的默认配置.
+const (
+	DefaultHedgingDelay      = 100 * time.Millisecond
+	DefaultHedgingMinSamples = 20
+	hedgingSamples           = 100
+)
+
+// HedgingConfig 对冲请求配置.
+type HedgingConfig struct {
+	// MaxRequests 最多发送的请求数, 包括第一次请求, 默认为Backend的ConcurrentCalls, 至少为2
+	MaxRequests int `json:"max_requests"`
+	// Delay 没有收到应答时发送下一个请求的等待时间
+	Delay time.Duration `json:"-"`
+	// Percentile 使用最近请求耗时的百分位数作为等待时间, 取值(0, 100), 样本不足时使用Delay
+	Percentile float64 `json:"percentile"`
+	// MinSamples 使用百分位数所需的最少样本数
+	MinSamples int `json:"min_samples"`
+	// HedgeNonIdempotent 是否对POST、PATCH等非幂等的请求发送对冲请求, 默认只对冲幂等的请求
+	HedgeNonIdempotent bool `json:"hedge_non_idempotent"`
+}
+
+// GetHedgingConfig 从Backend的ExtraConfig中解析对冲请求配置, 没有配置时返回nil.
+func GetHedgingConfig(remote *config.Backend) (*HedgingConfig, error) {
+	v, ok := remote.ExtraConfig[HedgingNamespace]
+	if !ok {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &HedgingConfig{}
+	aux := struct {
+		*HedgingConfig
+		Delay string `json:"delay"`
+	}{HedgingConfig: cfg}
+	if err = json.Unmarshal(b, &aux); err != nil {
+		return nil, err
+	}
+
+	cfg.Delay = DefaultHedgingDelay
+	if aux.Delay != "" {
+		if cfg.Delay, err = time.ParseDuration(aux.Delay); err != nil || cfg.Delay <= 0 {
+			return nil, fmt.Errorf("invalid delay '%s'", aux.Delay)
+		}
+	}
+	if cfg.Percentile < 0 || cfg.Percentile >= 100 {
+		return nil, fmt.Errorf("invalid percentile %v", cfg.Percentile)
+	}
+	if cfg.MaxRequests == 0 {
+		cfg.MaxRequests = remote.ConcurrentCalls
+	}
+	if cfg.MaxRequests < 2 {
+		cfg.MaxRequests = 2
+	}
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = DefaultHedgingMinSamples
+	}
+	return cfg, nil
+}
+
+// latencyTracker 记录最近的请求耗时.
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (l *latencyTracker) add(d time.Duration) {
+	l.mu.Lock()
+	if len(l.samples) < hedgingSamples {
+		l.samples = append(l.samples, d)
+	} else {
+		l.samples[l.next] = d
+		l.next = (l.next + 1) % hedgingSamples
+	}
+	l.mu.Unlock()
+}
+
+// percentile 返回耗时的百分位数, 样本不足时返回false.
+func (l *latencyTracker) percentile(p float64, minSamples int) (time.Duration, bool) {
+	l.mu.Lock()
+	if len(l.samples) < minSamples {
+		l.mu.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, len(l.samples))
+	copy(sorted, l.samples)
+	l.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(float64(len(sorted)-1)*p/100)], true
+}
+
+type hedgedResult struct {
+	index    int
+	response *Response
+	err      error
+}
+
+// NewHedgingMiddleware 创建对冲请求中间件: 先发送一个请求, 等待时间内没有收到完整的应答,
+// 或者已发送的请求都失败时, 再发送一个相同的请求, 直到达到MaxRequests.
+// 第一个完整的应答被返回, 其余的请求被取消. 请求报文在第一次请求前被完整读取, 每个请求使用一份新的报文.
+// 非幂等的请求只发送一次, 除非配置了HedgeNonIdempotent.
+//
+// 对冲位于重试之外, 每个对冲请求各自按照重试策略重试: 同时配置两者时,
+// 一次调用最多向后端发送MaxRequests*MaxAttempts个请求.
+func NewHedgingMiddleware(logger logging.Logger, remote *config.Backend, cfg *HedgingConfig) Middleware {
+	logger.Debug(fmt.Sprintf("[BACKEND: %s][Hedging] Max requests: %d, Delay: %s, Percentile: %v",
+		remote.URLPattern, cfg.MaxRequests, cfg.Delay, cfg.Percentile))
+	latencies := &latencyTracker{}
+
+	return func(next ...Proxy) Proxy {
+		if len(next) > 1 {
+			panic(ErrTooManyProxies)
+		}
+		return func(ctx context.Context, request *Request) (*Response, error) {
+			if !cfg.HedgeNonIdempotent && !isIdempotent(request.Method) {
+				return next[0](ctx, request)
+			}
+
+			var body []byte
+			if request.Body != nil {
+				b, err := io.ReadAll(request.Body)
+				request.Body.Close()
+				if err != nil {
+					return nil, err
+				}
+				body = b
+			}
+
+			delay := cfg.Delay
+			if cfg.Percentile > 0 {
+				if d, ok := latencies.percentile(cfg.Percentile, cfg.MinSamples); ok && d > 0 {
+					delay = d
+				}
+			}
+
+			results := make(chan hedgedResult, cfg.MaxRequests)
+			cancels := make([]context.CancelFunc, 0, cfg.MaxRequests)
+			launch := func() {
+				r := *request
+				if body != nil {
+					r.Body = io.NopCloser(bytes.NewReader(body))
+				}
+				callCtx, cancel := context.WithCancel(ctx)
+				index := len(cancels)
+				cancels = append(cancels, cancel)
+				go func() {
+					begin := time.Now()
+					resp, err := next[0](callCtx, &r)
+					if err == nil && resp != nil && resp.IsComplete {
+						latencies.add(time.Since(begin))
+					}
+					results <- hedgedResult{index: index, response: resp, err: err}
+				}()
+			}
+			// release 取消其余的请求. 胜出的应答报文还没有读取时, 其请求在报文读取完毕或关闭时释放
+			release := func(winner int, resp *Response) {
+				for i, cancel := range cancels {
+					if i != winner || resp == nil || resp.Io == nil {
+						cancel()
+					}
+				}
+				if winner >= 0 && resp != nil && resp.Io != nil {
+					resp.Io = newReleaseBody(resp.Io, cancels[winner])
+				}
+			}
+
+			launch()
+			pending := 1
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+
+			var response *Response
+			var err error
+			kept := -1
+			for {
+				select {
+				case res := <-results:
+					pending--
+					if res.err == nil && res.response != nil && res.response.IsComplete {
+						release(res.index, res.response)
+						return res.response, nil
+					}
+					if res.response != nil || response == nil {
+						// 只保留最后一个失败的应答
+						closeBody(response)
+						response, err, kept = res.response, res.err, res.index
+					}
+					if pending > 0 {
+						continue
+					}
+					if len(cancels) >= cfg.MaxRequests {
+						release(kept, response)
+						if response == nil && err == nil {
+							err = errNullResult
+						}
+						return response, err
+					}
+					// 已发送的请求都失败了, 不必等待
+					launch()
+					pending++
+					if !timer.Stop() {
+						select {
+						case <-timer.C:
+						default:
+						}
+					}
+					timer.Reset(delay)
+				case <-timer.C:
+					if len(cancels) < cfg.MaxRequests {
+						logger.Debug(fmt.Sprintf("[BACKEND: %s][Hedging] No response after %s, sending request #%d",
+							remote.URLPattern, delay, len(cancels)+1))
+						launch()
+						pending++
+						timer.Reset(delay)
+					}
+				case <-ctx.Done():
+					closeBody(response)
+					release(-1, nil)
+					return nil, ctx.Err()
+				}
+			}
+		}
+	}
+}
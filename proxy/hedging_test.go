@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+)
+
+func newHedgingBackend(t *testing.T, cfg map[string]interface{}) (*config.Backend, *HedgingConfig) {
+	remote := &config.Backend{URLPattern: "/faces", ExtraConfig: config.ExtraConfig{HedgingNamespace: cfg}}
+	hc, err := GetHedgingConfig(remote)
+	if err != nil || hc == nil {
+		t.Fatalf("unexpected config: %v %v", hc, err)
+	}
+	return remote, hc
+}
+
+func TestNewHedgingMiddleware(t *testing.T) {
+	remote, cfg := newHedgingBackend(t, map[string]interface{}{"max_requests": 3, "delay": "10ms"})
+
+	var calls int32
+	cancelled := make(chan struct{}, 3)
+	p := NewHedgingMiddleware(logging.NoOp, remote, cfg)(func(ctx context.Context, r *Request) (*Response, error) {
+		if b, _ := io.ReadAll(r.Body); string(b) != "body" {
+			t.Errorf("unexpected body: %s", b)
+		}
+		// 第一个请求很慢, 第二个请求胜出
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			cancelled <- struct{}{}
+			return nil, ctx.Err()
+		}
+		return &Response{IsComplete: true, Data: map[string]interface{}{"ok": true}}, nil
+	})
+
+	resp, err := p(context.Background(), &Request{Body: io.NopCloser(strings.NewReader("body"))})
+	if err != nil || resp == nil || resp.Data["ok"] != true {
+		t.Fatalf("unexpected result: %v %v", resp, err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("the slow request was not cancelled")
+	}
+	if c := atomic.LoadInt32(&calls); c != 2 {
+		t.Errorf("unexpected number of requests: %d", c)
+	}
+}
+
+func TestNewHedgingMiddleware_fastResponse(t *testing.T) {
+	remote, cfg := newHedgingBackend(t, map[string]interface{}{"max_requests": 3, "delay": "1s"})
+	var calls int32
+	p := NewHedgingMiddleware(logging.NoOp, remote, cfg)(func(_ context.Context, _ *Request) (*Response, error) {
+		atomic.AddInt32(&calls, 1)
+		return &Response{IsComplete: true}, nil
+	})
+	if _, err := p(context.Background(), &Request{}); err != nil {
+		t.Error(err)
+	}
+	if c := atomic.LoadInt32(&calls); c != 1 {
+		t.Errorf("unexpected number of requests: %d", c)
+	}
+}
+
+func TestNewHedgingMiddleware_allFailed(t *testing.T) {
+	remote, cfg := newHedgingBackend(t, map[string]interface{}{"max_requests": 3, "delay": "1s"})
+	var calls int32
+	errBackend := errors.New("backend failed")
+	p := NewHedgingMiddleware(logging.NoOp, remote, cfg)(func(_ context.Context, _ *Request) (*Response, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errBackend
+	})
+	begin := time.Now()
+	if _, err := p(context.Background(), &Request{}); err != errBackend {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// 失败后立即发送下一个请求, 不等待delay
+	if c := atomic.LoadInt32(&calls); c != 3 || time.Since(begin) > 500*time.Millisecond {
+		t.Errorf("unexpected number of requests: %d", c)
+	}
+}
+
+func TestNewHedgingMiddleware_nonIdempotent(t *testing.T) {
+	for _, tc := range []struct {
+		cfg   map[string]interface{}
+		calls int32
+	}{
+		{cfg: map[string]interface{}{"max_requests": 3, "delay": "1ms"}, calls: 1},
+		{cfg: map[string]interface{}{"max_requests": 3, "delay": "1ms", "hedge_non_idempotent": true}, calls: 3},
+	} {
+		remote, cfg := newHedgingBackend(t, tc.cfg)
+		var calls int32
+		p := NewHedgingMiddleware(logging.NoOp, remote, cfg)(func(_ context.Context, _ *Request) (*Response, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(50 * time.Millisecond)
+			return &Response{IsComplete: true}, nil
+		})
+		if _, err := p(context.Background(), &Request{Method: "POST"}); err != nil {
+			t.Error(err)
+		}
+		// 被取消的请求也会执行完毕
+		time.Sleep(100 * time.Millisecond)
+		if c := atomic.LoadInt32(&calls); c != tc.calls {
+			t.Errorf("%v: unexpected number of requests: %d", tc.cfg, c)
+		}
+	}
+}
+
+func TestLatencyTracker(t *testing.T) {
+	l := &latencyTracker{}
+	if _, ok := l.percentile(90, 1); ok {
+		t.Error("unexpected percentile without samples")
+	}
+	var wg sync.WaitGroup
+	for i := 1; i <= hedgingSamples+10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			l.add(time.Duration(i) * time.Millisecond)
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+	d, ok := l.percentile(90, 10)
+	if !ok || d < 80*time.Millisecond {
+		t.Errorf("unexpected percentile: %v", d)
+	}
+}
+
+func TestGetHedgingConfig(t *testing.T) {
+	if cfg, err := GetHedgingConfig(&config.Backend{}); cfg != nil || err != nil {
+		t.Errorf("unexpected result: %v %v", cfg, err)
+	}
+	cfg, err := GetHedgingConfig(&config.Backend{ConcurrentCalls: 4, ExtraConfig: config.ExtraConfig{HedgingNamespace: map[string]interface{}{"percentile": 95}}})
+	if err != nil || cfg.MaxRequests != 4 || cfg.Delay != DefaultHedgingDelay || cfg.MinSamples != DefaultHedgingMinSamples {
+		t.Errorf("unexpected config: %+v %v", cfg, err)
+	}
+	for _, v := range []map[string]interface{}{{"delay": "soon"}, {"percentile": 100}} {
+		if _, err := GetHedgingConfig(&config.Backend{ExtraConfig: config.ExtraConfig{HedgingNamespace: v}}); err == nil {
+			t.Errorf("%v: expecting an error", v)
+		}
+	}
+}
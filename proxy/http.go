@@ -77,8 +77,10 @@ func NewHTTPProxyDetailed(_ *config.Backend, re client.HTTPRequestExecutor, ch c
 		default:
 		}
 		if err != nil {
+			reportOutcome(ctx, 0, err)
 			return nil, err
 		}
+		reportOutcome(ctx, resp.StatusCode, nil)
 
 		resp, err = ch(ctx, resp)
 		if err != nil {
@@ -28,6 +28,8 @@ type Response struct {
 	IsComplete bool
 	Metadata   Metadata
 	Io         io.Reader
+	// StatusList 批量请求中每个对象的应答状态, 见AddResponseStatus
+	StatusList []ResponseStatus
 }
 
 // readCloserWrapper is Io.Reader which is closed when the Context is closed or canceled
@@ -47,6 +49,11 @@ func (w readCloserWrapper) Read(b []byte) (int, error) {
 	return w.rc.Read(b)
 }
 
+// Close closes the wrapped io.ReadCloser without waiting for the context
+func (w readCloserWrapper) Close() error {
+	return w.rc.Close()
+}
+
 // closeOnCancel closes the io.Reader when the context is Done
 func (w readCloserWrapper) closeOnCancel() {
 	<-w.ctx.Done()
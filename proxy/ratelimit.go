@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/ratelimit"
+)
+
+// RateLimitError 请求被限流的错误, 渲染为带有Retry-After头的429应答.
+type RateLimitError struct {
+	// RetryAfter 下一个令牌可用前需要等待的时间
+	RetryAfter time.Duration
+}
+
+// Error 实现error接口.
+func (e *RateLimitError) Error() string {
+	return "rate limit exceeded"
+}
+
+// StatusCode 返回HTTP状态码.
+func (e *RateLimitError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+// ToResponse 根据错误创建应答.
+func (e *RateLimitError) ToResponse(requestURL string) *Response {
+	response := &Response{
+		Metadata: Metadata{
+			Headers: map[string][]string{
+				"Content-Type": {ViidContentType},
+				"Retry-After":  {ratelimit.RetryAfter(e.RetryAfter)},
+			},
+			StatusCode: e.StatusCode(),
+		},
+	}
+	response.SetResponseStatus(NewResponseStatus(requestURL, "", ViidStatusDeviceBusy, e.Error()))
+	return response
+}
+
+// RateLimitKey 返回请求在限流配置下对应的令牌桶的键.
+func RateLimitKey(cfg *ratelimit.Config, request *Request) string {
+	switch cfg.Strategy {
+	case ratelimit.StrategyIP:
+		return request.ClientIP(cfg.TrustedProxies)
+	case ratelimit.StrategyHeader:
+		return request.HeaderGet(cfg.Key)
+	default:
+		return ""
+	}
+}
+
+// NewBackendRateLimitMiddleware 根据Backend的ExtraConfig创建限流中间件, 没有配置时返回EmptyMiddleware.
+// 配置错误时返回错误, 由调用方拒绝创建代理. 被限流的请求不会发送到后端, 返回RateLimitError.
+func NewBackendRateLimitMiddleware(logger logging.Logger, remote *config.Backend) (Middleware, error) {
+	cfg, err := ratelimit.GetConfig(remote.ExtraConfig)
+	if err == ratelimit.ErrNoConfigFound {
+		return EmptyMiddleware, nil
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("[BACKEND: %s][RateLimit] %s", remote.URLPattern, err.Error()))
+		return nil, err
+	}
+	logger.Debug(fmt.Sprintf("[BACKEND: %s][RateLimit] Rate: %v, Capacity: %d, Strategy: %s",
+		remote.URLPattern, cfg.MaxRate, cfg.Capacity, cfg.Strategy))
+
+	limiter := ratelimit.NewLimiter(cfg.MaxRate, cfg.Capacity, cfg.MaxKeys)
+	return func(next ...Proxy) Proxy {
+		if len(next) > 1 {
+			panic(ErrTooManyProxies)
+		}
+		return func(ctx context.Context, request *Request) (*Response, error) {
+			if ok, wait := limiter.Allow(RateLimitKey(cfg, request)); !ok {
+				return nil, &RateLimitError{RetryAfter: wait}
+			}
+			return next[0](ctx, request)
+		}
+	}, nil
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/ratelimit"
+)
+
+func TestNewBackendRateLimitMiddleware(t *testing.T) {
+	remote := &config.Backend{ExtraConfig: config.ExtraConfig{
+		ratelimit.Namespace: map[string]interface{}{"max_rate": 1, "strategy": "header"},
+	}}
+	mw, err := NewBackendRateLimitMiddleware(logging.NoOp, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := mw(func(_ context.Context, _ *Request) (*Response, error) {
+		return &Response{IsComplete: true}, nil
+	})
+	request := func(id string) *Request {
+		return &Request{Headers: map[string][]string{"User-Identify": {id}}}
+	}
+
+	if _, err := p(context.Background(), request("a")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := p(context.Background(), request("b")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	_, err = p(context.Background(), request("a"))
+	var re *RateLimitError
+	if !errors.As(err, &re) || re.StatusCode() != http.StatusTooManyRequests {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response := re.ToResponse("/VIID/Faces")
+	if response.Metadata.StatusCode != http.StatusTooManyRequests || response.Metadata.Headers["Retry-After"][0] != "1" {
+		t.Errorf("unexpected response: %+v", response.Metadata)
+	}
+}
+
+func TestNewBackendRateLimitMiddleware_invalidConfig(t *testing.T) {
+	remote := &config.Backend{ExtraConfig: config.ExtraConfig{
+		ratelimit.Namespace: map[string]interface{}{"max_rate": -1},
+	}}
+	if _, err := NewBackendRateLimitMiddleware(logging.NoOp, remote); err == nil {
+		t.Error("expecting an error")
+	}
+	// 限流配置错误时拒绝创建代理
+	factory := NewDefaultFactory(func(_ *config.Backend) Proxy { return dummyProxy(&Response{}) }, logging.NoOp)
+	if _, err := factory.New(&config.EndpointConfig{Backend: []*config.Backend{remote}}); err == nil {
+		t.Error("expecting an error")
+	}
+}
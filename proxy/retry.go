@@ -0,0 +1,280 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/luraproject/lura/v2/backoff"
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/transport/http/client"
+)
+
+// RetryNamespace 重试策略在Backend的ExtraConfig中的配置键.
+const RetryNamespace = "github_com/luraproject/lura/proxy/retry"
+
+// 可以重试的错误类别.
+const (
+	// RetryOnTimeout 单次请求超时或网络超时
+	RetryOnTimeout = "timeout"
+	// RetryOnConnection 连接被拒绝、被重置或意外关闭
+	RetryOnConnection = "connection"
+	// RetryOnInvalidStatus 后端返回了非200/201的状态码, 但没有返回具体的状态码
+	RetryOnInvalidStatus = "invalid_status"
+)
+
+var (
+	defaultRetryStatuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	defaultRetryErrors   = []string{RetryOnTimeout, RetryOnConnection}
+)
+
+// RetryConfig 重试策略.
+type RetryConfig struct {
+	// MaxAttempts 最多请求的次数, 包括第一次请求
+	MaxAttempts int `json:"max_attempts"`
+	// BackoffStrategy 重试的退避策略, 见backoff.GetByName
+	BackoffStrategy string `json:"backoff_strategy"`
+	// RetryOnStatus 可以重试的后端状态码, 默认为502, 503, 504
+	RetryOnStatus []int `json:"retry_on_status"`
+	// RetryOnErrors 可以重试的错误类别, 默认为timeout和connection
+	RetryOnErrors []string `json:"retry_on_errors"`
+	// PerTryTimeout 单次请求的超时时间, 为0时只受接口超时时间的限制
+	PerTryTimeout time.Duration `json:"-"`
+	// RetryNonIdempotent 是否重试POST、PATCH等非幂等的请求
+	RetryNonIdempotent bool `json:"retry_non_idempotent"`
+}
+
+// GetRetryConfig 从ExtraConfig中解析重试策略, 没有配置或max_attempts小于2时返回nil.
+func GetRetryConfig(e config.ExtraConfig) (*RetryConfig, error) {
+	v, ok := e[RetryNamespace]
+	if !ok {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &RetryConfig{}
+	aux := struct {
+		*RetryConfig
+		PerTryTimeout string `json:"per_try_timeout"`
+	}{RetryConfig: cfg}
+	if err = json.Unmarshal(b, &aux); err != nil {
+		return nil, err
+	}
+	if cfg.MaxAttempts < 2 {
+		return nil, nil
+	}
+	if aux.PerTryTimeout != "" {
+		if cfg.PerTryTimeout, err = time.ParseDuration(aux.PerTryTimeout); err != nil {
+			return nil, fmt.Errorf("invalid per_try_timeout: %s", err.Error())
+		}
+	}
+	if cfg.RetryOnStatus == nil {
+		cfg.RetryOnStatus = defaultRetryStatuses
+	}
+	if cfg.RetryOnErrors == nil {
+		cfg.RetryOnErrors = defaultRetryErrors
+	}
+	for _, class := range cfg.RetryOnErrors {
+		if class != RetryOnTimeout && class != RetryOnConnection && class != RetryOnInvalidStatus {
+			return nil, fmt.Errorf("unknown error class '%s'", class)
+		}
+	}
+	return cfg, nil
+}
+
+// NewRetryMiddleware 根据Backend的ExtraConfig创建重试中间件, 没有配置时返回EmptyMiddleware.
+// 请求报文在第一次请求前被完整读取, 每次请求都使用一份新的报文.
+// 设置了PerTryTimeout时, 最后一次请求的应答(包括流式读取)也受其限制.
+func NewRetryMiddleware(logger logging.Logger, remote *config.Backend) Middleware {
+	cfg, err := GetRetryConfig(remote.ExtraConfig)
+	if err != nil {
+		logger.Warning(fmt.Sprintf("[BACKEND: %s][Retry] %s", remote.URLPattern, err.Error()))
+		return EmptyMiddleware
+	}
+	if cfg == nil {
+		return EmptyMiddleware
+	}
+	logger.Debug(fmt.Sprintf("[BACKEND: %s][Retry] Max attempts: %d, Backoff: %s, Per try timeout: %s",
+		remote.URLPattern, cfg.MaxAttempts, cfg.BackoffStrategy, cfg.PerTryTimeout))
+
+	wait := backoff.GetByName(cfg.BackoffStrategy)
+	statuses := make(map[int]struct{}, len(cfg.RetryOnStatus))
+	for _, s := range cfg.RetryOnStatus {
+		statuses[s] = struct{}{}
+	}
+
+	return func(next ...Proxy) Proxy {
+		if len(next) > 1 {
+			panic(ErrTooManyProxies)
+		}
+		return func(ctx context.Context, request *Request) (*Response, error) {
+			attempts := cfg.MaxAttempts
+			if !cfg.RetryNonIdempotent && !isIdempotent(request.Method) {
+				attempts = 1
+			}
+
+			var body []byte
+			if attempts > 1 && request.Body != nil {
+				b, err := io.ReadAll(request.Body)
+				request.Body.Close()
+				if err != nil {
+					return nil, err
+				}
+				body = b
+			}
+
+			for i := 1; ; i++ {
+				r := *request
+				if body != nil {
+					r.Body = io.NopCloser(bytes.NewReader(body))
+				}
+				tryCtx, cancel := attemptContext(ctx, cfg.PerTryTimeout)
+				resp, err := next[0](tryCtx, &r)
+
+				if i >= attempts || ctx.Err() != nil || !shouldRetry(statuses, cfg.RetryOnErrors, resp, err) {
+					if resp != nil && resp.Io != nil {
+						// 应答报文还没有读取, 读取完毕或关闭时再释放
+						resp.Io = newReleaseBody(resp.Io, cancel)
+					} else {
+						cancel()
+					}
+					return resp, err
+				}
+				closeBody(resp)
+				cancel()
+				logger.Debug(fmt.Sprintf("[BACKEND: %s][Retry] Attempt %d failed: %v", remote.URLPattern, i, retryReason(resp, err)))
+
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(wait(i)):
+				}
+			}
+		}
+	}
+}
+
+// attemptContext 为单次尝试派生上下文, timeout大于0时限制单次尝试的时间.
+// 每次尝试只派生一个上下文, 调用方负责调用返回的cancel.
+func attemptContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// releaseBody 应答报文读取完毕或被关闭时调用一次release, 释放与该应答相关的资源.
+type releaseBody struct {
+	io.Reader
+	once    sync.Once
+	release func()
+}
+
+func newReleaseBody(r io.Reader, release func()) *releaseBody {
+	return &releaseBody{Reader: r, release: release}
+}
+
+func (b *releaseBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err != nil {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+// Close 释放资源并关闭原始的报文.
+func (b *releaseBody) Close() error {
+	b.once.Do(b.release)
+	if c, ok := b.Reader.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// closeBody 关闭被丢弃的应答的报文.
+func closeBody(resp *Response) {
+	if resp == nil || resp.Io == nil {
+		return
+	}
+	if c, ok := resp.Io.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// isIdempotent 判断HTTP方法是否幂等. 未指定方法的请求按照GET处理.
+func isIdempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func shouldRetry(statuses map[int]struct{}, classes []string, resp *Response, err error) bool {
+	// 熔断器打开时重试没有意义
+	var ce *CircuitOpenError
+	if errors.As(err, &ce) {
+		return false
+	}
+	if code := backendStatusCode(resp, err); code != 0 {
+		if _, ok := statuses[code]; ok {
+			return true
+		}
+	}
+	if err == nil {
+		return false
+	}
+	for _, class := range classes {
+		if matchErrorClass(class, err) {
+			return true
+		}
+	}
+	return false
+}
+
+// backendStatusCode 返回后端的状态码, 未知时返回0.
+func backendStatusCode(resp *Response, err error) int {
+	var se interface{ StatusCode() int }
+	if err != nil && errors.As(err, &se) {
+		return se.StatusCode()
+	}
+	if resp != nil {
+		return resp.Metadata.StatusCode
+	}
+	return 0
+}
+
+func matchErrorClass(class string, err error) bool {
+	switch class {
+	case RetryOnTimeout:
+		var ne net.Error
+		return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout())
+	case RetryOnConnection:
+		var oe *net.OpError
+		return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || (errors.As(err, &oe) && oe.Op == "dial")
+	case RetryOnInvalidStatus:
+		return errors.Is(err, client.ErrInvalidStatusCode)
+	}
+	return false
+}
+
+func retryReason(resp *Response, err error) interface{} {
+	if err != nil {
+		return err
+	}
+	return fmt.Sprintf("status code %d", backendStatusCode(resp, nil))
+}
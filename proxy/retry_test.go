@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/backoff"
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/transport/http/client"
+)
+
+func newRetryBackend(cfg map[string]interface{}) *config.Backend {
+	return &config.Backend{URLPattern: "/faces", ExtraConfig: config.ExtraConfig{RetryNamespace: cfg}}
+}
+
+func TestNewRetryMiddleware(t *testing.T) {
+	defer func(d time.Duration) { backoff.DefaultBackoffDuration = d }(backoff.DefaultBackoffDuration)
+	backoff.DefaultBackoffDuration = time.Millisecond
+
+	results := []error{
+		client.HTTPResponseError{Code: http.StatusBadGateway},
+		syscall.ECONNREFUSED,
+		nil,
+	}
+	bodies := []string{}
+	calls := 0
+	p := NewRetryMiddleware(logging.NoOp, newRetryBackend(map[string]interface{}{"max_attempts": 3}))(
+		func(_ context.Context, r *Request) (*Response, error) {
+			b, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(b))
+			err := results[calls]
+			calls++
+			if err != nil {
+				return nil, err
+			}
+			return &Response{IsComplete: true}, nil
+		})
+
+	resp, err := p(context.Background(), &Request{Method: "PUT", Body: io.NopCloser(strings.NewReader("body"))})
+	if err != nil || resp == nil || !resp.IsComplete {
+		t.Fatalf("unexpected result: %v %v", resp, err)
+	}
+	if calls != 3 {
+		t.Errorf("unexpected number of attempts: %d", calls)
+	}
+	for i, b := range bodies {
+		if b != "body" {
+			t.Errorf("the body of the attempt #%d was not replayed: %s", i, b)
+		}
+	}
+}
+
+func TestNewRetryMiddleware_notRetryable(t *testing.T) {
+	defer func(d time.Duration) { backoff.DefaultBackoffDuration = d }(backoff.DefaultBackoffDuration)
+	backoff.DefaultBackoffDuration = time.Millisecond
+
+	for _, tc := range []struct {
+		name   string
+		cfg    map[string]interface{}
+		method string
+		err    error
+		calls  int
+	}{
+		{"post", map[string]interface{}{"max_attempts": 3}, "POST", syscall.ECONNREFUSED, 1},
+		{"post allowed", map[string]interface{}{"max_attempts": 3, "retry_non_idempotent": true}, "POST", syscall.ECONNREFUSED, 3},
+		{"status", map[string]interface{}{"max_attempts": 3}, "GET", client.HTTPResponseError{Code: http.StatusNotFound}, 1},
+		{"invalid status", map[string]interface{}{"max_attempts": 3}, "GET", client.ErrInvalidStatusCode, 1},
+		{"invalid status allowed", map[string]interface{}{"max_attempts": 2, "retry_on_errors": []string{"invalid_status"}}, "GET", client.ErrInvalidStatusCode, 2},
+		{"circuit open", map[string]interface{}{"max_attempts": 3}, "GET", &CircuitOpenError{}, 1},
+	} {
+		calls := 0
+		p := NewRetryMiddleware(logging.NoOp, newRetryBackend(tc.cfg))(func(_ context.Context, _ *Request) (*Response, error) {
+			calls++
+			return nil, tc.err
+		})
+		if _, err := p(context.Background(), &Request{Method: tc.method}); !errors.Is(err, tc.err) && err != tc.err {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		if calls != tc.calls {
+			t.Errorf("%s: unexpected number of attempts: %d", tc.name, calls)
+		}
+	}
+}
+
+func TestNewRetryMiddleware_perTryTimeout(t *testing.T) {
+	defer func(d time.Duration) { backoff.DefaultBackoffDuration = d }(backoff.DefaultBackoffDuration)
+	backoff.DefaultBackoffDuration = time.Millisecond
+
+	calls := 0
+	p := NewRetryMiddleware(logging.NoOp, newRetryBackend(map[string]interface{}{"max_attempts": 2, "per_try_timeout": "10ms"}))(
+		func(ctx context.Context, _ *Request) (*Response, error) {
+			calls++
+			if calls == 1 {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return &Response{IsComplete: true}, nil
+		})
+	if resp, err := p(context.Background(), &Request{}); err != nil || resp == nil {
+		t.Errorf("unexpected result: %v %v", resp, err)
+	}
+	if calls != 2 {
+		t.Errorf("unexpected number of attempts: %d", calls)
+	}
+}
+
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestNewRetryMiddleware_streamedBody(t *testing.T) {
+	defer func(d time.Duration) { backoff.DefaultBackoffDuration = d }(backoff.DefaultBackoffDuration)
+	backoff.DefaultBackoffDuration = time.Millisecond
+
+	discarded := &trackedBody{Reader: strings.NewReader("unavailable")}
+	var lastCtx context.Context
+	calls := 0
+	p := NewRetryMiddleware(logging.NoOp, newRetryBackend(map[string]interface{}{"max_attempts": 2}))(
+		func(ctx context.Context, _ *Request) (*Response, error) {
+			calls++
+			if calls == 1 {
+				return &Response{Io: discarded, Metadata: Metadata{StatusCode: http.StatusServiceUnavailable}}, nil
+			}
+			lastCtx = ctx
+			return &Response{Io: strings.NewReader("ok"), IsComplete: true, Metadata: Metadata{StatusCode: http.StatusOK}}, nil
+		})
+
+	resp, err := p(context.Background(), &Request{})
+	if err != nil || resp == nil {
+		t.Fatalf("unexpected result: %v %v", resp, err)
+	}
+	if !discarded.closed {
+		t.Error("the body of the discarded response was not closed")
+	}
+	if lastCtx.Err() != nil {
+		t.Error("the context was cancelled before reading the body")
+	}
+	if b, _ := io.ReadAll(resp.Io); string(b) != "ok" {
+		t.Errorf("unexpected body: %s", b)
+	}
+	if lastCtx.Err() == nil {
+		t.Error("the context was not released after reading the body")
+	}
+}
+
+func TestGetRetryConfig(t *testing.T) {
+	if cfg, err := GetRetryConfig(config.ExtraConfig{}); cfg != nil || err != nil {
+		t.Errorf("unexpected result: %v %v", cfg, err)
+	}
+	if cfg, err := GetRetryConfig(config.ExtraConfig{RetryNamespace: map[string]interface{}{"max_attempts": 1}}); cfg != nil || err != nil {
+		t.Errorf("unexpected result: %v %v", cfg, err)
+	}
+	for _, v := range []map[string]interface{}{
+		{"max_attempts": 2, "per_try_timeout": "soon"},
+		{"max_attempts": 2, "retry_on_errors": []string{"dns"}},
+	} {
+		if _, err := GetRetryConfig(config.ExtraConfig{RetryNamespace: v}); err == nil {
+			t.Errorf("%v: expecting an error", v)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import "time"
+
+// ViidContentType GA/T 1400 报文的Content-Type.
+const ViidContentType = "application/VIID+JSON"
+
+// ViidTimeLayout GA/T 1400 报文中日期时间的格式.
+const ViidTimeLayout = "20060102150405"
+
+// GA/T 1400 应答状态码.
+const (
+	ViidStatusOK                 = 0
+	ViidStatusOtherError         = 1
+	ViidStatusDeviceBusy         = 2
+	ViidStatusDeviceError        = 3
+	ViidStatusInvalidOperation   = 4
+	ViidStatusInvalidXMLFormat   = 5
+	ViidStatusInvalidXMLContent  = 6
+	ViidStatusInvalidJSONFormat  = 7
+	ViidStatusInvalidJSONContent = 8
+	ViidStatusReboot             = 9
+)
+
+// ResponseStatusObjectKey 应答状态对象在报文中的键.
+const ResponseStatusObjectKey = "ResponseStatusObject"
+
+// ResponseStatusListObjectKey 应答状态列表对象在报文中的键.
+const ResponseStatusListObjectKey = "ResponseStatusListObject"
+
+// ResponseStatus GA/T 1400 应答状态对象.
+type ResponseStatus struct {
+	RequestURL   string `json:"RequestURL"`
+	StatusCode   int    `json:"StatusCode"`
+	StatusString string `json:"StatusString"`
+	ID           string `json:"Id"`
+	LocalTime    string `json:"LocalTime"`
+}
+
+// NewResponseStatus 创建应答状态对象, LocalTime取当前时间.
+func NewResponseStatus(requestURL, id string, code int, msg string) ResponseStatus {
+	return ResponseStatus{
+		RequestURL:   requestURL,
+		StatusCode:   code,
+		StatusString: msg,
+		ID:           id,
+		LocalTime:    time.Now().Format(ViidTimeLayout),
+	}
+}
+
+// SetResponseStatus 用单个应答状态对象替换应答的数据.
+func (resp *Response) SetResponseStatus(status ResponseStatus) {
+	resp.Data = map[string]interface{}{ResponseStatusObjectKey: status}
+}
+
+// AddResponseStatus 记录批量请求中单个对象的应答状态.
+// 各对象的状态互不影响, 部分对象失败时其余对象依然返回成功的状态.
+func (resp *Response) AddResponseStatus(status ResponseStatus) {
+	resp.StatusList = append(resp.StatusList, status)
+}
+
+// ResponseStatusListObject 返回应答状态列表报文:
+// {"ResponseStatusListObject":{"ResponseStatusObject":[...]}}.
+func (resp *Response) ResponseStatusListObject() map[string]interface{} {
+	list := resp.StatusList
+	if list == nil {
+		list = []ResponseStatus{}
+	}
+	return map[string]interface{}{
+		ResponseStatusListObjectKey: map[string]interface{}{ResponseStatusObjectKey: list},
+	}
+}
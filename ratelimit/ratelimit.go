@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+Package ratelimit 实现基于令牌桶的限流, 可以在EndpointConfig和Backend的ExtraConfig中配置.
+
+	"extra_config": {
+		"github_com/luraproject/lura/ratelimit": {
+			"max_rate": 10,
+			"capacity": 20,
+			"strategy": "header",
+			"key": "User-Identify"
+		}
+	}
+
+按客户端IP限流时默认使用连接的对端地址, 客户端无法通过X-Forwarded-For伪造. 网关部署在反向代理之后时,
+在trusted_proxies中配置代理的IP或CIDR, 来自这些代理的请求使用X-Forwarded-For中的客户端地址.
+每个限流器最多保存max_keys个令牌桶, 超出时回收已装满的令牌桶, 仍然超出时随机丢弃一个.
+*/
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+)
+
+// Namespace 限流在ExtraConfig中的配置键.
+const Namespace = "github_com/luraproject/lura/ratelimit"
+
+// 限流的维度.
+const (
+	// StrategyGlobal 所有请求共享一个令牌桶
+	StrategyGlobal = "global"
+	// StrategyIP 每个客户端IP一个令牌桶
+	StrategyIP = "ip"
+	// StrategyHeader 按请求头(默认User-Identify)的值区分令牌桶
+	StrategyHeader = "header"
+)
+
+// DefaultHeader 按请求头限流时默认使用的请求头.
+const DefaultHeader = "User-Identify"
+
+// DefaultMaxKeys 每个限流器默认最多保存的令牌桶数.
+const DefaultMaxKeys = 100000
+
+// ErrNoConfigFound 没有配置限流.
+var ErrNoConfigFound = errors.New("ratelimit: no configuration found")
+
+// Config 限流配置.
+type Config struct {
+	// MaxRate 每秒补充的令牌数
+	MaxRate float64 `json:"max_rate"`
+	// Capacity 令牌桶的容量, 即允许的突发请求数, 默认为MaxRate向上取整
+	Capacity int `json:"capacity"`
+	// Strategy 限流的维度, 默认为global
+	Strategy string `json:"strategy"`
+	// Key 按请求头限流时使用的请求头
+	Key string `json:"key"`
+	// MaxKeys 最多保存的令牌桶数, 默认为DefaultMaxKeys
+	MaxKeys int `json:"max_keys"`
+	// TrustedProxies 按客户端IP限流时可信的代理
+	TrustedProxies []*net.IPNet `json:"-"`
+}
+
+// GetConfig 从ExtraConfig中解析限流配置, 没有配置时返回ErrNoConfigFound.
+func GetConfig(e config.ExtraConfig) (*Config, error) {
+	v, ok := e[Namespace]
+	if !ok {
+		return nil, ErrNoConfigFound
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	aux := struct {
+		*Config
+		TrustedProxies []string `json:"trusted_proxies"`
+	}{Config: cfg}
+	if err = json.Unmarshal(b, &aux); err != nil {
+		return nil, err
+	}
+	if cfg.TrustedProxies, err = config.ParseTrustedProxies(aux.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("ratelimit: %s", err.Error())
+	}
+
+	if cfg.MaxRate <= 0 {
+		return nil, fmt.Errorf("ratelimit: invalid max_rate %v", cfg.MaxRate)
+	}
+	if cfg.Capacity <= 0 {
+		cfg.Capacity = int(math.Ceil(cfg.MaxRate))
+	}
+	if cfg.MaxKeys <= 0 {
+		cfg.MaxKeys = DefaultMaxKeys
+	}
+	switch cfg.Strategy {
+	case "":
+		cfg.Strategy = StrategyGlobal
+	case StrategyGlobal, StrategyIP:
+	case StrategyHeader:
+		if cfg.Key == "" {
+			cfg.Key = DefaultHeader
+		}
+	default:
+		return nil, fmt.Errorf("ratelimit: unknown strategy '%s'", cfg.Strategy)
+	}
+	return cfg, nil
+}
+
+// TokenBucket 令牌桶, 并发安全.
+type TokenBucket struct {
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewTokenBucket 创建装满令牌的令牌桶.
+func NewTokenBucket(rate float64, capacity int) *TokenBucket {
+	return &TokenBucket{rate: rate, capacity: float64(capacity), tokens: float64(capacity), last: time.Now()}
+}
+
+// Allow 尝试取出一个令牌. 失败时返回下一个令牌可用前需要等待的时间.
+func (b *TokenBucket) Allow() (bool, time.Duration) {
+	return b.allowAt(time.Now())
+}
+
+func (b *TokenBucket) allowAt(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// full 令牌桶在now时是否已经装满, 装满的令牌桶可以被回收.
+func (b *TokenBucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.capacity
+}
+
+// cleanupInterval 回收空闲令牌桶的最小间隔.
+const cleanupInterval = time.Minute
+
+// Limiter 按键区分令牌桶的限流器. 已经装满的令牌桶等同于新建的令牌桶, 会被定期回收.
+// 令牌桶的数量不超过maxKeys, 避免大量不同的键耗尽内存.
+type Limiter struct {
+	mu          sync.Mutex
+	rate        float64
+	capacity    int
+	maxKeys     int
+	buckets     map[string]*TokenBucket
+	lastCleanup time.Time
+}
+
+// NewLimiter 创建限流器, maxKeys不大于0时使用DefaultMaxKeys.
+func NewLimiter(rate float64, capacity, maxKeys int) *Limiter {
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	return &Limiter{rate: rate, capacity: capacity, maxKeys: maxKeys, buckets: map[string]*TokenBucket{}, lastCleanup: time.Now()}
+}
+
+// Allow 从key对应的令牌桶中取出一个令牌.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+	l.mu.Lock()
+	if now.Sub(l.lastCleanup) >= cleanupInterval {
+		l.cleanup(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.maxKeys {
+			l.cleanup(now)
+		}
+		// 仍然没有空间时随机丢弃一个令牌桶
+		for k := range l.buckets {
+			if len(l.buckets) < l.maxKeys {
+				break
+			}
+			delete(l.buckets, k)
+		}
+		b = NewTokenBucket(l.rate, l.capacity)
+		l.buckets[key] = b
+	}
+	l.mu.Unlock()
+	return b.allowAt(now)
+}
+
+// cleanup 回收已经装满的令牌桶, 调用时需要持有l.mu.
+func (l *Limiter) cleanup(now time.Time) {
+	for k, b := range l.buckets {
+		if b.full(now) {
+			delete(l.buckets, k)
+		}
+	}
+	l.lastCleanup = now
+}
+
+// RetryAfter 将等待时间转换为Retry-After头的秒数, 至少为1秒.
+func RetryAfter(wait time.Duration) string {
+	s := int(math.Ceil(wait.Seconds()))
+	if s < 1 {
+		s = 1
+	}
+	return strconv.Itoa(s)
+}
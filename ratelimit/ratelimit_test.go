@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+)
+
+func TestGetConfig(t *testing.T) {
+	if _, err := GetConfig(config.ExtraConfig{}); err != ErrNoConfigFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+	cfg, err := GetConfig(config.ExtraConfig{Namespace: map[string]interface{}{"max_rate": 2.5, "strategy": "header"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Capacity != 3 || cfg.Key != DefaultHeader || cfg.MaxKeys != DefaultMaxKeys {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	cfg, err = GetConfig(config.ExtraConfig{Namespace: map[string]interface{}{"max_rate": 1, "strategy": "ip", "trusted_proxies": []interface{}{"10.0.0.0/8"}}})
+	if err != nil || len(cfg.TrustedProxies) != 1 {
+		t.Errorf("unexpected config: %+v %v", cfg, err)
+	}
+	for _, v := range []map[string]interface{}{
+		{"max_rate": 0},
+		{"max_rate": 1, "strategy": "cookie"},
+		{"max_rate": 1, "strategy": "ip", "trusted_proxies": []interface{}{"proxy"}},
+	} {
+		if _, err := GetConfig(config.ExtraConfig{Namespace: v}); err == nil {
+			t.Errorf("%v: expecting an error", v)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := NewTokenBucket(2, 2)
+	b.last = now
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.allowAt(now); !ok {
+			t.Errorf("request #%d should be allowed", i)
+		}
+	}
+	ok, wait := b.allowAt(now)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("unexpected result: %v %v", ok, wait)
+	}
+	if ok, _ = b.allowAt(now.Add(500 * time.Millisecond)); !ok {
+		t.Error("the refilled token should be allowed")
+	}
+	if b.full(now.Add(time.Second)) || !b.full(now.Add(2*time.Second)) {
+		t.Error("unexpected refill")
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(1, 1, 0)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("the first request of 'a' should be allowed")
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("the first request of 'b' should be allowed")
+	}
+	if ok, wait := l.Allow("a"); ok || wait <= 0 {
+		t.Errorf("the second request of 'a' should be limited: %v", wait)
+	}
+
+	l.lastCleanup = time.Now().Add(-cleanupInterval)
+	l.buckets["c"] = NewTokenBucket(1, 1)
+	l.Allow("a")
+	if _, ok := l.buckets["c"]; ok {
+		t.Error("the full bucket should be removed")
+	}
+}
+
+func TestLimiter_maxKeys(t *testing.T) {
+	l := NewLimiter(1, 1, 2)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if ok, _ := l.Allow(key); !ok {
+			t.Errorf("the first request of '%s' should be allowed", key)
+		}
+		if len(l.buckets) > 2 {
+			t.Errorf("too many buckets: %d", len(l.buckets))
+		}
+	}
+	if _, ok := l.buckets["d"]; !ok {
+		t.Error("the last bucket should be kept")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for wait, want := range map[time.Duration]string{0: "1", 300 * time.Millisecond: "1", 1500 * time.Millisecond: "2"} {
+		if got := RetryAfter(wait); got != want {
+			t.Errorf("%v: unexpected value %s", wait, got)
+		}
+	}
+}
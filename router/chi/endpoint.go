@@ -24,6 +24,14 @@ func NewEndpointHandler(cfg *config.EndpointConfig, prxy proxy.Proxy) http.Handl
 	return hf(cfg, prxy)
 }
 
+// NewVicgEndpointHandler 用于VicgFactory创建的代理的HandlerFactory.
+func NewVicgEndpointHandler(cfg *config.EndpointConfig, prxy proxy.Proxy) http.HandlerFunc {
+	hf := mux.VicgEndpointHandler(
+		mux.NewRequestBuilder(extractParamsFromEndpoint),
+	)
+	return hf(cfg, prxy)
+}
+
 func extractParamsFromEndpoint(r *http.Request) map[string]string {
 	ctx := r.Context()
 	rctx := chi.RouteContext(ctx)
@@ -34,9 +34,11 @@ type Config struct {
 	Middlewares    chi.Middlewares
 	HandlerFactory HandlerFactory
 	ProxyFactory   proxy.Factory
-	Logger         logging.Logger
-	DebugPattern   string
-	RunServer      RunServerFunc
+	// VicgFactory 用户自定义的代理工厂, 设置后优先于ProxyFactory, 任一接口创建失败时路由器不会启动
+	VicgFactory  router.VicgFactory
+	Logger       logging.Logger
+	DebugPattern string
+	RunServer    RunServerFunc
 }
 
 // DefaultFactory returns a chi router factory with the injected proxy factory and logger.
@@ -46,7 +48,7 @@ func DefaultFactory(proxyFactory proxy.Factory, logger logging.Logger) router.Fa
 		Config{
 			Engine:         chi.NewRouter(),
 			Middlewares:    chi.Middlewares{middleware.Logger},
-			HandlerFactory: NewEndpointHandler,
+			HandlerFactory: HandlerFactory(mux.NewRateLimitHandlerFactory(NewEndpointHandler, logger)),
 			ProxyFactory:   proxyFactory,
 			Logger:         logger,
 			DebugPattern:   ChiDefaultDebugPattern,
@@ -55,6 +57,21 @@ func DefaultFactory(proxyFactory proxy.Factory, logger logging.Logger) router.Fa
 	)
 }
 
+// DefaultVicgFactory 创建使用用户代理工厂的路由器工厂.
+func DefaultVicgFactory(vf router.VicgFactory, logger logging.Logger) router.Factory {
+	return NewFactory(
+		Config{
+			Engine:         chi.NewRouter(),
+			Middlewares:    chi.Middlewares{middleware.Logger},
+			HandlerFactory: HandlerFactory(mux.NewRateLimitHandlerFactory(NewVicgEndpointHandler, logger)),
+			VicgFactory:    vf,
+			Logger:         logger,
+			DebugPattern:   ChiDefaultDebugPattern,
+			RunServer:      server.RunServer,
+		},
+	)
+}
+
 // NewFactory returns a chi router factory with the injected configuration
 func NewFactory(cfg Config) router.Factory {
 	if cfg.DebugPattern == "" {
@@ -94,7 +111,13 @@ func (r chiRouter) Run(cfg config.ServiceConfig) {
 
 	server.InitHTTPDefaultTransport(cfg)
 
-	r.registerKrakendEndpoints(cfg.Endpoints)
+	if r.cfg.VicgFactory == nil {
+		r.registerKrakendEndpoints(cfg.Endpoints)
+	} else if err := r.registerVicgEndpoints(cfg); err != nil {
+		// 令所有插件加载成功进程才会启动
+		r.cfg.Logger.Error(logPrefix, "Router execution failed:", err.Error())
+		return
+	}
 
 	r.cfg.Engine.NotFound(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set(server.CompleteResponseHeaderName, server.HeaderIncompleteResponseValue)
@@ -119,7 +142,11 @@ func (r chiRouter) registerDebugEndpoints() {
 
 func (r chiRouter) registerKrakendEndpoints(endpoints []*config.EndpointConfig) {
 	for _, c := range endpoints {
-		proxyStack, err := r.cfg.ProxyFactory.New(c)
+		if err := router.ValidateRateLimit(c); err != nil {
+			r.cfg.Logger.Error(logPrefix, "[ENDPOINT:", c.Endpoint, "]", err.Error())
+			continue
+		}
+		proxyStack, err := proxy.NewWithContext(r.ctx, r.cfg.ProxyFactory, c)
 		if err != nil {
 			r.cfg.Logger.Error(logPrefix, "calling the ProxyFactory", err.Error())
 			continue
@@ -129,6 +156,27 @@ func (r chiRouter) registerKrakendEndpoints(endpoints []*config.EndpointConfig)
 	}
 }
 
+// registerVicgEndpoints 使用VicgFactory构建并注册所有接口, 任一接口失败时返回错误.
+func (r chiRouter) registerVicgEndpoints(cfg config.ServiceConfig) error {
+	infra, err := r.cfg.VicgFactory.BuildInfra(r.ctx, cfg.ExtraConfig)
+	if err != nil {
+		return err
+	}
+	if err = router.ValidateEndpoints(r.cfg.VicgFactory, cfg.Endpoints, r.cfg.Logger, logPrefix); err != nil {
+		return err
+	}
+	for _, c := range cfg.Endpoints {
+		router.MergeConfig(cfg, c)
+		proxyStack, err := router.NewProxy(r.ctx, r.cfg.VicgFactory, c, infra)
+		if err != nil {
+			r.cfg.Logger.Error(logPrefix, "calling the VicgFactory", err.Error())
+			return err
+		}
+		r.registerKrakendEndpoint(c.Method, c, r.cfg.HandlerFactory(c, proxyStack), len(c.Backend))
+	}
+	return nil
+}
+
 func (r chiRouter) registerKrakendEndpoint(method string, endpoint *config.EndpointConfig, handler http.HandlerFunc, totBackends int) {
 	method = strings.ToTitle(method)
 	path := endpoint.Endpoint
@@ -4,7 +4,9 @@ package gin
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/textproto"
 
 	"github.com/gin-gonic/gin"
@@ -47,7 +49,19 @@ func CustomErrorEndpointHandler(logger logging.Logger, errF server.ToHTTPError)
 
 			c.Header(core.KrakendHeaderName, core.KrakendHeaderValue)
 
-			response, err := prxy(requestCtx, requestGenerator(c, configuration.QueryString))
+			if configuration.MaxBodySize > 0 && c.Request.Body != nil && c.Request.Body != http.NoBody {
+				c.Request.Body = proxy.LimitBody(c.Request.Body, configuration.MaxBodySize)
+			}
+			body, limited := c.Request.Body.(*proxy.LimitedBody)
+
+			var response *proxy.Response
+			var err error
+			if limited && c.Request.ContentLength > body.Limit() {
+				// 根据Content-Length提前拒绝, 不读取请求报文
+				err = &proxy.BodyTooLargeError{Limit: body.Limit()}
+			} else {
+				response, err = prxy(requestCtx, requestGenerator(c, configuration.QueryString))
+			}
 
 			select {
 			case <-requestCtx.Done():
@@ -57,6 +71,18 @@ func CustomErrorEndpointHandler(logger logging.Logger, errF server.ToHTTPError)
 			default:
 			}
 
+			// 读取请求报文时超限, 无论代理如何处理该错误都返回413
+			if limited && body.Exceeded() {
+				response, err = nil, &proxy.BodyTooLargeError{Limit: body.Limit()}
+			}
+
+			if response == nil && err != nil {
+				var re renderableError
+				if errors.As(err, &re) {
+					response = re.ToResponse(c.Request.URL.Path)
+				}
+			}
+
 			complete := server.HeaderIncompleteResponseValue
 
 			if response != nil {
@@ -123,7 +149,8 @@ func NewRequest(headersToSend []string) func(*gin.Context, []string) *proxy.Requ
 
 		for _, k := range headersToSend {
 			if k == requestParamsAsterisk {
-				headers = c.Request.Header
+				// 复制请求头, 避免修改原始请求
+				headers = proxy.CloneRequestHeaders(c.Request.Header)
 
 				break
 			}
@@ -182,6 +209,12 @@ type responseError interface {
 	StatusCode() int
 }
 
+// renderableError is an error able to render itself as a response, like vicg.PluginError
+type renderableError interface {
+	responseError
+	ToResponse(requestURL string) *proxy.Response
+}
+
 type multiError interface {
 	error
 	Errors() []error
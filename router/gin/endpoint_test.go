@@ -204,6 +204,39 @@ func (d dummyEncodedResponseError) Encoding() string {
 	return d.encoding
 }
 
+func TestEndpointHandler_errored_renderableError(t *testing.T) {
+	p := func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+		return nil, dummyRenderableError{dummyResponseError{err: "dummy", status: http.StatusUnauthorized}}
+	}
+	endpointHandlerTestCase{
+		timeout:            10,
+		proxy:              p,
+		method:             "GET",
+		expectedBody:       `{"ResponseStatusObject":{"RequestURL":"/_gin_endpoint/a","StatusCode":4,"StatusString":"dummy","Id":"","LocalTime":""}}`,
+		expectedCache:      "",
+		expectedContent:    proxy.ViidContentType,
+		expectedHeaders:    map[string][]string{"X-Error-Code": {"DUMMY"}},
+		expectedStatusCode: http.StatusUnauthorized,
+		completed:          false,
+	}.test(t)
+	time.Sleep(5 * time.Millisecond)
+}
+
+type dummyRenderableError struct {
+	dummyResponseError
+}
+
+func (d dummyRenderableError) ToResponse(requestURL string) *proxy.Response {
+	resp := &proxy.Response{
+		Metadata: proxy.Metadata{
+			Headers:    map[string][]string{"Content-Type": {proxy.ViidContentType}, "X-Error-Code": {"DUMMY"}},
+			StatusCode: d.status,
+		},
+	}
+	resp.SetResponseStatus(proxy.ResponseStatus{RequestURL: requestURL, StatusCode: proxy.ViidStatusInvalidOperation, StatusString: d.err})
+	return resp
+}
+
 func TestEndpointHandler_incompleteAndErrored(t *testing.T) {
 	p := func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
 		return &proxy.Response{
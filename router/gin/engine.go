@@ -17,7 +17,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/luraproject/lura/v2/config"
 	"github.com/luraproject/lura/v2/core"
+	lurahealth "github.com/luraproject/lura/v2/health"
 	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/proxy"
 	"github.com/luraproject/lura/v2/transport/http/server"
 )
 
@@ -28,6 +30,8 @@ type EngineOptions struct {
 	Writer    io.Writer
 	Formatter gin.LogFormatter
 	Health    <-chan string
+	// MaxBodySize 所有请求报文的最大字节数, 为0时不限制. 接口可以通过EndpointConfig.MaxBodySize覆盖
+	MaxBodySize int64
 }
 
 // NewEngine returns an initialized gin engine
@@ -70,6 +74,9 @@ func NewEngine(cfg config.ServiceConfig, opt EngineOptions) *gin.Engine {
 				engine.MaxMultipartMemory = ginOptions.MaxMultipartMemory
 				engine.RemoveExtraSlash = ginOptions.RemoveExtraSlash
 				engine.UseH2C = ginOptions.UseH2C
+				if ginOptions.MaxBodySize > 0 {
+					opt.MaxBodySize = ginOptions.MaxBodySize
+				}
 				paths = ginOptions.LoggerSkipPaths
 
 				returnErrorMsg = ginOptions.ReturnErrorMsg
@@ -96,6 +103,10 @@ func NewEngine(cfg config.ServiceConfig, opt EngineOptions) *gin.Engine {
 	}
 	engine.Use(gin.Recovery())
 
+	if opt.MaxBodySize > 0 {
+		engine.Use(bodyLimit(opt.MaxBodySize))
+	}
+
 	if !ginOptions.DisablePathDecoding {
 		engine.Use(paramChecker())
 	}
@@ -128,7 +139,21 @@ func healthEndpoint(health <-chan string) func(*gin.Context) {
 		mu.RLock()
 		defer mu.RUnlock()
 
-		c.JSON(200, gin.H{"status": "ok", "agents": reports, "now": time.Now().String()})
+		h := gin.H{"status": "ok", "agents": reports, "now": time.Now().String()}
+		if report := lurahealth.Report(); len(report) != 0 {
+			h[lurahealth.ReportsKey] = report
+		}
+		c.JSON(200, h)
+	}
+}
+
+// bodyLimit 限制请求报文的最大字节数. 超限的请求由接口处理器返回413,
+// 以便配置了EndpointConfig.MaxBodySize的接口使用自己的限制.
+func bodyLimit(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body != nil && c.Request.Body != http.NoBody {
+			c.Request.Body = proxy.LimitBody(c.Request.Body, limit)
+		}
 	}
 }
 
@@ -238,6 +263,9 @@ type engineConfiguration struct {
 
 	// UseH2C enable h2c support.
 	UseH2C bool `json:"use_h2c"`
+
+	// MaxBodySize 所有请求报文的最大字节数, 设置后覆盖EngineOptions.MaxBodySize
+	MaxBodySize int64 `json:"max_body_size"`
 }
 
 var returnErrorMsg bool
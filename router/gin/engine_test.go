@@ -2,13 +2,19 @@ package gin
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/luraproject/lura/v2/config"
+	lurahealth "github.com/luraproject/lura/v2/health"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/proxy"
 )
 
 func TestNewEngine_contextIsPropagated(t *testing.T) {
@@ -87,3 +93,87 @@ func TestNewEngine_paramsAreChecked(t *testing.T) {
 	assertResponse("/user/123%3f/public", http.StatusBadRequest, "error: encoded url params")
 	assertResponse("/user/123%23/public", http.StatusBadRequest, "error: encoded url params")
 }
+
+func TestNewEngine_healthReport(t *testing.T) {
+	lurahealth.Register("sessions", func() interface{} { return []string{"31010000001190000001"} })
+	defer lurahealth.Unregister("sessions")
+
+	engine := NewEngine(config.ServiceConfig{}, EngineOptions{})
+
+	req, _ := http.NewRequest("GET", "/__health", http.NoBody)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", w.Code)
+	}
+	var report map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	reports, _ := report[lurahealth.ReportsKey].(map[string]interface{})
+	sessions, ok := reports["sessions"].([]interface{})
+	if !ok || len(sessions) != 1 || report["status"] != "ok" {
+		t.Errorf("unexpected report: %s", w.Body.String())
+	}
+	if _, ok := report["agents"]; !ok {
+		t.Errorf("the async agents are missing: %s", w.Body.String())
+	}
+}
+
+func TestNewEngine_healthReportReservedName(t *testing.T) {
+	lurahealth.Register("status", func() interface{} { return "broken" })
+	defer lurahealth.Unregister("status")
+
+	engine := NewEngine(config.ServiceConfig{}, EngineOptions{})
+
+	req, _ := http.NewRequest("GET", "/__health", http.NoBody)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	var report map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report["status"] != "ok" {
+		t.Errorf("a report overwrote the built-in status: %s", w.Body.String())
+	}
+}
+
+func TestNewEngine_maxBodySize(t *testing.T) {
+	engine := NewEngine(config.ServiceConfig{}, EngineOptions{Logger: logging.NoOp, Writer: io.Discard, MaxBodySize: 8})
+	readBody := func(cfg *config.EndpointConfig) gin.HandlerFunc {
+		return EndpointHandler(cfg, func(_ context.Context, req *proxy.Request) (*proxy.Response, error) {
+			if _, err := io.ReadAll(req.Body); err != nil {
+				return nil, err
+			}
+			return &proxy.Response{IsComplete: true, Data: map[string]interface{}{"ok": true}}, nil
+		})
+	}
+	engine.POST("/global", readBody(&config.EndpointConfig{Timeout: time.Second}))
+	engine.POST("/endpoint", readBody(&config.EndpointConfig{Timeout: time.Second, MaxBodySize: 16}))
+
+	for _, tc := range []struct {
+		path      string
+		body      string
+		streaming bool
+		status    int
+	}{
+		{"/global", "12345678", false, http.StatusOK},
+		{"/global", "123456789", false, http.StatusRequestEntityTooLarge},
+		{"/global", "123456789", true, http.StatusRequestEntityTooLarge},
+		{"/endpoint", "123456789", false, http.StatusOK},
+		{"/endpoint", "12345678901234567", true, http.StatusRequestEntityTooLarge},
+	} {
+		req, _ := http.NewRequest("POST", tc.path, strings.NewReader(tc.body))
+		if tc.streaming {
+			// 未知长度的报文只能在读取时检查
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Errorf("%s %s: unexpected status code %d", tc.path, tc.body, w.Code)
+		}
+	}
+}
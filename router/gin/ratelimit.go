@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gin
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/ratelimit"
+)
+
+// NewRateLimitHandlerFactory 为EndpointConfig的ExtraConfig中配置了限流的接口添加令牌桶限流,
+// 被限流的请求不会调用代理, 直接返回带有Retry-After头的429应答. 限流配置错误时所有请求返回500.
+func NewRateLimitHandlerFactory(next HandlerFactory, logger logging.Logger) HandlerFactory {
+	return func(cfg *config.EndpointConfig, p proxy.Proxy) gin.HandlerFunc {
+		handler := next(cfg, p)
+		rl, err := ratelimit.GetConfig(cfg.ExtraConfig)
+		if err == ratelimit.ErrNoConfigFound {
+			return handler
+		}
+		if err != nil {
+			// 路由器注册接口之前已经校验过限流配置, 这里只是兜底: 配置错误时拒绝所有请求, 而不是取消限流
+			logger.Error(fmt.Sprintf("[ENDPOINT: %s][RateLimit] %s", cfg.Endpoint, err.Error()))
+			return func(c *gin.Context) {
+				c.AbortWithStatus(http.StatusInternalServerError)
+			}
+		}
+
+		limiter := ratelimit.NewLimiter(rl.MaxRate, rl.Capacity, rl.MaxKeys)
+		render := getRender(cfg)
+		return func(c *gin.Context) {
+			var key string
+			switch rl.Strategy {
+			case ratelimit.StrategyIP:
+				key = proxy.ClientIP(c.Request.RemoteAddr, c.Request.Header, rl.TrustedProxies)
+			case ratelimit.StrategyHeader:
+				key = c.GetHeader(rl.Key)
+			}
+			if ok, wait := limiter.Allow(key); !ok {
+				response := (&proxy.RateLimitError{RetryAfter: wait}).ToResponse(c.Request.URL.Path)
+				response.ModifyGinHeader(c)
+				render(c, response)
+				c.Abort()
+				return
+			}
+			handler(c)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/ratelimit"
+)
+
+func TestNewRateLimitHandlerFactory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.EndpointConfig{
+		Endpoint: "/VIID/Faces",
+		Method:   "POST",
+		Timeout:  time.Second,
+		ExtraConfig: config.ExtraConfig{
+			ratelimit.Namespace: map[string]interface{}{"max_rate": 1, "strategy": "header"},
+		},
+	}
+	calls := 0
+	p := func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+		calls++
+		return &proxy.Response{IsComplete: true, Data: map[string]interface{}{"a": 1}, Metadata: proxy.Metadata{StatusCode: http.StatusOK}}, nil
+	}
+	engine := gin.New()
+	engine.POST(cfg.Endpoint, NewRateLimitHandlerFactory(EndpointHandler, logging.NoOp)(cfg, p))
+
+	do := func(id string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", cfg.Endpoint, http.NoBody)
+		req.Header.Set("User-Identify", id)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("a"); w.Code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", w.Code)
+	}
+	if w := do("b"); w.Code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", w.Code)
+	}
+	w := do("a")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("unexpected response: %d %v", w.Code, w.Header())
+	}
+	if calls != 2 {
+		t.Errorf("unexpected number of proxy calls: %d", calls)
+	}
+}
+
+func TestNewRateLimitHandlerFactory_invalidConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.EndpointConfig{
+		Endpoint: "/VIID/Faces",
+		Method:   "POST",
+		ExtraConfig: config.ExtraConfig{
+			ratelimit.Namespace: map[string]interface{}{"max_rate": -1},
+		},
+	}
+	p := func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+		t.Error("the proxy should not be called")
+		return nil, nil
+	}
+	engine := gin.New()
+	engine.POST(cfg.Endpoint, NewRateLimitHandlerFactory(EndpointHandler, logging.NoOp)(cfg, p))
+
+	req, _ := http.NewRequest("POST", cfg.Endpoint, http.NoBody)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("unexpected status code: %d", w.Code)
+	}
+}
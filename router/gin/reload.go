@@ -0,0 +1,296 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/router"
+)
+
+// DefaultReloadInterval 插件目录的默认轮询间隔.
+const DefaultReloadInterval = 3 * time.Second
+
+// WithPluginReload 开启插件配置文件热加载: 轮询dir目录, 文件变化时重建对应接口的处理管道.
+// interval为0时使用DefaultReloadInterval.
+func WithPluginReload(dir string, interval time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.PluginDir = dir
+		cfg.ReloadInterval = interval
+	}
+}
+
+// endpointHandler 可原子替换的接口处理函数.
+// gin不支持注销路由, 因此注册的是endpointHandler.handle, 热加载时替换其内部的处理函数.
+// cancel结束当前代理的ctx, 在代理被替换或停用时调用, 停止其后台任务.
+type endpointHandler struct {
+	handler     atomic.Value // gin.HandlerFunc
+	cancel      context.CancelFunc
+	fingerprint string
+	source      string
+}
+
+func (e *endpointHandler) handle(c *gin.Context) {
+	e.handler.Load().(gin.HandlerFunc)(c)
+}
+
+// swap 替换处理函数, cancel为新的代理的ctx的取消函数. 原有的代理被释放.
+func (e *endpointHandler) swap(h gin.HandlerFunc, cancel context.CancelFunc) {
+	e.handler.Store(h)
+	if e.cancel != nil {
+		e.cancel()
+	}
+	e.cancel = cancel
+}
+
+// disable 停用接口: 定义接口的插件文件或其中的接口配置被删除后返回404.
+// 指纹被清空, 接口配置重新出现时总会重建.
+func (e *endpointHandler) disable() {
+	e.swap(func(c *gin.Context) { c.AbortWithStatus(http.StatusNotFound) }, nil)
+	e.fingerprint = ""
+}
+
+// handlerRegistry 已注册接口的处理函数, 以"METHOD path"为键.
+type handlerRegistry struct {
+	mu       *sync.Mutex
+	handlers map[string]*endpointHandler
+}
+
+func newHandlerRegistry() handlerRegistry {
+	return handlerRegistry{
+		mu:       new(sync.Mutex),
+		handlers: map[string]*endpointHandler{},
+	}
+}
+
+func endpointKey(method, path string) string {
+	return strings.ToTitle(method) + " " + path
+}
+
+// add 登记接口处理函数, 返回供gin注册的处理函数. cancel为代理的ctx的取消函数.
+// 指纹计算失败时为空, 下次热加载时总会重建该接口.
+func (r handlerRegistry) add(e *config.EndpointConfig, h gin.HandlerFunc, cancel context.CancelFunc) gin.HandlerFunc {
+	fingerprint, _ := endpointFingerprint(e)
+	eh := &endpointHandler{fingerprint: fingerprint, source: e.Source}
+	eh.swap(h, cancel)
+
+	r.mu.Lock()
+	r.handlers[endpointKey(e.Method, e.Endpoint)] = eh
+	r.mu.Unlock()
+
+	return eh.handle
+}
+
+func (r handlerRegistry) get(method, path string) (*endpointHandler, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	eh, ok := r.handlers[endpointKey(method, path)]
+	return eh, ok
+}
+
+// fromSource 返回由插件文件source定义的接口, 以"METHOD path"为键.
+func (r handlerRegistry) fromSource(source string) map[string]*endpointHandler {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := map[string]*endpointHandler{}
+	for key, eh := range r.handlers {
+		if eh.source == source {
+			res[key] = eh
+		}
+	}
+	return res
+}
+
+// endpointFingerprint 接口配置的指纹, 用于判断接口配置是否发生变化.
+func endpointFingerprint(e *config.EndpointConfig) (string, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return string(sum[:]), nil
+}
+
+// pluginWatcher 轮询插件目录, 在插件配置文件变化时重建对应接口的处理管道并原子替换.
+// 解析或构建失败的文件整体被拒绝, 原有的处理管道继续提供服务.
+type pluginWatcher struct {
+	r        ginRouter
+	cfg      config.ServiceConfig
+	infra    interface{}
+	dir      string
+	interval time.Duration
+	files    map[string][sha256.Size]byte
+}
+
+func newPluginWatcher(r ginRouter, cfg config.ServiceConfig, infra interface{}) *pluginWatcher {
+	interval := r.cfg.ReloadInterval
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	w := &pluginWatcher{
+		r:        r,
+		cfg:      cfg,
+		infra:    infra,
+		dir:      r.cfg.PluginDir,
+		interval: interval,
+		files:    map[string][sha256.Size]byte{},
+	}
+	w.files, _ = w.scan()
+	return w
+}
+
+// watch 周期性检查插件目录, 直到ctx结束.
+func (w *pluginWatcher) watch(ctx context.Context) {
+	w.r.cfg.Logger.Info(logPrefix, "Watching the plugin folder", w.dir)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// scan 计算目录下每个插件配置文件的摘要.
+// 暂时无法读取的文件保留上次的摘要, 不会被当作已删除而停用其中的接口.
+func (w *pluginWatcher) scan() (map[string][sha256.Size]byte, error) {
+	fileList, err := config.ListPluginFiles(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][sha256.Size]byte, len(fileList))
+	for _, name := range fileList {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			if sum, ok := w.files[name]; ok {
+				w.r.cfg.Logger.Warning(logPrefix, "Reading the plugin file", name+":", err.Error(), "Keeping its endpoints")
+				files[name] = sum
+			}
+			continue
+		}
+		files[name] = sha256.Sum256(b)
+	}
+	return files, nil
+}
+
+func (w *pluginWatcher) check() {
+	files, err := w.scan()
+	if err != nil {
+		w.r.cfg.Logger.Error(logPrefix, "Scanning the plugin folder:", err.Error())
+		return
+	}
+	for name, sum := range files {
+		if old, ok := w.files[name]; ok && old == sum {
+			continue
+		}
+		if err := w.reload(name); err != nil {
+			w.r.cfg.Logger.Error(logPrefix, "Rejecting the plugin file", name+":", err.Error())
+		}
+	}
+	for name := range w.files {
+		if _, ok := files[name]; !ok {
+			w.disable(name, nil)
+		}
+	}
+	w.files = files
+}
+
+// disable 停用由插件文件name定义, 但不在keep中的接口.
+func (w *pluginWatcher) disable(name string, keep map[string]struct{}) {
+	for key, eh := range w.r.handlers.fromSource(name) {
+		if _, ok := keep[key]; ok {
+			continue
+		}
+		eh.disable()
+		w.r.cfg.Logger.Warning(logPrefix, "[ENDPOINT:", key, "] Removed from", name+". Disabling it")
+	}
+}
+
+// reload 重建文件中发生变化的接口的处理管道. 只有全部接口都构建成功时才会替换.
+// 文件中不再定义的接口被停用.
+func (w *pluginWatcher) reload(name string) error {
+	endpoints, err := config.ReadPluginFile(name)
+	if err != nil {
+		return err
+	}
+	sc := config.ServiceConfig{Endpoints: endpoints}
+	sc.NormalizeEndpoints()
+	if err = w.r.validateEndpoints(sc.Endpoints); err != nil {
+		return err
+	}
+
+	type pending struct {
+		handler     *endpointHandler
+		fingerprint string
+		h           gin.HandlerFunc
+		cancel      context.CancelFunc
+	}
+	updates := []pending{}
+	// 构建失败时释放已经创建的代理
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		for _, u := range updates {
+			u.cancel()
+		}
+	}()
+	keep := make(map[string]struct{}, len(sc.Endpoints))
+	owned := make([]*endpointHandler, 0, len(sc.Endpoints))
+	for _, e := range sc.Endpoints {
+		router.MergeConfig(w.cfg, e)
+		eh, ok := w.r.handlers.get(e.Method, e.Endpoint)
+		if !ok {
+			w.r.cfg.Logger.Warning(logPrefix, "[ENDPOINT:", e.Endpoint, "] New endpoints require a restart. Ignoring", e.Method)
+			continue
+		}
+		keep[endpointKey(e.Method, e.Endpoint)] = struct{}{}
+		fingerprint, err := endpointFingerprint(e)
+		if err != nil {
+			return err
+		}
+		// 接口可能从其他的插件文件移动到这里, 文件被接受后才归属于它
+		owned = append(owned, eh)
+		if fingerprint == eh.fingerprint {
+			continue
+		}
+		ctx, cancel := context.WithCancel(w.r.ctx)
+		var p proxy.Proxy
+		p, err = router.NewProxy(ctx, w.r.cfg.getVicgFactory(), e, w.infra)
+		if err != nil {
+			cancel()
+			return err
+		}
+		updates = append(updates, pending{eh, fingerprint, w.r.cfg.HandlerFactory(e, p), cancel})
+	}
+
+	committed = true
+	for _, eh := range owned {
+		eh.source = name
+	}
+	for _, u := range updates {
+		u.handler.swap(u.h, u.cancel)
+		u.handler.fingerprint = u.fingerprint
+	}
+	w.disable(name, keep)
+	if len(updates) > 0 {
+		w.r.cfg.Logger.Info(logPrefix, "Reloaded", len(updates), "endpoint(s) from", name)
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package gin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/proxy"
+)
+
+type pluginIndexFactory struct{}
+
+func (pluginIndexFactory) New(cfg *config.EndpointConfig, _ interface{}) (proxy.Proxy, error) {
+	if len(cfg.Plugins) == 0 {
+		return nil, errors.New("no plugins")
+	}
+	index := cfg.Plugins[0].Index
+	if cfg.Plugins[0].Name == "broken" {
+		return nil, errors.New("broken plugin")
+	}
+	return func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+		return &proxy.Response{Data: map[string]interface{}{"index": index}, IsComplete: true}, nil
+	}, nil
+}
+
+func (pluginIndexFactory) BuildInfra(_ context.Context, _ config.ExtraConfig) (interface{}, error) {
+	return nil, nil
+}
+
+func TestPluginWatcher_reload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "plugin.json")
+	writePluginFile := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writePluginFile(`{"Plugin":[{"Endpoint":"/some","Method":"POST","Plugins":[{"Name":"a","Index":1}]}]}`)
+
+	endpoints, err := config.ReadPluginDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceCfg := config.ServiceConfig{Endpoints: endpoints, Timeout: 10 * time.Second}
+	serviceCfg.NormalizeEndpoints()
+
+	engine := gin.New()
+	r := NewFactory(Config{
+		Engine:         engine,
+		HandlerFactory: EndpointHandler,
+		VicgFactory:    pluginIndexFactory{},
+		Logger:         logging.NoOp,
+		PluginDir:      dir,
+	}).New().(ginRouter)
+	if err := r.registerKrakendEndpoints(engine.Group("/"), serviceCfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	w := newPluginWatcher(r, serviceCfg, nil)
+
+	assertBody := func(want string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, "/some", http.NoBody)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		body, _ := io.ReadAll(rec.Result().Body)
+		if string(body) != want {
+			t.Errorf("unexpected body. have: %s, want: %s", string(body), want)
+		}
+	}
+
+	assertBody(`{"index":1}`)
+
+	writePluginFile(`{"Plugin":[{"Endpoint":"/some","Method":"POST","Plugins":[{"Name":"a","Index":2}]}]}`)
+	w.check()
+	assertBody(`{"index":2}`)
+
+	writePluginFile(`{"Plugin":[{"Endpoint":"/some","Method":"POST","Plugins":[{"Name":"a","Index":3`)
+	w.check()
+	assertBody(`{"index":2}`)
+
+	writePluginFile(`{"Plugin":[{"Endpoint":"/some","Method":"POST","Plugins":[{"Name":"broken","Index":4}]}]}`)
+	w.check()
+	assertBody(`{"index":2}`)
+
+	writePluginFile(`{"Plugin":[{"Endpoint":"/some","Method":"POST","Plugins":[{"Name":"a","Index":5}]}]}`)
+	w.check()
+	assertBody(`{"index":5}`)
+}
+
+func TestPluginWatcher_removed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "plugin.json")
+	writePluginFile := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writePluginFile(`{"Plugin":[{"Endpoint":"/a","Method":"POST","Plugins":[{"Name":"a","Index":1}]},` +
+		`{"Endpoint":"/b","Method":"POST","Plugins":[{"Name":"a","Index":2}]}]}`)
+
+	endpoints, err := config.ReadPluginDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceCfg := config.ServiceConfig{Endpoints: endpoints, Timeout: 10 * time.Second}
+	serviceCfg.NormalizeEndpoints()
+
+	engine := gin.New()
+	r := NewFactory(Config{
+		Engine:         engine,
+		HandlerFactory: EndpointHandler,
+		VicgFactory:    pluginIndexFactory{},
+		Logger:         logging.NoOp,
+		PluginDir:      dir,
+	}).New().(ginRouter)
+	if err := r.registerKrakendEndpoints(engine.Group("/"), serviceCfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	w := newPluginWatcher(r, serviceCfg, nil)
+
+	assertStatus := func(path string, want int) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, path, http.NoBody)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: unexpected status code. have: %d, want: %d", path, rec.Code, want)
+		}
+	}
+
+	// 从文件中删除的接口被停用
+	writePluginFile(`{"Plugin":[{"Endpoint":"/a","Method":"POST","Plugins":[{"Name":"a","Index":1}]}]}`)
+	w.check()
+	assertStatus("/a", http.StatusOK)
+	assertStatus("/b", http.StatusNotFound)
+
+	// 删除文件后其中所有的接口被停用
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	w.check()
+	assertStatus("/a", http.StatusNotFound)
+
+	// 文件恢复后重建接口
+	writePluginFile(`{"Plugin":[{"Endpoint":"/a","Method":"POST","Plugins":[{"Name":"a","Index":1}]}]}`)
+	w.check()
+	assertStatus("/a", http.StatusOK)
+}
+
+type lifetimeFactory struct {
+	pluginIndexFactory
+	ctxs map[string][]context.Context
+}
+
+func (f lifetimeFactory) NewWithContext(ctx context.Context, cfg *config.EndpointConfig, infra interface{}) (proxy.Proxy, error) {
+	f.ctxs[cfg.Endpoint] = append(f.ctxs[cfg.Endpoint], ctx)
+	return f.New(cfg, infra)
+}
+
+func TestPluginWatcher_proxyLifetime(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "plugin.json")
+	writePluginFile := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writePluginFile(`{"Plugin":[{"Endpoint":"/a","Method":"POST","Plugins":[{"Name":"a","Index":1}]},` +
+		`{"Endpoint":"/b","Method":"POST","Plugins":[{"Name":"a","Index":2}]}]}`)
+
+	endpoints, err := config.ReadPluginDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceCfg := config.ServiceConfig{Endpoints: endpoints, Timeout: 10 * time.Second}
+	serviceCfg.NormalizeEndpoints()
+
+	engine := gin.New()
+	factory := lifetimeFactory{ctxs: map[string][]context.Context{}}
+	r := NewFactory(Config{
+		Engine:         engine,
+		HandlerFactory: EndpointHandler,
+		VicgFactory:    factory,
+		Logger:         logging.NoOp,
+		PluginDir:      dir,
+	}).New().(ginRouter)
+	if err := r.registerKrakendEndpoints(engine.Group("/"), serviceCfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	w := newPluginWatcher(r, serviceCfg, nil)
+
+	assertDone := func(endpoint string, done ...bool) {
+		t.Helper()
+		ctxs := factory.ctxs[endpoint]
+		if len(ctxs) != len(done) {
+			t.Fatalf("%s: unexpected number of proxies: %d", endpoint, len(ctxs))
+		}
+		for i, ctx := range ctxs {
+			if (ctx.Err() != nil) != done[i] {
+				t.Errorf("%s: unexpected state of the proxy #%d: %v", endpoint, i, ctx.Err())
+			}
+		}
+	}
+
+	// 替换后原有的代理被释放
+	writePluginFile(`{"Plugin":[{"Endpoint":"/a","Method":"POST","Plugins":[{"Name":"a","Index":3}]},` +
+		`{"Endpoint":"/b","Method":"POST","Plugins":[{"Name":"a","Index":2}]}]}`)
+	w.check()
+	assertDone("/a", true, false)
+	assertDone("/b", false)
+
+	// 构建失败时新建的代理被释放, 原有的代理继续使用
+	writePluginFile(`{"Plugin":[{"Endpoint":"/a","Method":"POST","Plugins":[{"Name":"a","Index":4}]},` +
+		`{"Endpoint":"/b","Method":"POST","Plugins":[{"Name":"broken","Index":2}]}]}`)
+	w.check()
+	assertDone("/a", true, false, true)
+	assertDone("/b", false, true)
+
+	// 停用的接口的代理被释放
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	w.check()
+	assertDone("/a", true, true, true)
+	assertDone("/b", true, true)
+}
+
+func TestPluginWatcher_sources(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	fileA := filepath.Join(dir, "a.json")
+	fileB := filepath.Join(dir, "b.json")
+	writePluginFile := func(file, content string) {
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writePluginFile(fileA, `{"Plugin":[{"Endpoint":"/a","Method":"POST","Plugins":[{"Name":"a","Index":1}]},`+
+		`{"Endpoint":"/b","Method":"POST","Plugins":[{"Name":"a","Index":2}]}]}`)
+
+	endpoints, err := config.ReadPluginDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceCfg := config.ServiceConfig{Endpoints: endpoints, Timeout: 10 * time.Second}
+	serviceCfg.NormalizeEndpoints()
+	serviceCfg.Endpoints = append(serviceCfg.Endpoints, &config.EndpointConfig{
+		Endpoint: "/c",
+		Method:   "TRACE",
+		Plugins:  []*config.PluginConfig{{Name: "a", Index: 3}},
+	})
+
+	engine := gin.New()
+	r := NewFactory(Config{
+		Engine:         engine,
+		HandlerFactory: EndpointHandler,
+		VicgFactory:    pluginIndexFactory{},
+		Logger:         logging.NoOp,
+		PluginDir:      dir,
+	}).New().(ginRouter)
+	if err := r.registerKrakendEndpoints(engine.Group("/"), serviceCfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	w := newPluginWatcher(r, serviceCfg, nil)
+
+	// 不支持的方法不会登记
+	if _, ok := r.handlers.get("TRACE", "/c"); ok {
+		t.Error("the unsupported endpoint should not be registered")
+	}
+
+	assertStatus := func(path string, want int) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, path, http.NoBody)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: unexpected status code. have: %d, want: %d", path, rec.Code, want)
+		}
+	}
+
+	// 被拒绝的文件不会取得接口
+	writePluginFile(fileB, `{"Plugin":[{"Endpoint":"/a","Method":"POST","Plugins":[{"Name":"broken","Index":1}]}]}`)
+	w.check()
+	if eh, _ := r.handlers.get("POST", "/a"); eh.source != fileA {
+		t.Errorf("unexpected source: %s", eh.source)
+	}
+
+	// 暂时无法读取的文件中的接口继续提供服务
+	if err := os.Remove(fileA); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "missing"), fileA); err != nil {
+		t.Fatal(err)
+	}
+	w.check()
+	assertStatus("/a", http.StatusOK)
+	assertStatus("/b", http.StatusOK)
+
+	// 从原来的文件中删除接口后被停用
+	if err := os.Remove(fileA); err != nil {
+		t.Fatal(err)
+	}
+	writePluginFile(fileA, `{"Plugin":[{"Endpoint":"/b","Method":"POST","Plugins":[{"Name":"a","Index":2}]}]}`)
+	w.check()
+	assertStatus("/a", http.StatusNotFound)
+	assertStatus("/b", http.StatusOK)
+}
@@ -22,6 +22,9 @@ const NEGOTIATE = "negotiate"
 const XML = "xml"
 const YAML = "yaml"
 
+// ViidStatusList 渲染GA/T 1400应答状态列表的render名称, 见viidStatusListRender
+const ViidStatusList = "viid-status-list"
+
 var (
 	mutex          = &sync.RWMutex{}
 	renderRegister = map[string]Render{
@@ -38,6 +41,7 @@ func init() {
 	// the negotiated render must be registered at the init function in order
 	// to avoid a cyclical dependency
 	renderRegister[NEGOTIATE] = negotiatedRender
+	RegisterRender(ViidStatusList, viidStatusListRender)
 }
 
 // RegisterRender allows clients to register their custom renders
@@ -147,6 +151,17 @@ func yamlRender(c *gin.Context, response *proxy.Response) {
 	c.YAML(status, response.Data)
 }
 
+// viidStatusListRender 应答中记录了对象应答状态时渲染ResponseStatusListObject,
+// 否则按JSON渲染应答数据.
+func viidStatusListRender(c *gin.Context, response *proxy.Response) {
+	if response == nil || len(response.StatusList) == 0 {
+		jsonRender(c, response)
+		return
+	}
+	c.Header("Content-Type", proxy.ViidContentType)
+	c.JSON(c.Writer.Status(), response.ResponseStatusListObject())
+}
+
 func noopRender(c *gin.Context, response *proxy.Response) {
 	if response == nil {
 		c.Status(http.StatusInternalServerError)
@@ -534,3 +534,41 @@ func TestRender_noop_nilResponse(t *testing.T) {
 		t.Error("Unexpected status code:", w.Result().StatusCode)
 	}
 }
+
+func TestRender_viidStatusList(t *testing.T) {
+	p := func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+		resp := &proxy.Response{
+			IsComplete: true,
+			Data:       map[string]interface{}{},
+			Metadata:   proxy.Metadata{StatusCode: http.StatusOK},
+		}
+		resp.AddResponseStatus(proxy.ResponseStatus{RequestURL: "/VIID/Faces", StatusCode: proxy.ViidStatusOK, StatusString: "OK", ID: "1", LocalTime: "20260101000000"})
+		resp.AddResponseStatus(proxy.ResponseStatus{RequestURL: "/VIID/Faces", StatusCode: proxy.ViidStatusInvalidJSONContent, StatusString: "no image", ID: "2", LocalTime: "20260101000000"})
+		return resp, nil
+	}
+	endpoint := &config.EndpointConfig{
+		Timeout:        time.Second,
+		OutputEncoding: ViidStatusList,
+	}
+
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.POST("/VIID/Faces", EndpointHandler(endpoint, p))
+
+	req, _ := http.NewRequest("POST", "http://127.0.0.1:8080/VIID/Faces", http.NoBody)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	expected := `{"ResponseStatusListObject":{"ResponseStatusObject":[` +
+		`{"RequestURL":"/VIID/Faces","StatusCode":0,"StatusString":"OK","Id":"1","LocalTime":"20260101000000"},` +
+		`{"RequestURL":"/VIID/Faces","StatusCode":8,"StatusString":"no image","Id":"2","LocalTime":"20260101000000"}]}}`
+	if w.Code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", w.Code)
+	}
+	if body := w.Body.String(); body != expected {
+		t.Errorf("unexpected body: %s", body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != proxy.ViidContentType {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -30,27 +31,10 @@ type RunServerFunc func(context.Context, config.ServiceConfig, http.Handler) err
 type BuildInfraFunc func(ctx context.Context, cfg config.ExtraConfig) (infra interface{}, err error)
 
 // VicgFactory 用户自定义的代理工厂.
-type VicgFactory interface {
-	// New 基于用户自定义结构创建代理.
-	New(cfg *config.EndpointConfig, infra interface{}) (proxy.Proxy, error)
-	// BuildInfra 基于额外参数构建用户自定义结构.
-	BuildInfra(ctx context.Context, cfg config.ExtraConfig) (infra interface{}, err error)
-}
-
-// factoryToVicgFactory 将proxy.Factory转换为VicgFactory.
-type factoryToVicgFactory struct {
-	factory proxy.Factory
-}
-
-// New 实现VicgFactory接口.
-func (pf factoryToVicgFactory) New(cfg *config.EndpointConfig, infra interface{}) (proxy.Proxy, error) {
-	return pf.factory.New(cfg)
-}
+type VicgFactory = router.VicgFactory
 
-// BuildInfra 实现VicgFactory接口.
-func (pf factoryToVicgFactory) BuildInfra(ctx context.Context, cfg config.ExtraConfig) (infra interface{}, err error) {
-	return nil, nil
-}
+// ConfigValidator VicgFactory可选实现的接口, 注册接口之前校验接口的插件配置.
+type ConfigValidator = router.ConfigValidator
 
 // Config is the struct that collects the parts the router should be builded from
 type Config struct {
@@ -61,6 +45,10 @@ type Config struct {
 	VicgFactory    VicgFactory
 	Logger         logging.Logger
 	RunServer      RunServerFunc
+	// PluginDir 插件配置文件目录, 非空时开启热加载
+	PluginDir string
+	// ReloadInterval 插件目录的轮询间隔
+	ReloadInterval time.Duration
 }
 
 // getVicgFactory 获取VicgFactory, 如果没有设置就获取proxy.Factory.
@@ -68,7 +56,7 @@ func (c *Config) getVicgFactory() VicgFactory {
 	if c.VicgFactory != nil {
 		return c.VicgFactory
 	}
-	return factoryToVicgFactory{factory: c.ProxyFactory}
+	return router.WrapProxyFactory(c.ProxyFactory)
 }
 
 // DefaultFactory returns a gin router factory with the injected proxy factory and logger.
@@ -78,7 +66,7 @@ func DefaultFactory(proxyFactory proxy.Factory, logger logging.Logger) router.Fa
 		Config{
 			Engine:         gin.Default(),
 			Middlewares:    []gin.HandlerFunc{},
-			HandlerFactory: EndpointHandler,
+			HandlerFactory: NewRateLimitHandlerFactory(EndpointHandler, logger),
 			ProxyFactory:   proxyFactory,
 			Logger:         logger,
 			RunServer:      server.RunServer,
@@ -93,7 +81,7 @@ func DefaultVicgFactory(vicgFactory VicgFactory, logger logging.Logger, opts ...
 	cfg := Config{
 		Engine:         gin.Default(),
 		Middlewares:    []gin.HandlerFunc{},
-		HandlerFactory: CustomErrorEndpointHandler(logger, server.DefaultToHTTPError),
+		HandlerFactory: NewRateLimitHandlerFactory(CustomErrorEndpointHandler(logger, server.DefaultToHTTPError), logger),
 		VicgFactory:    vicgFactory,
 		Logger:         logger,
 		RunServer:      server.RunServer,
@@ -125,6 +113,7 @@ func (rf factory) NewWithContext(ctx context.Context) router.Router {
 		ctx:        ctx,
 		runServerF: rf.cfg.RunServer,
 		mu:         new(sync.Mutex),
+		handlers:   newHandlerRegistry(),
 		urlCatalog: urlCatalog{
 			mu:      new(sync.Mutex),
 			catalog: map[string][]string{},
@@ -137,6 +126,7 @@ type ginRouter struct {
 	ctx        context.Context
 	runServerF RunServerFunc
 	mu         *sync.Mutex
+	handlers   handlerRegistry
 	urlCatalog urlCatalog
 }
 
@@ -163,6 +153,10 @@ func (r ginRouter) Run(cfg config.ServiceConfig) {
 		return
 	}
 
+	if r.cfg.PluginDir != "" {
+		go newPluginWatcher(r, cfg, infra).watch(r.ctx)
+	}
+
 	// TODO: remove this ugly hack once https://github.com/gin-gonic/gin/pull/2692 and
 	// https://github.com/gin-gonic/gin/issues/2862 are completely fixed
 	// go r.cfg.Engine.Run("XXXX")
@@ -203,59 +197,62 @@ func (r ginRouter) buildInfra(cfg config.ServiceConfig) (infra interface{}, err
 	return infra, err
 }
 
-// mergeConfig 将ServiceConfig中定义的, 可以在EndpintConfig中使用的参数, 作为EndpointConfig的默认值.
-func mergeConfig(gc config.ServiceConfig, ec *config.EndpointConfig) {
-	if ec.OutputEncoding == "" && gc.OutputEncoding != "" {
-		ec.OutputEncoding = gc.OutputEncoding
-	}
-	if ec.Timeout == 0 && gc.Timeout != 0 {
-		ec.Timeout = gc.Timeout
-	}
-	if ec.CacheTTL == 0 && gc.CacheTTL != 0 {
-		ec.CacheTTL = gc.CacheTTL
-	}
-}
-
 func (r ginRouter) registerKrakendEndpoints(rg *gin.RouterGroup, cfg config.ServiceConfig, infra interface{}) error {
+	if err := r.validateEndpoints(cfg.Endpoints); err != nil {
+		return err
+	}
 	// build and register the pipes and endpoints sequentially
 	for _, c := range cfg.Endpoints {
 		// merge some common global configurations
-		mergeConfig(cfg, c)
-		proxyStack, err := r.cfg.getVicgFactory().New(c, infra)
+		router.MergeConfig(cfg, c)
+		// 代理的ctx在热加载替换或停用接口时结束
+		ctx, cancel := context.WithCancel(r.ctx)
+		proxyStack, err := router.NewProxy(ctx, r.cfg.getVicgFactory(), c, infra)
 		if err != nil {
+			cancel()
 			r.cfg.Logger.Error(logPrefix, "Calling the ProxyFactory", err.Error())
 			return err
 		}
-		r.registerKrakendEndpoint(rg, c.Method, c, r.cfg.HandlerFactory(c, proxyStack), len(c.Backend))
+		r.registerKrakendEndpoint(rg, c.Method, c, r.cfg.HandlerFactory(c, proxyStack), len(c.Backend), cancel)
 	}
 	return nil
 }
 
-func (r ginRouter) registerKrakendEndpoint(rg *gin.RouterGroup, method string, e *config.EndpointConfig, h gin.HandlerFunc, total int) {
+// validateEndpoints 校验所有接口的插件配置.
+func (r ginRouter) validateEndpoints(endpoints []*config.EndpointConfig) error {
+	return router.ValidateEndpoints(r.cfg.getVicgFactory(), endpoints, r.cfg.Logger, logPrefix)
+}
+
+func (r ginRouter) registerKrakendEndpoint(rg *gin.RouterGroup, method string, e *config.EndpointConfig, h gin.HandlerFunc, total int, cancel context.CancelFunc) {
 	method = strings.ToTitle(method)
 	path := e.Endpoint
 	if method != http.MethodGet && total > 1 {
 		if !router.IsValidSequentialEndpoint(e) {
 			r.cfg.Logger.Error(logPrefix, method, "endpoints with sequential proxy enabled only allow a non-GET in the last backend! Ignoring", path)
+			cancel()
 			return
 		}
 	}
 
+	var register func(string, ...gin.HandlerFunc) gin.IRoutes
 	switch method {
 	case http.MethodGet:
-		rg.GET(path, h)
+		register = rg.GET
 	case http.MethodPost:
-		rg.POST(path, h)
+		register = rg.POST
 	case http.MethodPut:
-		rg.PUT(path, h)
+		register = rg.PUT
 	case http.MethodPatch:
-		rg.PATCH(path, h)
+		register = rg.PATCH
 	case http.MethodDelete:
-		rg.DELETE(path, h)
+		register = rg.DELETE
 	default:
 		r.cfg.Logger.Error(logPrefix, "[ENDPOINT:", path, "] Unsupported method", method)
+		cancel()
 		return
 	}
+	// 只有注册到gin的接口才登记, 热加载只会替换这些接口
+	register(path, r.handlers.add(e, h, cancel))
 
 	r.urlCatalog.mu.Lock()
 	defer r.urlCatalog.mu.Unlock()
@@ -29,7 +29,7 @@ func DefaultConfig(pf proxy.Factory, logger logging.Logger) mux.Config {
 	return mux.Config{
 		Engine:         gorillaEngine{gorilla.NewRouter()},
 		Middlewares:    []mux.HandlerMiddleware{},
-		HandlerFactory: mux.CustomEndpointHandler(mux.NewRequestBuilder(gorillaParamsExtractor)),
+		HandlerFactory: mux.NewRateLimitHandlerFactory(mux.CustomEndpointHandler(mux.NewRequestBuilder(gorillaParamsExtractor)), logger),
 		ProxyFactory:   pf,
 		Logger:         logger,
 		DebugPattern:   "/__debug/{params}",
@@ -38,6 +38,19 @@ func DefaultConfig(pf proxy.Factory, logger logging.Logger) mux.Config {
 	}
 }
 
+// DefaultVicgFactory 创建使用用户代理工厂的路由器工厂.
+func DefaultVicgFactory(vf router.VicgFactory, logger logging.Logger) router.Factory {
+	return mux.NewFactory(DefaultVicgConfig(vf, logger))
+}
+
+// DefaultVicgConfig 返回使用用户代理工厂的路由器配置.
+func DefaultVicgConfig(vf router.VicgFactory, logger logging.Logger) mux.Config {
+	cfg := DefaultConfig(nil, logger)
+	cfg.HandlerFactory = mux.NewRateLimitHandlerFactory(mux.VicgEndpointHandler(mux.NewRequestBuilder(gorillaParamsExtractor)), logger)
+	cfg.VicgFactory = vf
+	return cfg
+}
+
 func gorillaParamsExtractor(r *http.Request) map[string]string {
 	params := map[string]string{}
 	title := cases.Title(language.Und)
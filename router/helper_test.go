@@ -6,7 +6,9 @@ import (
 	"testing"
 
 	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
 	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/ratelimit"
 )
 
 func TestIsValidSequentialEndpoint_ok(t *testing.T) {
@@ -138,3 +140,19 @@ func TestIsValidSequentialEndpoint_wrong_all_non_get(t *testing.T) {
 		t.Error("Endpoint expected invalid but receive valid")
 	}
 }
+
+func TestValidateEndpoints_rateLimit(t *testing.T) {
+	endpoints := []*config.EndpointConfig{
+		{Endpoint: "/VIID/Faces", Method: "POST"},
+		{Endpoint: "/VIID/Images", Method: "POST", ExtraConfig: config.ExtraConfig{
+			ratelimit.Namespace: map[string]interface{}{"max_rate": -1},
+		}},
+	}
+	err := ValidateEndpoints(WrapProxyFactory(nil), endpoints, logging.NoOp, "[TEST]")
+	if err == nil || err.Error() != "found 1 invalid endpoint config(s)" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ValidateEndpoints(WrapProxyFactory(nil), endpoints[:1], logging.NoOp, "[TEST]"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -28,7 +28,7 @@ func DefaultConfig(pf proxy.Factory, logger logging.Logger) mux.Config {
 	return mux.Config{
 		Engine:         NewEngine(httptreemux.NewContextMux()),
 		Middlewares:    []mux.HandlerMiddleware{},
-		HandlerFactory: mux.CustomEndpointHandler(mux.NewRequestBuilder(ParamsExtractor)),
+		HandlerFactory: mux.NewRateLimitHandlerFactory(mux.CustomEndpointHandler(mux.NewRequestBuilder(ParamsExtractor)), logger),
 		ProxyFactory:   pf,
 		Logger:         logger,
 		DebugPattern:   "/__debug/{params}",
@@ -36,6 +36,19 @@ func DefaultConfig(pf proxy.Factory, logger logging.Logger) mux.Config {
 	}
 }
 
+// DefaultVicgFactory 创建使用用户代理工厂的路由器工厂.
+func DefaultVicgFactory(vf router.VicgFactory, logger logging.Logger) router.Factory {
+	return mux.NewFactory(DefaultVicgConfig(vf, logger))
+}
+
+// DefaultVicgConfig 返回使用用户代理工厂的路由器配置.
+func DefaultVicgConfig(vf router.VicgFactory, logger logging.Logger) mux.Config {
+	cfg := DefaultConfig(nil, logger)
+	cfg.HandlerFactory = mux.NewRateLimitHandlerFactory(mux.VicgEndpointHandler(mux.NewRequestBuilder(ParamsExtractor)), logger)
+	cfg.VicgFactory = vf
+	return cfg
+}
+
 func ParamsExtractor(r *http.Request) map[string]string {
 	params := map[string]string{}
 	title := cases.Title(language.Und)
@@ -4,6 +4,7 @@ package mux
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -32,6 +33,16 @@ func CustomEndpointHandler(rb RequestBuilder) HandlerFactory {
 
 // CustomEndpointHandlerWithHTTPError returns a HandlerFactory with the received RequestBuilder
 func CustomEndpointHandlerWithHTTPError(rb RequestBuilder, errF server.ToHTTPError) HandlerFactory {
+	return newEndpointHandler(rb, errF, false)
+}
+
+// VicgEndpointHandler 用于VicgFactory创建的代理: 使用应答中的状态码,
+// 并将可渲染的错误(如插件错误)渲染为应答.
+func VicgEndpointHandler(rb RequestBuilder) HandlerFactory {
+	return newEndpointHandler(rb, server.DefaultToHTTPError, true)
+}
+
+func newEndpointHandler(rb RequestBuilder, errF server.ToHTTPError, vicg bool) HandlerFactory {
 	return func(configuration *config.EndpointConfig, prxy proxy.Proxy) http.HandlerFunc {
 		cacheControlHeaderValue := fmt.Sprintf("public, max-age=%d", int(configuration.CacheTTL.Seconds()))
 		isCacheEnabled := configuration.CacheTTL.Seconds() != 0
@@ -53,7 +64,19 @@ func CustomEndpointHandlerWithHTTPError(rb RequestBuilder, errF server.ToHTTPErr
 
 			requestCtx, cancel := context.WithTimeout(r.Context(), configuration.Timeout)
 
-			response, err := prxy(requestCtx, rb(r, configuration.QueryString, headersToSend))
+			if configuration.MaxBodySize > 0 && r.Body != nil && r.Body != http.NoBody {
+				r.Body = proxy.LimitBody(r.Body, configuration.MaxBodySize)
+			}
+			body, limited := r.Body.(*proxy.LimitedBody)
+
+			var response *proxy.Response
+			var err error
+			if limited && r.ContentLength > body.Limit() {
+				// 根据Content-Length提前拒绝, 不读取请求报文
+				err = &proxy.BodyTooLargeError{Limit: body.Limit()}
+			} else {
+				response, err = prxy(requestCtx, rb(r, configuration.QueryString, headersToSend))
+			}
 
 			select {
 			case <-requestCtx.Done():
@@ -63,6 +86,23 @@ func CustomEndpointHandlerWithHTTPError(rb RequestBuilder, errF server.ToHTTPErr
 			default:
 			}
 
+			// 读取请求报文时超限, 无论代理如何处理该错误都返回413
+			if limited && body.Exceeded() {
+				response, err = nil, &proxy.BodyTooLargeError{Limit: body.Limit()}
+			}
+
+			if vicg {
+				if response == nil && err != nil {
+					var re renderableError
+					if errors.As(err, &re) {
+						response = re.ToResponse(r.URL.Path)
+					}
+				}
+				if response != nil && response.Metadata.StatusCode != 0 {
+					w = &statusResponseWriter{ResponseWriter: w, status: response.Metadata.StatusCode}
+				}
+			}
+
 			if response != nil && len(response.Data) > 0 {
 				if response.IsComplete {
 					w.Header().Set(server.CompleteResponseHeaderName, server.HeaderCompleteResponseValue)
@@ -77,6 +117,11 @@ func CustomEndpointHandlerWithHTTPError(rb RequestBuilder, errF server.ToHTTPErr
 			} else {
 				w.Header().Set(server.CompleteResponseHeaderName, server.HeaderIncompleteResponseValue)
 				if err != nil {
+					// 保留可渲染的错误携带的HTTP头, 如限流应答的Retry-After
+					var re renderableError
+					if errors.As(err, &re) {
+						re.ToResponse(r.URL.Path).ModifyHTTPHeader(w.Header())
+					}
 					if t, ok := err.(responseError); ok {
 						http.Error(w, err.Error(), t.StatusCode())
 					} else {
@@ -115,7 +160,8 @@ func NewRequestBuilder(paramExtractor ParamExtractor) RequestBuilder {
 
 		for _, k := range headersToSend {
 			if k == requestParamsAsterisk {
-				headers = r.Header
+				// 复制请求头, 避免修改原始请求
+				headers = proxy.CloneRequestHeaders(r.Header)
 
 				break
 			}
@@ -150,12 +196,16 @@ func NewRequestBuilder(paramExtractor ParamExtractor) RequestBuilder {
 		}
 
 		return &proxy.Request{
+			URL:     r.URL,
 			Path:    r.URL.Path,
 			Method:  r.Method,
 			Query:   query,
 			Body:    r.Body,
 			Params:  params,
 			Headers: headers,
+
+			RemoteAddr:    r.RemoteAddr,
+			ContentLength: r.ContentLength,
 		}
 	}
 }
@@ -165,6 +215,34 @@ type responseError interface {
 	StatusCode() int
 }
 
+// renderableError 可以渲染为应答的错误.
+type renderableError interface {
+	responseError
+	ToResponse(requestURL string) *proxy.Response
+}
+
+// statusResponseWriter 在第一次写入时使用指定的状态码, 使render设置的HTTP头依然生效.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(w.status)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
 // clientIP implements a best effort algorithm to return the real client IP, it parses
 // X-Real-IP and X-Forwarded-For in order to work properly with reverse-proxies such us: nginx or haproxy.
 // Use X-Forwarded-For before X-Real-Ip as nginx uses X-Real-Ip with the proxy's IP.
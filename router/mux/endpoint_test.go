@@ -11,6 +11,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -211,6 +212,48 @@ func TestEndpointHandler_errored_responseError(t *testing.T) {
 	time.Sleep(5 * time.Millisecond)
 }
 
+func TestEndpointHandler_maxBodySize(t *testing.T) {
+	var called int
+	p := func(_ context.Context, req *proxy.Request) (*proxy.Response, error) {
+		called++
+		// 忽略读取错误, 路由器依然要返回413
+		b, _ := io.ReadAll(req.Body)
+		return &proxy.Response{Data: map[string]interface{}{"size": len(b)}, IsComplete: true}, nil
+	}
+	endpoint := &config.EndpointConfig{
+		Method:      "POST",
+		Timeout:     time.Second,
+		MaxBodySize: 8,
+	}
+
+	for _, hf := range []HandlerFactory{EndpointHandler, VicgEndpointHandler(NewRequest)} {
+		handler := hf(endpoint, p)
+		for _, tc := range []struct {
+			name          string
+			body          string
+			contentLength int64
+			status        int
+			called        int
+		}{
+			{name: "ok", body: "12345678", contentLength: 8, status: http.StatusOK, called: 1},
+			{name: "content-length", body: "123456789", contentLength: 9, status: http.StatusRequestEntityTooLarge},
+			{name: "chunked", body: "123456789", contentLength: -1, status: http.StatusRequestEntityTooLarge, called: 1},
+		} {
+			called = 0
+			req := httptest.NewRequest("POST", "/_mux_endpoint", strings.NewReader(tc.body))
+			req.ContentLength = tc.contentLength
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if w.Code != tc.status {
+				t.Errorf("%s: unexpected status code: %d", tc.name, w.Code)
+			}
+			if called != tc.called {
+				t.Errorf("%s: unexpected proxy calls: %d", tc.name, called)
+			}
+		}
+	}
+}
+
 type dummyResponseError struct {
 	err    string
 	status int
@@ -301,3 +344,22 @@ func startMuxServer(handlerFunc http.HandlerFunc) *http.ServeMux {
 	router.Handle("/_mux_endpoint", handlerFunc)
 	return router
 }
+
+func TestNewRequestBuilder(t *testing.T) {
+	req := httptest.NewRequest("POST", "http://127.0.0.1:8081/_mux_endpoint?a=1", bytes.NewBufferString("body"))
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	r := NewRequest(req, []string{"a"}, nil)
+	if r.URL != req.URL || r.Path != "/_mux_endpoint" {
+		t.Errorf("unexpected url: %v", r.URL)
+	}
+	if r.RemoteAddr != "10.0.0.1:1234" {
+		t.Errorf("unexpected remote address: %s", r.RemoteAddr)
+	}
+	if r.ContentLength != 4 {
+		t.Errorf("unexpected content length: %d", r.ContentLength)
+	}
+	if r.Query.Get("a") != "1" {
+		t.Errorf("unexpected query: %v", r.Query)
+	}
+}
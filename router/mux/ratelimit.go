@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package mux
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/ratelimit"
+)
+
+// NewRateLimitHandlerFactory 为EndpointConfig的ExtraConfig中配置了限流的接口添加令牌桶限流,
+// 被限流的请求不会调用代理, 直接返回带有Retry-After头的429应答. 限流配置错误时所有请求返回500.
+func NewRateLimitHandlerFactory(next HandlerFactory, logger logging.Logger) HandlerFactory {
+	return func(cfg *config.EndpointConfig, p proxy.Proxy) http.HandlerFunc {
+		handler := next(cfg, p)
+		rl, err := ratelimit.GetConfig(cfg.ExtraConfig)
+		if err == ratelimit.ErrNoConfigFound {
+			return handler
+		}
+		if err != nil {
+			// 路由器注册接口之前已经校验过限流配置, 这里只是兜底: 配置错误时拒绝所有请求, 而不是取消限流
+			logger.Error(fmt.Sprintf("[ENDPOINT: %s][RateLimit] %s", cfg.Endpoint, err.Error()))
+			return func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+
+		limiter := ratelimit.NewLimiter(rl.MaxRate, rl.Capacity, rl.MaxKeys)
+		render := getRender(cfg)
+		return func(w http.ResponseWriter, r *http.Request) {
+			var key string
+			switch rl.Strategy {
+			case ratelimit.StrategyIP:
+				key = proxy.ClientIP(r.RemoteAddr, r.Header, rl.TrustedProxies)
+			case ratelimit.StrategyHeader:
+				key = r.Header.Get(rl.Key)
+			}
+			if ok, wait := limiter.Allow(key); !ok {
+				response := (&proxy.RateLimitError{RetryAfter: wait}).ToResponse(r.URL.Path)
+				response.ModifyHTTPHeader(w.Header())
+				render(&statusResponseWriter{ResponseWriter: w, status: response.Metadata.StatusCode}, response)
+				return
+			}
+			handler(w, r)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package mux
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/ratelimit"
+)
+
+func TestNewRateLimitHandlerFactory(t *testing.T) {
+	cfg := &config.EndpointConfig{
+		Endpoint: "/VIID/Faces",
+		Method:   "POST",
+		Timeout:  time.Second,
+		ExtraConfig: config.ExtraConfig{
+			ratelimit.Namespace: map[string]interface{}{"max_rate": 1, "strategy": "ip"},
+		},
+	}
+	calls := 0
+	p := func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+		calls++
+		return &proxy.Response{IsComplete: true, Data: map[string]interface{}{"a": 1}}, nil
+	}
+	handler := NewRateLimitHandlerFactory(EndpointHandler, logging.NoOp)(cfg, p)
+
+	do := func(ip string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", cfg.Endpoint, http.NoBody)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	if w := do("10.0.0.1"); w.Code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", w.Code)
+	}
+	if w := do("10.0.0.2"); w.Code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", w.Code)
+	}
+	w := do("10.0.0.1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("unexpected response: %d %v", w.Code, w.Header())
+	}
+	// 没有配置可信代理时, 伪造的X-Forwarded-For不影响限流
+	req, _ := http.NewRequest("POST", cfg.Endpoint, http.NoBody)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("the forwarded address should be ignored: %d", w.Code)
+	}
+	if calls != 2 {
+		t.Errorf("unexpected number of proxy calls: %d", calls)
+	}
+}
+
+func TestNewRateLimitHandlerFactory_invalidConfig(t *testing.T) {
+	cfg := &config.EndpointConfig{
+		Endpoint: "/VIID/Faces",
+		Method:   "POST",
+		ExtraConfig: config.ExtraConfig{
+			ratelimit.Namespace: map[string]interface{}{"max_rate": -1},
+		},
+	}
+	p := func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+		t.Error("the proxy should not be called")
+		return nil, nil
+	}
+	req, _ := http.NewRequest("POST", cfg.Endpoint, http.NoBody)
+	w := httptest.NewRecorder()
+	NewRateLimitHandlerFactory(EndpointHandler, logging.NoOp)(cfg, p)(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("unexpected status code: %d", w.Code)
+	}
+}
+
+func TestEndpointHandler_rateLimitError(t *testing.T) {
+	cfg := &config.EndpointConfig{Endpoint: "/VIID/Faces", Method: "POST", Timeout: time.Second}
+	p := func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+		return nil, &proxy.RateLimitError{RetryAfter: 2 * time.Second}
+	}
+	req, _ := http.NewRequest("POST", cfg.Endpoint, http.NoBody)
+	w := httptest.NewRecorder()
+	EndpointHandler(cfg, p)(w, req)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("unexpected response: %d %v", w.Code, w.Header())
+	}
+}
@@ -20,6 +20,9 @@ type Render func(http.ResponseWriter, *proxy.Response)
 // NEGOTIATE defines the value of the OutputEncoding for the negotiated render
 const NEGOTIATE = "negotiate"
 
+// ViidStatusList 渲染GA/T 1400应答状态列表的render名称, 见viidStatusListRender
+const ViidStatusList = "viid-status-list"
+
 var (
 	mutex          = &sync.RWMutex{}
 	renderRegister = map[string]Render{
@@ -30,6 +33,10 @@ var (
 	}
 )
 
+func init() {
+	RegisterRender(ViidStatusList, viidStatusListRender)
+}
+
 // RegisterRender allows clients to register their custom renders
 func RegisterRender(name string, r Render) {
 	mutex.Lock()
@@ -80,6 +87,22 @@ func jsonRender(w http.ResponseWriter, response *proxy.Response) {
 	w.Write(js)
 }
 
+// viidStatusListRender 应答中记录了对象应答状态时渲染ResponseStatusListObject,
+// 否则按JSON渲染应答数据.
+func viidStatusListRender(w http.ResponseWriter, response *proxy.Response) {
+	if response == nil || len(response.StatusList) == 0 {
+		jsonRender(w, response)
+		return
+	}
+	w.Header().Set("Content-Type", proxy.ViidContentType)
+	js, err := json.Marshal(response.ResponseStatusListObject())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(js)
+}
+
 func jsonCollectionRender(w http.ResponseWriter, response *proxy.Response) {
 	w.Header().Set("Content-Type", "application/json")
 	if response == nil {
@@ -365,3 +365,20 @@ func TestRender_noop_nilResponse(t *testing.T) {
 		t.Error("Unexpected status code:", w.Result().StatusCode)
 	}
 }
+
+func TestRender_viidStatusList(t *testing.T) {
+	response := &proxy.Response{IsComplete: true, Data: map[string]interface{}{}}
+	response.AddResponseStatus(proxy.ResponseStatus{RequestURL: "/VIID/Faces", StatusCode: proxy.ViidStatusOK, StatusString: "OK", ID: "1", LocalTime: "20260101000000"})
+
+	w := httptest.NewRecorder()
+	getRender(&config.EndpointConfig{OutputEncoding: ViidStatusList})(w, response)
+
+	expected := `{"ResponseStatusListObject":{"ResponseStatusObject":[` +
+		`{"RequestURL":"/VIID/Faces","StatusCode":0,"StatusString":"OK","Id":"1","LocalTime":"20260101000000"}]}}`
+	if body := w.Body.String(); body != expected {
+		t.Errorf("unexpected body: %s", body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != proxy.ViidContentType {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+}
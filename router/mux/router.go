@@ -7,10 +7,12 @@ package mux
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"strings"
 
 	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/health"
 	"github.com/luraproject/lura/v2/logging"
 	"github.com/luraproject/lura/v2/proxy"
 	"github.com/luraproject/lura/v2/router"
@@ -33,10 +35,12 @@ type Config struct {
 	Middlewares    []HandlerMiddleware
 	HandlerFactory HandlerFactory
 	ProxyFactory   proxy.Factory
-	Logger         logging.Logger
-	DebugPattern   string
-	EchoPattern    string
-	RunServer      RunServerFunc
+	// VicgFactory 用户自定义的代理工厂, 设置后优先于ProxyFactory, 任一接口创建失败时路由器不会启动
+	VicgFactory  router.VicgFactory
+	Logger       logging.Logger
+	DebugPattern string
+	EchoPattern  string
+	RunServer    RunServerFunc
 }
 
 // HandlerMiddleware is the interface for the decorators over the http.Handler
@@ -50,7 +54,7 @@ func DefaultFactory(pf proxy.Factory, logger logging.Logger) router.Factory {
 		Config{
 			Engine:         DefaultEngine(),
 			Middlewares:    []HandlerMiddleware{},
-			HandlerFactory: EndpointHandler,
+			HandlerFactory: NewRateLimitHandlerFactory(EndpointHandler, logger),
 			ProxyFactory:   pf,
 			Logger:         logger,
 			DebugPattern:   DefaultDebugPattern,
@@ -60,6 +64,25 @@ func DefaultFactory(pf proxy.Factory, logger logging.Logger) router.Factory {
 	}
 }
 
+// DefaultVicgFactory 创建使用用户代理工厂的路由器工厂.
+func DefaultVicgFactory(vf router.VicgFactory, logger logging.Logger) router.Factory {
+	return NewFactory(DefaultVicgConfig(vf, logger, NoopParamExtractor))
+}
+
+// DefaultVicgConfig 返回使用用户代理工厂的路由器配置, pe用于提取路径参数.
+func DefaultVicgConfig(vf router.VicgFactory, logger logging.Logger, pe ParamExtractor) Config {
+	return Config{
+		Engine:         DefaultEngine(),
+		Middlewares:    []HandlerMiddleware{},
+		HandlerFactory: NewRateLimitHandlerFactory(VicgEndpointHandler(NewRequestBuilder(pe)), logger),
+		VicgFactory:    vf,
+		Logger:         logger,
+		DebugPattern:   DefaultDebugPattern,
+		EchoPattern:    DefaultEchoPattern,
+		RunServer:      server.RunServer,
+	}
+}
+
 // NewFactory returns a net/http mux router factory with the injected configuration
 func NewFactory(cfg Config) router.Factory {
 	if cfg.DebugPattern == "" {
@@ -88,10 +111,21 @@ type httpRouter struct {
 	RunServer RunServerFunc
 }
 
-// HealthHandler is a dummy http.HandlerFunc implementation for exposing a health check endpoint
+// HealthHandler is a http.HandlerFunc implementation for exposing a health check endpoint.
+// 各子系统注册的状态报告在health.ReportsKey下输出.
 func HealthHandler(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"status":"ok"}`))
+	report := health.Report()
+	if len(report) == 0 {
+		w.Write([]byte(`{"status":"ok"}`))
+		return
+	}
+	b, err := json.Marshal(map[string]interface{}{"status": "ok", health.ReportsKey: report})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(b)
 }
 
 // Run implements the router interface
@@ -134,7 +168,13 @@ func (r httpRouter) Run(cfg config.ServiceConfig) {
 
 	server.InitHTTPDefaultTransport(cfg)
 
-	r.registerKrakendEndpoints(cfg.Endpoints)
+	if r.cfg.VicgFactory == nil {
+		r.registerKrakendEndpoints(cfg.Endpoints)
+	} else if err := r.registerVicgEndpoints(cfg); err != nil {
+		// 令所有插件加载成功进程才会启动
+		r.cfg.Logger.Error(logPrefix, "Router execution failed:", err.Error())
+		return
+	}
 
 	if err := r.RunServer(r.ctx, cfg, r.handler()); err != nil {
 		r.cfg.Logger.Error(logPrefix, err.Error())
@@ -145,7 +185,11 @@ func (r httpRouter) Run(cfg config.ServiceConfig) {
 
 func (r httpRouter) registerKrakendEndpoints(endpoints []*config.EndpointConfig) {
 	for _, c := range endpoints {
-		proxyStack, err := r.cfg.ProxyFactory.New(c)
+		if err := router.ValidateRateLimit(c); err != nil {
+			r.cfg.Logger.Error(logPrefix, "[ENDPOINT:", c.Endpoint, "]", err.Error())
+			continue
+		}
+		proxyStack, err := proxy.NewWithContext(r.ctx, r.cfg.ProxyFactory, c)
 		if err != nil {
 			r.cfg.Logger.Error(logPrefix, "Calling the ProxyFactory", err.Error())
 			continue
@@ -155,6 +199,27 @@ func (r httpRouter) registerKrakendEndpoints(endpoints []*config.EndpointConfig)
 	}
 }
 
+// registerVicgEndpoints 使用VicgFactory构建并注册所有接口, 任一接口失败时返回错误.
+func (r httpRouter) registerVicgEndpoints(cfg config.ServiceConfig) error {
+	infra, err := r.cfg.VicgFactory.BuildInfra(r.ctx, cfg.ExtraConfig)
+	if err != nil {
+		return err
+	}
+	if err = router.ValidateEndpoints(r.cfg.VicgFactory, cfg.Endpoints, r.cfg.Logger, logPrefix); err != nil {
+		return err
+	}
+	for _, c := range cfg.Endpoints {
+		router.MergeConfig(cfg, c)
+		proxyStack, err := router.NewProxy(r.ctx, r.cfg.VicgFactory, c, infra)
+		if err != nil {
+			r.cfg.Logger.Error(logPrefix, "Calling the VicgFactory", err.Error())
+			return err
+		}
+		r.registerKrakendEndpoint(c.Method, c, r.cfg.HandlerFactory(c, proxyStack), len(c.Backend))
+	}
+	return nil
+}
+
 func (r httpRouter) registerKrakendEndpoint(method string, endpoint *config.EndpointConfig, handler http.HandlerFunc, totBackends int) {
 	method = strings.ToTitle(method)
 	path := endpoint.Endpoint
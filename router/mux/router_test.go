@@ -12,12 +12,14 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"regexp"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/health"
 	"github.com/luraproject/lura/v2/logging"
 	"github.com/luraproject/lura/v2/proxy"
 	"github.com/luraproject/lura/v2/transport/http/server"
@@ -334,3 +336,84 @@ type identityMiddleware struct{}
 func (identityMiddleware) Handler(h http.Handler) http.Handler {
 	return h
 }
+
+type dummyVicgFactory struct {
+	err error
+}
+
+func (f dummyVicgFactory) New(cfg *config.EndpointConfig, infra interface{}) (proxy.Proxy, error) {
+	if f.err != nil && cfg.Endpoint == "/broken" {
+		return nil, f.err
+	}
+	return func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+		return &proxy.Response{
+			Data:     map[string]interface{}{"infra": infra},
+			Metadata: proxy.Metadata{StatusCode: http.StatusCreated},
+		}, nil
+	}, nil
+}
+
+func (dummyVicgFactory) BuildInfra(_ context.Context, cfg config.ExtraConfig) (interface{}, error) {
+	return cfg["infra"], nil
+}
+
+func TestDefaultVicgFactory(t *testing.T) {
+	buff := new(bytes.Buffer)
+	logger, _ := logging.NewLogger("ERROR", buff, "")
+
+	var handler http.Handler
+	cfg := DefaultVicgConfig(dummyVicgFactory{}, logger, NoopParamExtractor)
+	cfg.RunServer = func(_ context.Context, _ config.ServiceConfig, h http.Handler) error {
+		handler = h
+		return nil
+	}
+	NewFactory(cfg).New().Run(config.ServiceConfig{
+		Timeout:     time.Second,
+		ExtraConfig: config.ExtraConfig{"infra": "supu"},
+		Endpoints:   []*config.EndpointConfig{{Endpoint: "/post", Method: "POST"}},
+	})
+	if handler == nil {
+		t.Fatalf("the router did not start: %s", buff.String())
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/post", http.NoBody))
+	if w.Code != http.StatusCreated {
+		t.Errorf("unexpected status code: %d", w.Code)
+	}
+	if body := w.Body.String(); body != `{"infra":"supu"}` {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
+
+func TestDefaultVicgFactory_failFast(t *testing.T) {
+	buff := new(bytes.Buffer)
+	logger, _ := logging.NewLogger("ERROR", buff, "")
+
+	cfg := DefaultVicgConfig(dummyVicgFactory{err: errors.New("crash!!!")}, logger, NoopParamExtractor)
+	cfg.RunServer = func(_ context.Context, _ config.ServiceConfig, _ http.Handler) error {
+		t.Error("the router should not start")
+		return nil
+	}
+	NewFactory(cfg).New().Run(config.ServiceConfig{
+		Endpoints: []*config.EndpointConfig{
+			{Endpoint: "/ok", Method: "GET"},
+			{Endpoint: "/broken", Method: "GET"},
+		},
+	})
+	if !strings.Contains(buff.String(), "crash!!!") {
+		t.Errorf("the logger doesn't contain the expected msg: %s", buff.String())
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	health.Register("status", func() interface{} { return "broken" })
+	defer health.Unregister("status")
+
+	w := httptest.NewRecorder()
+	HealthHandler(w, httptest.NewRequest("GET", "/__health", http.NoBody))
+
+	if body, want := w.Body.String(), `{"reports":{"status":"broken"},"status":"ok"}`; body != want {
+		t.Errorf("unexpected body. have: %s, want: %s", body, want)
+	}
+}
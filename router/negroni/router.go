@@ -36,6 +36,18 @@ func DefaultConfigWithRouter(pf proxy.Factory, logger logging.Logger, muxEngine
 	return cfg
 }
 
+// DefaultVicgFactory 创建使用用户代理工厂的路由器工厂.
+func DefaultVicgFactory(vf router.VicgFactory, logger logging.Logger, middlewares []negroni.Handler) router.Factory {
+	return mux.NewFactory(DefaultVicgConfig(vf, logger, middlewares))
+}
+
+// DefaultVicgConfig 返回使用用户代理工厂的路由器配置.
+func DefaultVicgConfig(vf router.VicgFactory, logger logging.Logger, middlewares []negroni.Handler) mux.Config {
+	cfg := luragorilla.DefaultVicgConfig(vf, logger)
+	cfg.Engine = newNegroniEngine(NewGorillaRouter(), middlewares...)
+	return cfg
+}
+
 // NewGorillaRouter is a wrapper over the default gorilla router builder
 func NewGorillaRouter() *gorilla.Router {
 	return gorilla.NewRouter()
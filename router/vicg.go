@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/ratelimit"
+)
+
+// VicgFactory 用户自定义的代理工厂, 所有的路由适配器都可以使用.
+type VicgFactory interface {
+	// New 基于用户自定义结构创建代理.
+	New(cfg *config.EndpointConfig, infra interface{}) (proxy.Proxy, error)
+	// BuildInfra 基于额外参数构建用户自定义结构.
+	BuildInfra(ctx context.Context, cfg config.ExtraConfig) (infra interface{}, err error)
+}
+
+// ContextVicgFactory VicgFactory可选实现的接口, 代理中的后台任务(如后端的健康检查)随ctx结束而停止.
+// 路由器在接口的代理被替换或服务退出时结束ctx.
+type ContextVicgFactory interface {
+	NewWithContext(ctx context.Context, cfg *config.EndpointConfig, infra interface{}) (proxy.Proxy, error)
+}
+
+// NewProxy 使用f创建接口的代理, f实现了ContextVicgFactory时将ctx传给它.
+func NewProxy(ctx context.Context, f VicgFactory, cfg *config.EndpointConfig, infra interface{}) (proxy.Proxy, error) {
+	if cf, ok := f.(ContextVicgFactory); ok {
+		return cf.NewWithContext(ctx, cfg, infra)
+	}
+	return f.New(cfg, infra)
+}
+
+// ConfigValidator VicgFactory可选实现的接口, 注册接口之前校验接口的插件配置.
+type ConfigValidator interface {
+	ValidateConfig(cfg *config.EndpointConfig) []error
+}
+
+// WrapProxyFactory 将proxy.Factory转换为VicgFactory, 其infra总是nil.
+func WrapProxyFactory(pf proxy.Factory) VicgFactory {
+	return proxyFactoryWrapper{factory: pf}
+}
+
+type proxyFactoryWrapper struct {
+	factory proxy.Factory
+}
+
+// New 实现VicgFactory接口.
+func (pf proxyFactoryWrapper) New(cfg *config.EndpointConfig, _ interface{}) (proxy.Proxy, error) {
+	return pf.factory.New(cfg)
+}
+
+// NewWithContext 实现ContextVicgFactory接口.
+func (pf proxyFactoryWrapper) NewWithContext(ctx context.Context, cfg *config.EndpointConfig, _ interface{}) (proxy.Proxy, error) {
+	return proxy.NewWithContext(ctx, pf.factory, cfg)
+}
+
+// BuildInfra 实现VicgFactory接口.
+func (pf proxyFactoryWrapper) BuildInfra(_ context.Context, _ config.ExtraConfig) (interface{}, error) {
+	return nil, nil
+}
+
+// ValidateEndpoints 校验所有接口的插件配置和限流配置, 逐条记录不合法的字段及其所在的文件和接口.
+// VicgFactory没有实现ConfigValidator时只校验限流配置.
+func ValidateEndpoints(f VicgFactory, endpoints []*config.EndpointConfig, logger logging.Logger, logPrefix string) error {
+	v, _ := f.(ConfigValidator)
+	total := 0
+	for _, e := range endpoints {
+		var errs []error
+		if v != nil {
+			errs = v.ValidateConfig(e)
+		}
+		if err := ValidateRateLimit(e); err != nil {
+			errs = append(errs, err)
+		}
+		for _, err := range errs {
+			source := e.Source
+			if source == "" {
+				source = "<config>"
+			}
+			logger.Error(logPrefix, fmt.Sprintf("%s: [ENDPOINT: %s %s] %s", source, e.Method, e.Endpoint, err.Error()))
+			total++
+		}
+	}
+	if total > 0 {
+		return fmt.Errorf("found %d invalid endpoint config(s)", total)
+	}
+	return nil
+}
+
+// ValidateRateLimit 校验接口的限流配置. 配置错误的接口不能注册, 否则请求将不受限流.
+func ValidateRateLimit(e *config.EndpointConfig) error {
+	if _, err := ratelimit.GetConfig(e.ExtraConfig); err != nil && err != ratelimit.ErrNoConfigFound {
+		return fmt.Errorf("[RateLimit] %s", err.Error())
+	}
+	return nil
+}
+
+// MergeConfig 将ServiceConfig中定义的, 可以在EndpintConfig中使用的参数, 作为EndpointConfig的默认值.
+func MergeConfig(gc config.ServiceConfig, ec *config.EndpointConfig) {
+	if ec.OutputEncoding == "" && gc.OutputEncoding != "" {
+		ec.OutputEncoding = gc.OutputEncoding
+	}
+	if ec.Timeout == 0 && gc.Timeout != 0 {
+		ec.Timeout = gc.Timeout
+	}
+	if ec.CacheTTL == 0 && gc.CacheTTL != 0 {
+		ec.CacheTTL = gc.CacheTTL
+	}
+}
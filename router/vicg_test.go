@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/proxy"
+)
+
+func TestWrapProxyFactory(t *testing.T) {
+	var received *config.EndpointConfig
+	f := WrapProxyFactory(proxy.FactoryFunc(func(cfg *config.EndpointConfig) (proxy.Proxy, error) {
+		received = cfg
+		return proxy.NoopProxy, nil
+	}))
+
+	infra, err := f.BuildInfra(context.Background(), config.ExtraConfig{"a": 1})
+	if infra != nil || err != nil {
+		t.Errorf("unexpected infra: %v, %v", infra, err)
+	}
+	cfg := &config.EndpointConfig{Endpoint: "/a"}
+	if p, err := f.New(cfg, "infra"); p == nil || err != nil {
+		t.Errorf("unexpected proxy: %v", err)
+	}
+	if received != cfg {
+		t.Error("the endpoint config was not passed to the proxy factory")
+	}
+}
+
+type dummyConfigValidator struct {
+	VicgFactory
+}
+
+func (dummyConfigValidator) ValidateConfig(cfg *config.EndpointConfig) []error {
+	if cfg.Endpoint == "/invalid" {
+		return []error{errors.New("field 'Length': must be at least 1")}
+	}
+	return nil
+}
+
+func TestValidateEndpoints(t *testing.T) {
+	buff := new(bytes.Buffer)
+	logger, _ := logging.NewLogger("ERROR", buff, "")
+	endpoints := []*config.EndpointConfig{
+		{Endpoint: "/valid", Method: "POST"},
+		{Endpoint: "/invalid", Method: "POST", Source: "plugins/faces.json"},
+	}
+
+	if err := ValidateEndpoints(WrapProxyFactory(proxy.DefaultFactory(logging.NoOp)), endpoints, logger, "[TEST]"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ValidateEndpoints(dummyConfigValidator{}, endpoints[:1], logger, "[TEST]"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ValidateEndpoints(dummyConfigValidator{}, endpoints, logger, "[TEST]"); err == nil {
+		t.Error("expecting an error")
+	}
+	if msg := "plugins/faces.json: [ENDPOINT: POST /invalid] field 'Length': must be at least 1"; !strings.Contains(buff.String(), msg) {
+		t.Errorf("the logger doesn't contain the expected msg: %s", buff.String())
+	}
+}
+
+func TestMergeConfig(t *testing.T) {
+	sc := config.ServiceConfig{OutputEncoding: "json", Timeout: time.Second, CacheTTL: time.Minute}
+
+	e := &config.EndpointConfig{}
+	MergeConfig(sc, e)
+	if e.OutputEncoding != "json" || e.Timeout != time.Second || e.CacheTTL != time.Minute {
+		t.Errorf("the service defaults were not applied: %+v", e)
+	}
+
+	e = &config.EndpointConfig{OutputEncoding: "string", Timeout: time.Millisecond, CacheTTL: time.Hour}
+	MergeConfig(sc, e)
+	if e.OutputEncoding != "string" || e.Timeout != time.Millisecond || e.CacheTTL != time.Hour {
+		t.Errorf("the endpoint values were overridden: %+v", e)
+	}
+}
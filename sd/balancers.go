@@ -0,0 +1,440 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package sd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/luraproject/lura/v2/config"
+)
+
+// BalancerNamespace 负载均衡策略在Backend的ExtraConfig中的配置键.
+//
+//	"extra_config": {
+//		"github_com/luraproject/lura/sd/balancer": {
+//			"strategy": "consistent_hash",
+//			"hash_by": "header",
+//			"key": "User-Identify"
+//		}
+//	}
+//
+// 加权轮询的权重以后端地址为键, 没有配置权重的后端权重为1, 权重为0的后端不分配请求:
+//
+//	{"strategy": "weighted", "weights": {"http://10.0.0.1:8080": 3, "http://10.0.0.2:8080": 1}}
+//
+// 按客户端IP哈希时默认使用连接的对端地址; 网关部署在反向代理之后时, 在trusted_proxies中配置代理的IP或CIDR,
+// 来自这些代理的请求使用X-Forwarded-For中的客户端地址:
+//
+//	{"strategy": "consistent_hash", "hash_by": "ip", "trusted_proxies": ["10.0.0.0/8"]}
+const BalancerNamespace = "github_com/luraproject/lura/sd/balancer"
+
+// 负载均衡策略.
+const (
+	// StrategyRoundRobin 轮询
+	StrategyRoundRobin = "round_robin"
+	// StrategyRandom 随机
+	StrategyRandom = "random"
+	// StrategyWeighted 平滑加权轮询
+	StrategyWeighted = "weighted"
+	// StrategyLeastOutstanding 选择未完成请求数最少的后端
+	StrategyLeastOutstanding = "least_outstanding"
+	// StrategyConsistentHash 按请求的键一致性哈希, 相同的键总是选择相同的后端
+	StrategyConsistentHash = "consistent_hash"
+)
+
+// 一致性哈希的键的来源.
+const (
+	// HashByHeader 请求头, 请求头需要在input_headers中
+	HashByHeader = "header"
+	// HashByParam 路径参数
+	HashByParam = "param"
+	// HashByIP 客户端IP
+	HashByIP = "ip"
+)
+
+// 默认配置.
+const (
+	// DefaultHashHeader 默认按设备的User-Identify头哈希
+	DefaultHashHeader = "User-Identify"
+	// DefaultHashReplicas 每个后端在哈希环上的虚拟节点数
+	DefaultHashReplicas = 160
+)
+
+// ErrNoBalancerConfig 没有配置负载均衡策略.
+var ErrNoBalancerConfig = errors.New("sd: no balancer configuration found")
+
+// BalancerConfig 负载均衡策略配置.
+type BalancerConfig struct {
+	// Strategy 负载均衡策略
+	Strategy string `json:"strategy"`
+	// Weights 加权轮询中各后端的权重
+	Weights map[string]int `json:"weights"`
+	// HashBy 一致性哈希的键的来源: header, param, ip, 默认为header
+	HashBy string `json:"hash_by"`
+	// Key 请求头或路径参数的名称
+	Key string `json:"key"`
+	// Replicas 每个后端在哈希环上的虚拟节点数
+	Replicas int `json:"replicas"`
+	// TrustedProxies 按客户端IP哈希时可信的代理
+	TrustedProxies []*net.IPNet `json:"-"`
+}
+
+// GetBalancerConfig 从ExtraConfig中解析负载均衡策略, 没有配置时返回ErrNoBalancerConfig.
+func GetBalancerConfig(e config.ExtraConfig) (*BalancerConfig, error) {
+	v, ok := e[BalancerNamespace]
+	if !ok {
+		return nil, ErrNoBalancerConfig
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &BalancerConfig{}
+	aux := struct {
+		*BalancerConfig
+		TrustedProxies []string `json:"trusted_proxies"`
+	}{BalancerConfig: cfg}
+	if err = json.Unmarshal(b, &aux); err != nil {
+		return nil, err
+	}
+	if cfg.TrustedProxies, err = config.ParseTrustedProxies(aux.TrustedProxies); err != nil {
+		return nil, err
+	}
+
+	switch cfg.Strategy {
+	case StrategyRoundRobin, StrategyRandom, StrategyLeastOutstanding:
+	case StrategyWeighted:
+		weights := make(map[string]int, len(cfg.Weights))
+		for host, w := range cfg.Weights {
+			if w < 0 {
+				return nil, fmt.Errorf("invalid weight for %s: %d", host, w)
+			}
+			weights[cleanWeightHost(host)] = w
+		}
+		cfg.Weights = weights
+	case StrategyConsistentHash:
+		switch cfg.HashBy {
+		case "", HashByHeader:
+			cfg.HashBy = HashByHeader
+			if cfg.Key == "" {
+				cfg.Key = DefaultHashHeader
+			}
+		case HashByParam:
+			if cfg.Key == "" {
+				return nil, errors.New("the param to hash by is required")
+			}
+			// 路径参数的首字母在路由中被转换为大写
+			cfg.Key = strings.ToUpper(cfg.Key[:1]) + cfg.Key[1:]
+		case HashByIP:
+		default:
+			return nil, fmt.Errorf("unknown hash_by: %s", cfg.HashBy)
+		}
+		if cfg.Replicas <= 0 {
+			cfg.Replicas = DefaultHashReplicas
+		}
+	default:
+		return nil, fmt.Errorf("unknown strategy: %s", cfg.Strategy)
+	}
+	return cfg, nil
+}
+
+// cleanWeightHost 与config.URI.CleanHost一致: 补全协议并去掉末尾的/.
+func cleanWeightHost(host string) string {
+	host = strings.TrimRight(host, "/")
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return host
+}
+
+// NewBalancerWithConfig 根据配置的策略创建均衡器.
+func NewBalancerWithConfig(subscriber Subscriber, cfg *BalancerConfig) Balancer {
+	switch cfg.Strategy {
+	case StrategyRoundRobin:
+		return NewRoundRobinLB(subscriber)
+	case StrategyRandom:
+		return NewRandomLB(subscriber)
+	case StrategyWeighted:
+		return NewWeightedRoundRobinLB(subscriber, cfg.Weights)
+	case StrategyLeastOutstanding:
+		return NewLeastOutstandingLB(subscriber)
+	case StrategyConsistentHash:
+		return NewConsistentHashLB(subscriber, cfg.Replicas)
+	default:
+		return NewBalancer(subscriber)
+	}
+}
+
+// KeyBalancer 根据请求的键选择后端的均衡器.
+type KeyBalancer interface {
+	Balancer
+	// HostFor 返回键对应的后端, 键为空时退化为轮询
+	HostFor(key string) (string, error)
+}
+
+// TrackingBalancer 统计每个后端未完成请求数的均衡器.
+type TrackingBalancer interface {
+	Balancer
+	// Acquire 选择后端并计入一个未完成的请求, 请求结束后需要调用release
+	Acquire() (host string, release func(), err error)
+}
+
+// NewWeightedRoundRobinLB 创建平滑加权轮询的均衡器, weights的键为后端地址.
+// 没有配置权重的后端权重为1, 权重为0的后端不分配请求.
+func NewWeightedRoundRobinLB(subscriber Subscriber, weights map[string]int) Balancer {
+	return &weightedRoundRobinLB{
+		balancer: balancer{subscriber: subscriber},
+		weights:  weights,
+		current:  map[string]int{},
+	}
+}
+
+type weightedRoundRobinLB struct {
+	balancer
+	weights map[string]int
+	mu      sync.Mutex
+	current map[string]int
+}
+
+func (w *weightedRoundRobinLB) weight(host string) int {
+	if v, ok := w.weights[host]; ok {
+		return v
+	}
+	return 1
+}
+
+// Host implements the balancer interface
+func (w *weightedRoundRobinLB) Host() (string, error) {
+	hosts, err := w.hosts()
+	if err != nil {
+		return "", err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// 后端列表变化后丢弃已下线后端的状态
+	if len(w.current) > len(hosts) {
+		w.current = make(map[string]int, len(hosts))
+	}
+	var (
+		best  string
+		max   int
+		total int
+	)
+	for _, h := range hosts {
+		weight := w.weight(h)
+		if weight <= 0 {
+			continue
+		}
+		c := w.current[h] + weight
+		w.current[h] = c
+		if total == 0 || c > max {
+			best, max = h, c
+		}
+		total += weight
+	}
+	if total == 0 {
+		return "", ErrNoHosts
+	}
+	w.current[best] -= total
+	return best, nil
+}
+
+// NewLeastOutstandingLB 创建选择未完成请求数最少的后端的均衡器.
+// 只有通过Acquire选择的请求才会被统计.
+func NewLeastOutstandingLB(subscriber Subscriber) TrackingBalancer {
+	return &leastOutstandingLB{
+		balancer:    balancer{subscriber: subscriber},
+		outstanding: map[string]int{},
+	}
+}
+
+type leastOutstandingLB struct {
+	balancer
+	mu          sync.Mutex
+	counter     int
+	outstanding map[string]int
+}
+
+// pick 从轮询的位置开始查找, 避免未完成请求数相同时总是选择第一个后端.
+func (l *leastOutstandingLB) pick(hosts []string) string {
+	start := l.counter % len(hosts)
+	l.counter++
+	best := hosts[start]
+	min := l.outstanding[best]
+	for i := 1; i < len(hosts) && min > 0; i++ {
+		h := hosts[(start+i)%len(hosts)]
+		if n := l.outstanding[h]; n < min {
+			best, min = h, n
+		}
+	}
+	return best
+}
+
+// Host implements the balancer interface
+func (l *leastOutstandingLB) Host() (string, error) {
+	hosts, err := l.hosts()
+	if err != nil {
+		return "", err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pick(hosts), nil
+}
+
+// Acquire implements the TrackingBalancer interface
+func (l *leastOutstandingLB) Acquire() (string, func(), error) {
+	hosts, err := l.hosts()
+	if err != nil {
+		return "", nil, err
+	}
+	l.mu.Lock()
+	host := l.pick(hosts)
+	l.outstanding[host]++
+	l.mu.Unlock()
+
+	var once sync.Once
+	return host, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			if l.outstanding[host]--; l.outstanding[host] <= 0 {
+				delete(l.outstanding, host)
+			}
+			l.mu.Unlock()
+		})
+	}, nil
+}
+
+// NewConsistentHashLB 创建一致性哈希的均衡器, 每个后端在哈希环上有replicas个虚拟节点.
+// 后端增减时只有少部分键会重新分配.
+func NewConsistentHashLB(subscriber Subscriber, replicas int) KeyBalancer {
+	if replicas <= 0 {
+		replicas = DefaultHashReplicas
+	}
+	return &consistentHashLB{
+		balancer: balancer{subscriber: subscriber},
+		replicas: replicas,
+	}
+}
+
+type consistentHashLB struct {
+	balancer
+	replicas int
+	counter  uint64
+	mu       sync.RWMutex
+	ring     *hashRing
+}
+
+type hashRing struct {
+	hosts  []string
+	hashes []uint64
+	owners map[uint64]string
+}
+
+// Host implements the balancer interface
+func (c *consistentHashLB) Host() (string, error) {
+	return c.HostFor("")
+}
+
+// HostFor implements the KeyBalancer interface
+func (c *consistentHashLB) HostFor(key string) (string, error) {
+	hosts, err := c.hosts()
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		offset := (atomic.AddUint64(&c.counter, 1) - 1) % uint64(len(hosts))
+		return hosts[offset], nil
+	}
+
+	ring := c.ringFor(hosts)
+	h := hashKey(key)
+	i := sort.Search(len(ring.hashes), func(i int) bool { return ring.hashes[i] >= h })
+	if i == len(ring.hashes) {
+		i = 0
+	}
+	return ring.owners[ring.hashes[i]], nil
+}
+
+// ringFor 返回后端列表对应的哈希环, 后端列表变化时重建.
+func (c *consistentHashLB) ringFor(hosts []string) *hashRing {
+	c.mu.RLock()
+	ring := c.ring
+	c.mu.RUnlock()
+	if ring != nil && equalHosts(ring.hosts, hosts) {
+		return ring
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ring != nil && equalHosts(c.ring.hosts, hosts) {
+		return c.ring
+	}
+	c.ring = newHashRing(hosts, c.replicas)
+	return c.ring
+}
+
+func newHashRing(hosts []string, replicas int) *hashRing {
+	// 排序去重, 使哈希环与后端的顺序无关
+	unique := make([]string, 0, len(hosts))
+	seen := make(map[string]struct{}, len(hosts))
+	for _, h := range hosts {
+		if _, ok := seen[h]; !ok {
+			seen[h] = struct{}{}
+			unique = append(unique, h)
+		}
+	}
+	sort.Strings(unique)
+
+	ring := &hashRing{
+		hosts:  append([]string(nil), hosts...),
+		hashes: make([]uint64, 0, len(unique)*replicas),
+		owners: make(map[uint64]string, len(unique)*replicas),
+	}
+	for _, h := range unique {
+		for i := 0; i < replicas; i++ {
+			v := hashKey(fmt.Sprintf("%s#%d", h, i))
+			if _, ok := ring.owners[v]; ok {
+				continue
+			}
+			ring.owners[v] = h
+			ring.hashes = append(ring.hashes, v)
+		}
+	}
+	sort.Slice(ring.hashes, func(i, j int) bool { return ring.hashes[i] < ring.hashes[j] })
+	return ring
+}
+
+func equalHosts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hashKey FNV-1a哈希, 再做一次混淆使相近的键在哈希环上均匀分布.
+func hashKey(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package sd
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/luraproject/lura/v2/config"
+)
+
+func TestWeightedRoundRobinLB(t *testing.T) {
+	hosts := []string{"http://a", "http://b", "http://c", "http://d"}
+	balancer := NewWeightedRoundRobinLB(FixedSubscriber(hosts), map[string]int{"http://a": 5, "http://b": 3, "http://d": 0})
+
+	counts := map[string]int{}
+	for i := 0; i < 900; i++ {
+		h, err := balancer.Host()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[h]++
+	}
+	for h, want := range map[string]int{"http://a": 500, "http://b": 300, "http://c": 100, "http://d": 0} {
+		if counts[h] != want {
+			t.Errorf("%s: want %d, have %d", h, want, counts[h])
+		}
+	}
+
+	// 平滑加权: 权重高的后端不会被连续选中
+	balancer = NewWeightedRoundRobinLB(FixedSubscriber([]string{"http://a", "http://b"}), map[string]int{"http://a": 2})
+	var seq string
+	for i := 0; i < 6; i++ {
+		h, _ := balancer.Host()
+		seq += h[len(h)-1:]
+	}
+	if seq != "abaaba" {
+		t.Errorf("unexpected sequence: %s", seq)
+	}
+}
+
+func TestWeightedRoundRobinLB_noHosts(t *testing.T) {
+	balancer := NewWeightedRoundRobinLB(FixedSubscriber([]string{"http://a"}), map[string]int{"http://a": 0})
+	if _, err := balancer.Host(); err != ErrNoHosts {
+		t.Errorf("unexpected error: %v", err)
+	}
+	balancer = NewWeightedRoundRobinLB(FixedSubscriber{}, nil)
+	if _, err := balancer.Host(); err != ErrNoHosts {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLeastOutstandingLB(t *testing.T) {
+	balancer := NewLeastOutstandingLB(FixedSubscriber([]string{"a", "b", "c"}))
+
+	h1, release1, _ := balancer.Acquire()
+	h2, release2, _ := balancer.Acquire()
+	h3, _, _ := balancer.Acquire()
+	if h1 == h2 || h2 == h3 || h1 == h3 {
+		t.Errorf("the requests should be spread: %s %s %s", h1, h2, h3)
+	}
+
+	release2()
+	release2()
+	for i := 0; i < 3; i++ {
+		h, release, err := balancer.Acquire()
+		if err != nil || h != h2 {
+			t.Errorf("want %s, have %s (%v)", h2, h, err)
+		}
+		release()
+	}
+	release1()
+	if h, _ := balancer.Host(); h == h3 {
+		t.Errorf("unexpected host: %s", h)
+	}
+}
+
+func TestLeastOutstandingLB_concurrent(t *testing.T) {
+	balancer := NewLeastOutstandingLB(FixedSubscriber([]string{"a", "b"}))
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, release, err := balancer.Acquire()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			release()
+		}()
+	}
+	wg.Wait()
+	if n := len(balancer.(*leastOutstandingLB).outstanding); n != 0 {
+		t.Errorf("unexpected outstanding requests: %d", n)
+	}
+}
+
+func TestConsistentHashLB(t *testing.T) {
+	hosts := []string{"http://a", "http://b", "http://c", "http://d"}
+	balancer := NewConsistentHashLB(FixedSubscriber(hosts), 0)
+
+	assigned := map[string]string{}
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		key := fmt.Sprintf("3301000000119%07d", i)
+		h, err := balancer.HostFor(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again, _ := balancer.HostFor(key); again != h {
+			t.Errorf("%s: the key is not sticky: %s %s", key, h, again)
+		}
+		assigned[key] = h
+		counts[h]++
+	}
+	for _, h := range hosts {
+		if counts[h] < 600 || counts[h] > 1400 {
+			t.Errorf("%s: unbalanced distribution %d", h, counts[h])
+		}
+	}
+
+	// 后端的顺序变化不影响分配, 后端下线只影响它上面的键
+	balancer = NewConsistentHashLB(FixedSubscriber([]string{"http://c", "http://a", "http://b"}), 0)
+	for key, h := range assigned {
+		have, _ := balancer.HostFor(key)
+		if h != "http://d" && have != h {
+			t.Errorf("%s: moved from %s to %s", key, h, have)
+		}
+	}
+}
+
+func TestConsistentHashLB_emptyKey(t *testing.T) {
+	balancer := NewConsistentHashLB(FixedSubscriber([]string{"a", "b"}), 10)
+	h1, _ := balancer.Host()
+	h2, _ := balancer.HostFor("")
+	if h1 == h2 {
+		t.Error("requests without key should be spread")
+	}
+	if _, err := NewConsistentHashLB(FixedSubscriber{}, 10).HostFor("x"); err != ErrNoHosts {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGetBalancerConfig(t *testing.T) {
+	if _, err := GetBalancerConfig(config.ExtraConfig{}); err != ErrNoBalancerConfig {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	cfg, err := GetBalancerConfig(config.ExtraConfig{BalancerNamespace: map[string]interface{}{"strategy": StrategyConsistentHash}})
+	if err != nil || cfg.HashBy != HashByHeader || cfg.Key != DefaultHashHeader || cfg.Replicas != DefaultHashReplicas {
+		t.Errorf("unexpected config: %+v %v", cfg, err)
+	}
+	cfg, err = GetBalancerConfig(config.ExtraConfig{BalancerNamespace: map[string]interface{}{
+		"strategy": StrategyConsistentHash, "hash_by": HashByParam, "key": "deviceID"}})
+	if err != nil || cfg.Key != "DeviceID" {
+		t.Errorf("unexpected config: %+v %v", cfg, err)
+	}
+	cfg, err = GetBalancerConfig(config.ExtraConfig{BalancerNamespace: map[string]interface{}{
+		"strategy": StrategyWeighted, "weights": map[string]interface{}{"10.0.0.1:8080/": 3}}})
+	if err != nil || cfg.Weights["http://10.0.0.1:8080"] != 3 {
+		t.Errorf("unexpected config: %+v %v", cfg, err)
+	}
+	cfg, err = GetBalancerConfig(config.ExtraConfig{BalancerNamespace: map[string]interface{}{
+		"strategy": StrategyConsistentHash, "hash_by": HashByIP, "trusted_proxies": []interface{}{"10.0.0.0/8", "192.168.1.1"}}})
+	if err != nil || len(cfg.TrustedProxies) != 2 || cfg.TrustedProxies[1].String() != "192.168.1.1/32" {
+		t.Errorf("unexpected config: %+v %v", cfg, err)
+	}
+
+	for _, v := range []map[string]interface{}{
+		{"strategy": "fastest"},
+		{"strategy": StrategyWeighted, "weights": map[string]interface{}{"a": -1}},
+		{"strategy": StrategyConsistentHash, "hash_by": "cookie"},
+		{"strategy": StrategyConsistentHash, "hash_by": HashByParam},
+		{"strategy": StrategyConsistentHash, "hash_by": HashByIP, "trusted_proxies": []interface{}{"proxy"}},
+	} {
+		if _, err := GetBalancerConfig(config.ExtraConfig{BalancerNamespace: v}); err == nil {
+			t.Errorf("%v: expecting an error", v)
+		}
+	}
+}
+
+func TestNewBalancerWithConfig(t *testing.T) {
+	subscriber := FixedSubscriber([]string{"a", "b"})
+	if _, ok := NewBalancerWithConfig(subscriber, &BalancerConfig{Strategy: StrategyConsistentHash}).(KeyBalancer); !ok {
+		t.Error("expecting a key balancer")
+	}
+	if _, ok := NewBalancerWithConfig(subscriber, &BalancerConfig{Strategy: StrategyLeastOutstanding}).(TrackingBalancer); !ok {
+		t.Error("expecting a tracking balancer")
+	}
+	if _, ok := NewBalancerWithConfig(subscriber, &BalancerConfig{Strategy: StrategyRoundRobin}).(*roundRobinLB); !ok {
+		t.Error("expecting a round robin balancer")
+	}
+}
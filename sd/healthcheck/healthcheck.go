@@ -0,0 +1,373 @@
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+Package healthcheck 主动探测后端的健康状态, 不健康的后端不会出现在Subscriber.Hosts()的结果中.
+在Backend的ExtraConfig中配置:
+
+	"extra_config": {
+		"github_com/luraproject/lura/sd/healthcheck": {
+			"path": "/health",
+			"expected_status": 200,
+			"interval": "10s",
+			"timeout": "2s",
+			"healthy_threshold": 2,
+			"unhealthy_threshold": 2
+		}
+	}
+
+连续unhealthy_threshold次探测失败的后端被移除, 之后连续healthy_threshold次探测成功再重新加入.
+各后端的状态通过/__health接口的reports.backends项输出, 按接口和后端分组.
+*/
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/health"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/sd"
+)
+
+// Namespace 健康检查在Backend的ExtraConfig中的配置键.
+const Namespace = "github_com/luraproject/lura/sd/healthcheck"
+
+// HealthKey 后端健康状态在/__health中的名称.
+const HealthKey = "backends"
+
+// 默认配置.
+const (
+	DefaultPath               = "/"
+	DefaultInterval           = 10 * time.Second
+	DefaultTimeout            = 2 * time.Second
+	DefaultHealthyThreshold   = 2
+	DefaultUnhealthyThreshold = 2
+)
+
+// ErrNoConfigFound 没有配置健康检查.
+var ErrNoConfigFound = errors.New("healthcheck: no configuration found")
+
+// Config 健康检查配置.
+type Config struct {
+	// Path 探测的路径
+	Path string `json:"path"`
+	// ExpectedStatus 健康的后端返回的状态码, 默认为200
+	ExpectedStatus int `json:"expected_status"`
+	// Interval 探测的周期
+	Interval time.Duration `json:"-"`
+	// Timeout 单次探测的超时时间
+	Timeout time.Duration `json:"-"`
+	// HealthyThreshold 重新加入后端所需的连续成功次数
+	HealthyThreshold int `json:"healthy_threshold"`
+	// UnhealthyThreshold 移除后端所需的连续失败次数
+	UnhealthyThreshold int `json:"unhealthy_threshold"`
+}
+
+// GetConfig 从ExtraConfig中解析健康检查配置, 没有配置时返回ErrNoConfigFound.
+func GetConfig(e config.ExtraConfig) (*Config, error) {
+	v, ok := e[Namespace]
+	if !ok {
+		return nil, ErrNoConfigFound
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	aux := struct {
+		*Config
+		Interval string `json:"interval"`
+		Timeout  string `json:"timeout"`
+	}{Config: cfg}
+	if err = json.Unmarshal(b, &aux); err != nil {
+		return nil, err
+	}
+
+	cfg.Interval = DefaultInterval
+	if aux.Interval != "" {
+		if cfg.Interval, err = time.ParseDuration(aux.Interval); err != nil {
+			return nil, fmt.Errorf("invalid interval: %s", err.Error())
+		}
+	}
+	cfg.Timeout = DefaultTimeout
+	if aux.Timeout != "" {
+		if cfg.Timeout, err = time.ParseDuration(aux.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout: %s", err.Error())
+		}
+	}
+	if cfg.Interval <= 0 || cfg.Timeout <= 0 {
+		return nil, errors.New("interval and timeout must be positive")
+	}
+	if cfg.Path == "" {
+		cfg.Path = DefaultPath
+	}
+	if cfg.ExpectedStatus == 0 {
+		cfg.ExpectedStatus = http.StatusOK
+	}
+	if cfg.HealthyThreshold <= 0 {
+		cfg.HealthyThreshold = DefaultHealthyThreshold
+	}
+	if cfg.UnhealthyThreshold <= 0 {
+		cfg.UnhealthyThreshold = DefaultUnhealthyThreshold
+	}
+	return cfg, nil
+}
+
+// HostStatus 单个后端的健康状态.
+type HostStatus struct {
+	Healthy   bool      `json:"healthy"`
+	Successes int       `json:"successes"`
+	Failures  int       `json:"failures"`
+	LastCheck time.Time `json:"last_check"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Subscriber 带有健康检查的Subscriber, Hosts()只返回健康的后端.
+// 还没有探测过的后端被认为是健康的.
+type Subscriber struct {
+	ctx        context.Context
+	endpoint   string
+	name       string
+	subscriber sd.Subscriber
+	cfg        *Config
+	client     *http.Client
+	logger     logging.Logger
+
+	mu     sync.RWMutex
+	status map[string]*HostStatus
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// Wrap 根据Backend的ExtraConfig为subscriber加上健康检查, 没有配置时原样返回.
+// endpoint为后端所属的接口, 与URLPattern一起作为健康报告的键. 健康检查在ctx结束时停止.
+func Wrap(ctx context.Context, logger logging.Logger, endpoint string, remote *config.Backend, subscriber sd.Subscriber) sd.Subscriber {
+	cfg, err := GetConfig(remote.ExtraConfig)
+	if err != nil {
+		if err != ErrNoConfigFound {
+			logger.Warning(fmt.Sprintf("[BACKEND: %s][HealthCheck] %s", remote.URLPattern, err.Error()))
+		}
+		return subscriber
+	}
+	logger.Debug(fmt.Sprintf("[BACKEND: %s][HealthCheck] Path: %s, Interval: %s", remote.URLPattern, cfg.Path, cfg.Interval))
+	return New(ctx, endpoint, remote.URLPattern, subscriber, cfg, logger)
+}
+
+// New 创建带有健康检查的Subscriber并开始周期性的探测, name为后端的名称, 用于日志.
+// 健康报告按照endpoint和name分组. 探测请求派生自ctx, ctx结束或调用Close后停止探测.
+func New(ctx context.Context, endpoint, name string, subscriber sd.Subscriber, cfg *Config, logger logging.Logger) *Subscriber {
+	s := newSubscriber(ctx, endpoint, name, subscriber, cfg, logger)
+	register(s)
+
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			s.Check()
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				s.Close()
+				return
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+func newSubscriber(ctx context.Context, endpoint, name string, subscriber sd.Subscriber, cfg *Config, logger logging.Logger) *Subscriber {
+	if logger == nil {
+		logger = logging.NoOp
+	}
+	return &Subscriber{
+		ctx:        ctx,
+		endpoint:   endpoint,
+		name:       name,
+		subscriber: subscriber,
+		cfg:        cfg,
+		client:     &http.Client{Timeout: cfg.Timeout},
+		logger:     logger,
+		status:     map[string]*HostStatus{},
+		stop:       make(chan struct{}),
+	}
+}
+
+// Hosts implements the sd.Subscriber interface
+func (s *Subscriber) Hosts() ([]string, error) {
+	hosts, err := s.subscriber.Hosts()
+	if err != nil {
+		return hosts, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if st, ok := s.status[h]; !ok || st.Healthy {
+			res = append(res, h)
+		}
+	}
+	return res, nil
+}
+
+// Check 并发探测所有的后端并更新其状态.
+func (s *Subscriber) Check() {
+	hosts, err := s.subscriber.Hosts()
+	if err != nil {
+		s.logger.Warning(fmt.Sprintf("[BACKEND: %s][HealthCheck] %s", s.name, err.Error()))
+		return
+	}
+
+	errs := make([]error, len(hosts))
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			errs[i] = s.probe(host)
+			wg.Done()
+		}(i, h)
+	}
+	wg.Wait()
+	// 停止时被中断的探测不计入结果
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := make(map[string]struct{}, len(hosts))
+	for i, h := range hosts {
+		current[h] = struct{}{}
+		st, ok := s.status[h]
+		if !ok {
+			st = &HostStatus{Healthy: true}
+			s.status[h] = st
+		}
+		st.LastCheck = now
+		s.update(h, st, errs[i])
+	}
+	// 已下线的后端
+	for h := range s.status {
+		if _, ok := current[h]; !ok {
+			delete(s.status, h)
+		}
+	}
+}
+
+func (s *Subscriber) update(host string, st *HostStatus, err error) {
+	if err == nil {
+		st.Successes++
+		st.Failures = 0
+		st.LastError = ""
+		if !st.Healthy && st.Successes >= s.cfg.HealthyThreshold {
+			st.Healthy = true
+			s.logger.Info(fmt.Sprintf("[BACKEND: %s][HealthCheck] %s is healthy again", s.name, host))
+		}
+		return
+	}
+	st.Failures++
+	st.Successes = 0
+	st.LastError = err.Error()
+	if st.Healthy && st.Failures >= s.cfg.UnhealthyThreshold {
+		st.Healthy = false
+		s.logger.Warning(fmt.Sprintf("[BACKEND: %s][HealthCheck] %s is unhealthy: %s", s.name, host, st.LastError))
+	}
+}
+
+func (s *Subscriber) probe(host string) error {
+	ctx, cancel := context.WithTimeout(s.ctx, s.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host+s.cfg.Path, http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != s.cfg.ExpectedStatus {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Status 返回各后端的健康状态, 键为探测的URL.
+func (s *Subscriber) Status() map[string]HostStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make(map[string]HostStatus, len(s.status))
+	for h, st := range s.status {
+		res[h+s.cfg.Path] = *st
+	}
+	return res
+}
+
+// Close 停止探测, 其结果不再出现在/__health中.
+func (s *Subscriber) Close() {
+	s.once.Do(func() {
+		unregister(s)
+		close(s.stop)
+	})
+}
+
+var (
+	subscribersMu = &sync.Mutex{}
+	subscribers   = map[*Subscriber]struct{}{}
+	registerOnce  sync.Once
+)
+
+func register(s *Subscriber) {
+	registerOnce.Do(func() { health.Register(HealthKey, Report) })
+	subscribersMu.Lock()
+	subscribers[s] = struct{}{}
+	subscribersMu.Unlock()
+}
+
+func unregister(s *Subscriber) {
+	subscribersMu.Lock()
+	delete(subscribers, s)
+	subscribersMu.Unlock()
+}
+
+// Report 汇总所有健康检查的结果, 按接口和Backend的URLPattern分组.
+func Report() interface{} {
+	subscribersMu.Lock()
+	list := make([]*Subscriber, 0, len(subscribers))
+	for s := range subscribers {
+		list = append(list, s)
+	}
+	subscribersMu.Unlock()
+
+	report := make(map[string]map[string]HostStatus, len(list))
+	for _, s := range list {
+		st := s.Status()
+		key := s.reportKey()
+		if prev, ok := report[key]; ok {
+			for k, v := range prev {
+				st[k] = v
+			}
+		}
+		report[key] = st
+	}
+	return report
+}
+
+// reportKey 返回健康报告的键: "接口 -> 后端", 没有接口时只使用后端的名称.
+func (s *Subscriber) reportKey() string {
+	if s.endpoint == "" {
+		return s.name
+	}
+	return s.endpoint + " -> " + s.name
+}
@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/health"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/sd"
+)
+
+func TestSubscriber(t *testing.T) {
+	var status int32 = http.StatusOK
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer flaky.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer healthy.Close()
+
+	cfg, err := GetConfig(config.ExtraConfig{Namespace: map[string]interface{}{
+		"path":                "/health",
+		"healthy_threshold":   2,
+		"unhealthy_threshold": 2,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSubscriber(context.Background(), "", "/faces", sd.FixedSubscriber([]string{flaky.URL, healthy.URL}), cfg, logging.NoOp)
+
+	assertHosts := func(want int) {
+		t.Helper()
+		hosts, err := s.Hosts()
+		if err != nil || len(hosts) != want {
+			t.Errorf("unexpected hosts: %v %v", hosts, err)
+		}
+	}
+
+	assertHosts(2)
+	s.Check()
+	assertHosts(2)
+
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	s.Check()
+	assertHosts(2)
+	s.Check()
+	assertHosts(1)
+	if st := s.Status()[flaky.URL+"/health"]; st.Healthy || st.Failures != 2 || st.LastError == "" {
+		t.Errorf("unexpected status: %+v", st)
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	s.Check()
+	assertHosts(1)
+	s.Check()
+	assertHosts(2)
+}
+
+func TestSubscriber_timeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	cfg := &Config{Path: "/", ExpectedStatus: http.StatusOK, Timeout: 10 * time.Millisecond, HealthyThreshold: 1, UnhealthyThreshold: 1}
+	s := newSubscriber(context.Background(), "", "/faces", sd.FixedSubscriber([]string{slow.URL, "http://127.0.0.1:1"}), cfg, nil)
+	s.Check()
+	if hosts, _ := s.Hosts(); len(hosts) != 0 {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+}
+
+func TestSubscriber_canceled(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	// 探测请求随ctx结束而中断, 其结果不计入状态
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg := &Config{Path: "/", ExpectedStatus: http.StatusOK, Timeout: time.Second, HealthyThreshold: 1, UnhealthyThreshold: 1}
+	s := newSubscriber(ctx, "", "/faces", sd.FixedSubscriber([]string{slow.URL}), cfg, nil)
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	s.Check()
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("the probe was not canceled: %v", elapsed)
+	}
+	if st := s.Status(); len(st) != 0 {
+		t.Errorf("unexpected status: %v", st)
+	}
+}
+
+func TestReport_endpoints(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+	defer backend.Close()
+
+	cfg := &Config{Path: "/", ExpectedStatus: http.StatusOK, Timeout: time.Second, HealthyThreshold: 1, UnhealthyThreshold: 1}
+	faces := newSubscriber(context.Background(), "POST /VIID/Faces", "/upload", sd.FixedSubscriber([]string{backend.URL}), cfg, nil)
+	images := newSubscriber(context.Background(), "POST /VIID/Images", "/upload", sd.FixedSubscriber([]string{"http://127.0.0.1:1"}), cfg, nil)
+	for _, s := range []*Subscriber{faces, images} {
+		register(s)
+		defer unregister(s)
+		s.Check()
+	}
+
+	// 使用相同URLPattern的不同接口的后端分别报告
+	report := Report().(map[string]map[string]HostStatus)
+	if st := report["POST /VIID/Faces -> /upload"]; len(st) != 1 || !st[backend.URL+"/"].Healthy {
+		t.Errorf("unexpected report: %v", st)
+	}
+	if st := report["POST /VIID/Images -> /upload"]; len(st) != 1 || st["http://127.0.0.1:1/"].Healthy {
+		t.Errorf("unexpected report: %v", st)
+	}
+}
+
+func TestSubscriber_removedHosts(t *testing.T) {
+	hosts := []string{"http://127.0.0.1:1", "http://127.0.0.1:2"}
+	cfg := &Config{Path: "/", ExpectedStatus: http.StatusOK, Timeout: time.Second, HealthyThreshold: 1, UnhealthyThreshold: 1}
+	s := newSubscriber(context.Background(), "", "/faces", sd.SubscriberFunc(func() ([]string, error) { return hosts, nil }), cfg, nil)
+	s.Check()
+	hosts = hosts[:1]
+	s.Check()
+	if st := s.Status(); len(st) != 1 {
+		t.Errorf("unexpected status: %v", st)
+	}
+}
+
+func TestNew_healthReport(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+	defer backend.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := Wrap(ctx, logging.NoOp, "POST /VIID/Faces", &config.Backend{
+		URLPattern:  "/faces",
+		ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{"interval": "10ms"}},
+	}, sd.FixedSubscriber([]string{backend.URL}))
+	hc, ok := s.(*Subscriber)
+	if !ok {
+		t.Fatalf("unexpected subscriber: %T", s)
+	}
+	defer hc.Close()
+
+	time.Sleep(50 * time.Millisecond)
+	report, ok := health.Report()[HealthKey].(map[string]map[string]HostStatus)
+	if !ok {
+		t.Fatalf("unexpected report: %v", health.Report())
+	}
+	if st := report["POST /VIID/Faces -> /faces"][backend.URL+"/"]; !st.Healthy || st.Successes == 0 {
+		t.Errorf("unexpected status: %+v", st)
+	}
+
+	// ctx结束后停止探测
+	cancel()
+	select {
+	case <-hc.stop:
+	case <-time.After(time.Second):
+		t.Fatal("the health check was not stopped")
+	}
+	if report := health.Report()[HealthKey].(map[string]map[string]HostStatus); len(report) != 0 {
+		t.Errorf("unexpected report: %v", report)
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	if _, err := GetConfig(config.ExtraConfig{}); err != ErrNoConfigFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+	cfg, err := GetConfig(config.ExtraConfig{Namespace: map[string]interface{}{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := fmt.Sprintf("%+v", *cfg), fmt.Sprintf("%+v", Config{
+		Path: DefaultPath, ExpectedStatus: http.StatusOK, Interval: DefaultInterval, Timeout: DefaultTimeout,
+		HealthyThreshold: DefaultHealthyThreshold, UnhealthyThreshold: DefaultUnhealthyThreshold,
+	}); have != want {
+		t.Errorf("unexpected config. have: %s, want: %s", have, want)
+	}
+	for _, v := range []map[string]interface{}{{"interval": "often"}, {"timeout": "-1s"}} {
+		if _, err := GetConfig(config.ExtraConfig{Namespace: v}); err == nil {
+			t.Errorf("%v: expecting an error", v)
+		}
+	}
+	if s := Wrap(context.Background(), logging.NoOp, "GET /", &config.Backend{}, sd.FixedSubscriber{}); fmt.Sprintf("%T", s) != "sd.FixedSubscriber" {
+		t.Errorf("unexpected subscriber: %T", s)
+	}
+}
@@ -0,0 +1,299 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package sd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/health"
+	"github.com/luraproject/lura/v2/logging"
+)
+
+// OutlierNamespace 被动异常检测在Backend的ExtraConfig中的配置键.
+//
+//	"extra_config": {
+//		"github_com/luraproject/lura/sd/outlier": {
+//			"consecutive_errors": 5,
+//			"base_ejection_time": "30s",
+//			"max_ejection_time": "5m",
+//			"max_ejection_percent": 50
+//		}
+//	}
+//
+// 连续返回consecutive_errors次5xx或连接错误的后端被暂时移出均衡器.
+// 第n次移出的时长为n*base_ejection_time, 不超过max_ejection_time;
+// 同时被移出的后端不超过总数的max_ejection_percent.
+const OutlierNamespace = "github_com/luraproject/lura/sd/outlier"
+
+// OutlierHealthKey 异常检测的状态在/__health中的名称.
+const OutlierHealthKey = "outliers"
+
+// 默认配置.
+const (
+	DefaultConsecutiveErrors  = 5
+	DefaultBaseEjectionTime   = 30 * time.Second
+	DefaultMaxEjectionTime    = 5 * time.Minute
+	DefaultMaxEjectionPercent = 50
+)
+
+// ErrNoOutlierConfig 没有配置异常检测.
+var ErrNoOutlierConfig = errors.New("sd: no outlier detection configuration found")
+
+// OutlierConfig 被动异常检测配置.
+type OutlierConfig struct {
+	// ConsecutiveErrors 移出后端所需的连续失败次数
+	ConsecutiveErrors int `json:"consecutive_errors"`
+	// BaseEjectionTime 第一次移出的时长
+	BaseEjectionTime time.Duration `json:"-"`
+	// MaxEjectionTime 移出时长的上限
+	MaxEjectionTime time.Duration `json:"-"`
+	// MaxEjectionPercent 同时被移出的后端占总数的最大百分比
+	MaxEjectionPercent int `json:"max_ejection_percent"`
+}
+
+// GetOutlierConfig 从ExtraConfig中解析异常检测配置, 没有配置时返回ErrNoOutlierConfig.
+func GetOutlierConfig(e config.ExtraConfig) (*OutlierConfig, error) {
+	v, ok := e[OutlierNamespace]
+	if !ok {
+		return nil, ErrNoOutlierConfig
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &OutlierConfig{}
+	aux := struct {
+		*OutlierConfig
+		BaseEjectionTime string `json:"base_ejection_time"`
+		MaxEjectionTime  string `json:"max_ejection_time"`
+	}{OutlierConfig: cfg}
+	if err = json.Unmarshal(b, &aux); err != nil {
+		return nil, err
+	}
+
+	cfg.BaseEjectionTime = DefaultBaseEjectionTime
+	if aux.BaseEjectionTime != "" {
+		if cfg.BaseEjectionTime, err = time.ParseDuration(aux.BaseEjectionTime); err != nil {
+			return nil, fmt.Errorf("invalid base_ejection_time: %s", err.Error())
+		}
+	}
+	cfg.MaxEjectionTime = DefaultMaxEjectionTime
+	if aux.MaxEjectionTime != "" {
+		if cfg.MaxEjectionTime, err = time.ParseDuration(aux.MaxEjectionTime); err != nil {
+			return nil, fmt.Errorf("invalid max_ejection_time: %s", err.Error())
+		}
+	}
+	if cfg.BaseEjectionTime <= 0 || cfg.MaxEjectionTime < cfg.BaseEjectionTime {
+		return nil, errors.New("base_ejection_time must be positive and not greater than max_ejection_time")
+	}
+	if cfg.ConsecutiveErrors <= 0 {
+		cfg.ConsecutiveErrors = DefaultConsecutiveErrors
+	}
+	if cfg.MaxEjectionPercent == 0 {
+		cfg.MaxEjectionPercent = DefaultMaxEjectionPercent
+	}
+	if cfg.MaxEjectionPercent < 0 || cfg.MaxEjectionPercent > 100 {
+		return nil, fmt.Errorf("invalid max_ejection_percent: %d", cfg.MaxEjectionPercent)
+	}
+	return cfg, nil
+}
+
+// OutlierStatus 单个后端的异常检测状态.
+type OutlierStatus struct {
+	Ejected           bool       `json:"ejected"`
+	EjectedUntil      *time.Time `json:"ejected_until,omitempty"`
+	Ejections         int        `json:"ejections"`
+	ConsecutiveErrors int        `json:"consecutive_errors"`
+}
+
+type outlierHost struct {
+	errors       int
+	ejections    int
+	ejectedUntil time.Time
+}
+
+// OutlierDetector 根据实际请求的结果移出异常的后端. 它实现了Subscriber接口,
+// 在其上创建的均衡器只会选择没有被移出的后端.
+type OutlierDetector struct {
+	name       string
+	subscriber Subscriber
+	cfg        *OutlierConfig
+	logger     logging.Logger
+	now        func() time.Time
+
+	mu    sync.RWMutex
+	hosts map[string]*outlierHost
+}
+
+// NewOutlierDetector 创建异常检测, name用于日志和/__health中的状态.
+// ctx结束或调用Close后不再输出状态.
+func NewOutlierDetector(ctx context.Context, name string, subscriber Subscriber, cfg *OutlierConfig, logger logging.Logger) *OutlierDetector {
+	if logger == nil {
+		logger = logging.NoOp
+	}
+	d := &OutlierDetector{
+		name:       name,
+		subscriber: subscriber,
+		cfg:        cfg,
+		logger:     logger,
+		now:        time.Now,
+		hosts:      map[string]*outlierHost{},
+	}
+	registerOutlierDetector(d)
+	if done := ctx.Done(); done != nil {
+		go func() {
+			<-done
+			d.Close()
+		}()
+	}
+	return d
+}
+
+// Hosts implements the Subscriber interface
+func (d *OutlierDetector) Hosts() ([]string, error) {
+	hosts, err := d.subscriber.Hosts()
+	if err != nil {
+		return hosts, err
+	}
+	now := d.now()
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	res := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if st, ok := d.hosts[h]; !ok || !now.Before(st.ejectedUntil) {
+			res = append(res, h)
+		}
+	}
+	return res, nil
+}
+
+// Report 记录一次发送到host的请求的结果, failed表示后端返回了5xx或连接失败.
+func (d *OutlierDetector) Report(host string, failed bool) {
+	if !failed {
+		d.mu.RLock()
+		st, ok := d.hosts[host]
+		clean := !ok || st.errors == 0
+		d.mu.RUnlock()
+		if clean {
+			return
+		}
+	}
+
+	now := d.now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st, ok := d.hosts[host]
+	if !ok {
+		st = &outlierHost{}
+		d.hosts[host] = st
+	}
+	if !failed {
+		st.errors = 0
+		return
+	}
+	// 已经被移出的后端上未完成的请求
+	if now.Before(st.ejectedUntil) {
+		return
+	}
+	if st.errors++; st.errors < d.cfg.ConsecutiveErrors {
+		return
+	}
+
+	pool, _ := d.subscriber.Hosts()
+	if ejected := d.ejected(pool, now); (ejected+1)*100 > len(pool)*d.cfg.MaxEjectionPercent {
+		if st.errors > d.cfg.ConsecutiveErrors {
+			return
+		}
+		d.logger.Warning(fmt.Sprintf("[BACKEND: %s][Outlier] %s not ejected: %d of %d hosts are already ejected",
+			d.name, host, ejected, len(pool)))
+		return
+	}
+
+	// 回到均衡器后保持一段时间正常, 移出时长重新计算
+	if !st.ejectedUntil.IsZero() && now.Sub(st.ejectedUntil) > d.cfg.MaxEjectionTime {
+		st.ejections = 0
+	}
+	st.ejections++
+	st.errors = 0
+	ejection := time.Duration(st.ejections) * d.cfg.BaseEjectionTime
+	if ejection > d.cfg.MaxEjectionTime {
+		ejection = d.cfg.MaxEjectionTime
+	}
+	st.ejectedUntil = now.Add(ejection)
+	d.logger.Warning(fmt.Sprintf("[BACKEND: %s][Outlier] %s ejected for %s after %d consecutive errors",
+		d.name, host, ejection, d.cfg.ConsecutiveErrors))
+}
+
+func (d *OutlierDetector) ejected(pool []string, now time.Time) int {
+	n := 0
+	for _, h := range pool {
+		if st, ok := d.hosts[h]; ok && now.Before(st.ejectedUntil) {
+			n++
+		}
+	}
+	return n
+}
+
+// Status 返回各后端的异常检测状态.
+func (d *OutlierDetector) Status() map[string]OutlierStatus {
+	now := d.now()
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	res := make(map[string]OutlierStatus, len(d.hosts))
+	for h, st := range d.hosts {
+		s := OutlierStatus{Ejections: st.ejections, ConsecutiveErrors: st.errors}
+		if now.Before(st.ejectedUntil) {
+			until := st.ejectedUntil
+			s.Ejected = true
+			s.EjectedUntil = &until
+		}
+		res[h] = s
+	}
+	return res
+}
+
+// Close 停止在/__health中输出状态.
+func (d *OutlierDetector) Close() {
+	outlierDetectorsMu.Lock()
+	delete(outlierDetectors, d)
+	outlierDetectorsMu.Unlock()
+}
+
+var (
+	outlierDetectorsMu  = &sync.Mutex{}
+	outlierDetectors    = map[*OutlierDetector]struct{}{}
+	outlierRegisterOnce sync.Once
+)
+
+func registerOutlierDetector(d *OutlierDetector) {
+	outlierRegisterOnce.Do(func() { health.Register(OutlierHealthKey, OutlierReport) })
+	outlierDetectorsMu.Lock()
+	outlierDetectors[d] = struct{}{}
+	outlierDetectorsMu.Unlock()
+}
+
+// OutlierReport 汇总所有异常检测的状态, 按Backend的URLPattern分组.
+func OutlierReport() interface{} {
+	outlierDetectorsMu.Lock()
+	list := make([]*OutlierDetector, 0, len(outlierDetectors))
+	for d := range outlierDetectors {
+		list = append(list, d)
+	}
+	outlierDetectorsMu.Unlock()
+
+	report := make(map[string]map[string]OutlierStatus, len(list))
+	for _, d := range list {
+		st := d.Status()
+		for k, v := range report[d.name] {
+			st[k] = v
+		}
+		report[d.name] = st
+	}
+	return report
+}
@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package sd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/health"
+)
+
+func newTestOutlierDetector(hosts []string, cfg *OutlierConfig) (*OutlierDetector, *time.Time) {
+	now := time.Now()
+	d := NewOutlierDetector(context.Background(), "/faces", FixedSubscriber(hosts), cfg, nil)
+	d.now = func() time.Time { return now }
+	return d, &now
+}
+
+func TestOutlierDetector(t *testing.T) {
+	cfg := &OutlierConfig{ConsecutiveErrors: 3, BaseEjectionTime: time.Second, MaxEjectionTime: 3 * time.Second, MaxEjectionPercent: 50}
+	d, now := newTestOutlierDetector([]string{"a", "b", "c", "d"}, cfg)
+	defer d.Close()
+
+	assertHosts := func(want int) {
+		t.Helper()
+		if hosts, err := d.Hosts(); err != nil || len(hosts) != want {
+			t.Errorf("unexpected hosts: %v %v", hosts, err)
+		}
+	}
+
+	// 成功的请求重置连续失败的次数
+	d.Report("a", true)
+	d.Report("a", true)
+	d.Report("a", false)
+	d.Report("a", true)
+	assertHosts(4)
+
+	d.Report("a", true)
+	d.Report("a", true)
+	assertHosts(3)
+	if st := d.Status()["a"]; !st.Ejected || st.Ejections != 1 || st.EjectedUntil == nil {
+		t.Errorf("unexpected status: %+v", st)
+	}
+
+	// 移出的时长逐次增加, 不超过上限
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		if i > 0 {
+			for j := 0; j < 3; j++ {
+				d.Report("a", true)
+			}
+		}
+		if have := d.Status()["a"].EjectedUntil.Sub(*now); have != want {
+			t.Errorf("ejection #%d: want %s, have %s", i+1, want, have)
+		}
+		*now = now.Add(want)
+		assertHosts(4)
+	}
+
+	// 长时间正常后重新计算
+	*now = now.Add(time.Minute)
+	for j := 0; j < 3; j++ {
+		d.Report("a", true)
+	}
+	if st := d.Status()["a"]; st.Ejections != 1 {
+		t.Errorf("unexpected status: %+v", st)
+	}
+}
+
+func TestOutlierDetector_maxEjectionPercent(t *testing.T) {
+	cfg := &OutlierConfig{ConsecutiveErrors: 1, BaseEjectionTime: time.Second, MaxEjectionTime: time.Second, MaxEjectionPercent: 50}
+	d, _ := newTestOutlierDetector([]string{"a", "b", "c"}, cfg)
+	defer d.Close()
+
+	for _, h := range []string{"a", "b", "c"} {
+		d.Report(h, true)
+	}
+	if hosts, _ := d.Hosts(); len(hosts) != 2 {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+
+	single, _ := newTestOutlierDetector([]string{"a"}, cfg)
+	defer single.Close()
+	single.Report("a", true)
+	if hosts, _ := single.Hosts(); len(hosts) != 1 {
+		t.Errorf("the last host should never be ejected: %v", hosts)
+	}
+}
+
+func TestOutlierReport(t *testing.T) {
+	cfg := &OutlierConfig{ConsecutiveErrors: 1, BaseEjectionTime: time.Second, MaxEjectionTime: time.Second, MaxEjectionPercent: 100}
+	d, _ := newTestOutlierDetector([]string{"a"}, cfg)
+	d.Report("a", true)
+
+	report, ok := health.Report()[OutlierHealthKey].(map[string]map[string]OutlierStatus)
+	if !ok || !report["/faces"]["a"].Ejected {
+		t.Errorf("unexpected report: %v", health.Report()[OutlierHealthKey])
+	}
+	d.Close()
+	if report := OutlierReport().(map[string]map[string]OutlierStatus); len(report) != 0 {
+		t.Errorf("unexpected report: %v", report)
+	}
+}
+
+func TestOutlierDetector_contextDone(t *testing.T) {
+	cfg := &OutlierConfig{ConsecutiveErrors: 1, BaseEjectionTime: time.Second, MaxEjectionTime: time.Second, MaxEjectionPercent: 100}
+	ctx, cancel := context.WithCancel(context.Background())
+	d := NewOutlierDetector(ctx, "/faces", FixedSubscriber([]string{"a"}), cfg, nil)
+	defer d.Close()
+	d.Report("a", true)
+
+	cancel()
+	for i := 0; i < 100; i++ {
+		if report := OutlierReport().(map[string]map[string]OutlierStatus); len(report) == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("the detector was not closed")
+}
+
+func TestGetOutlierConfig(t *testing.T) {
+	if _, err := GetOutlierConfig(config.ExtraConfig{}); err != ErrNoOutlierConfig {
+		t.Errorf("unexpected error: %v", err)
+	}
+	cfg, err := GetOutlierConfig(config.ExtraConfig{OutlierNamespace: map[string]interface{}{"base_ejection_time": "10s"}})
+	if err != nil || cfg.ConsecutiveErrors != DefaultConsecutiveErrors || cfg.BaseEjectionTime != 10*time.Second ||
+		cfg.MaxEjectionTime != DefaultMaxEjectionTime || cfg.MaxEjectionPercent != DefaultMaxEjectionPercent {
+		t.Errorf("unexpected config: %+v %v", cfg, err)
+	}
+	for _, v := range []map[string]interface{}{
+		{"base_ejection_time": "soon"},
+		{"base_ejection_time": "10m", "max_ejection_time": "1m"},
+		{"max_ejection_percent": 120},
+	} {
+		if _, err := GetOutlierConfig(config.ExtraConfig{OutlierNamespace: v}); err == nil {
+			t.Errorf("%v: expecting an error", v)
+		}
+	}
+}
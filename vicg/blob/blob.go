@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+Package blob 提供保存图片等二进制数据的存储, 插件可以将大对象卸载到存储中, 只在报文中保留其地址.
+*/
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrExists 存储键已经保存了不同的数据.
+var ErrExists = errors.New("blob: key already exists")
+
+// Store 二进制数据的存储.
+type Store interface {
+	// Put 保存数据, 返回可以替代数据的地址或存储键.
+	// 不覆盖已经存在的数据: key已保存相同的数据时直接返回, 数据不同时返回ErrExists.
+	Put(ctx context.Context, key string, data []byte) (string, error)
+}
+
+// LocalStore 基于本地文件系统的存储.
+type LocalStore struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalStore 创建基于本地目录dir的存储.
+// baseURL不为空时, Put返回baseURL + "/" + key, 否则返回key.
+func NewLocalStore(dir, baseURL string) (*LocalStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("blob: empty directory")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Put 将数据写入dir下的key文件. 先写临时文件再硬链接到key, 读取方不会看到不完整的文件,
+// 已经存在的文件也不会被覆盖.
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	name, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".blob-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Link(tmp.Name(), name)
+	}
+	os.Remove(tmp.Name())
+	if os.IsExist(err) {
+		if old, rerr := os.ReadFile(name); rerr == nil && bytes.Equal(old, data) {
+			err = nil
+		} else {
+			err = fmt.Errorf("%w: '%s'", ErrExists, key)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if s.baseURL == "" {
+		return key, nil
+	}
+	return s.baseURL + "/" + key, nil
+}
+
+// path 返回key对应的文件路径, 拒绝指向dir之外的key.
+func (s *LocalStore) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("blob: invalid key '%s'", key)
+	}
+	return filepath.Join(s.dir, clean), nil
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package blob
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalStore(dir, "http://127.0.0.1:8080/images/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, err := s.Put(context.Background(), "20210601/a.jpg", []byte("image"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "http://127.0.0.1:8080/images/20210601/a.jpg" {
+		t.Errorf("unexpected url: %s", url)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "20210601", "a.jpg"))
+	if err != nil || string(b) != "image" {
+		t.Errorf("unexpected content: %s %v", b, err)
+	}
+
+	for _, key := range []string{"", "..", "../a.jpg", "/etc/a.jpg"} {
+		if _, err := s.Put(context.Background(), key, []byte("image")); err == nil {
+			t.Errorf("%s: expecting an error", key)
+		}
+	}
+
+	// 相同的数据直接返回, 不同的数据不覆盖
+	if _, err := s.Put(context.Background(), "20210601/a.jpg", []byte("image")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := s.Put(context.Background(), "20210601/a.jpg", []byte("other")); !errors.Is(err, ErrExists) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "20210601", "a.jpg")); string(b) != "image" {
+		t.Errorf("the file should not be overwritten: %s", b)
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(dir, "20210601", ".blob-*")); len(tmp) != 0 {
+		t.Errorf("unexpected temporary files: %v", tmp)
+	}
+
+	s, _ = NewLocalStore(dir, "")
+	if key, err := s.Put(context.Background(), "b.jpg", []byte("image")); err != nil || key != "b.jpg" {
+		t.Errorf("unexpected key: %s %v", key, err)
+	}
+}
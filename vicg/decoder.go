@@ -0,0 +1,238 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package vicg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/luraproject/lura/v2/proxy"
+)
+
+/* ***************************************************************************
+* 代码功能: 解析GA/T 1400请求报文
+* 	插件链执行之前解析一次请求报文, 将其中的对象填充到Request.Data, 各插件共享.
+* 	Data的键为对象类型, 即去掉"Object"后缀的对象名称, 例如:
+*
+* 	{"FaceListObject":{"FaceObject":[{...},{...}]}} => Data["Face"] = [{...},{...}]
+* 	{"RegisterObject":{"DeviceID":"..."}}           => Data["Register"] = [{...}]
+*
+* 	不是JSON的报文不做解析; 格式错误的报文返回VIID错误状态. 解析后请求报文可以再次读取.
+*************************************************************************** */
+
+// ErrCodeInvalidBody 请求报文格式错误的错误码.
+const ErrCodeInvalidBody = "INVALID_VIID_BODY"
+
+// ErrCodeBodyTooLarge 请求报文超过最大字节数的错误码.
+const ErrCodeBodyTooLarge = "BODY_TOO_LARGE"
+
+const (
+	objectSuffix     = "Object"
+	listObjectSuffix = "ListObject"
+)
+
+// decodeRequest 解析请求报文并填充request.Data. 已经解析过的请求不会重复解析.
+func decodeRequest(request *proxy.Request) error {
+	if request.Body == nil || request.Data != nil || !isJSONContent(request.HeaderGet("Content-Type")) {
+		return nil
+	}
+	b, err := readBody(request)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil
+	}
+
+	data, err := DecodeViidObjects(b)
+	if err != nil {
+		return err
+	}
+	request.Data = data
+	return nil
+}
+
+// bufferedBody 已经读入内存的请求报文. 复制请求时直接共享其中的数据, 不必再次读取.
+type bufferedBody struct {
+	*bytes.Reader
+	b []byte
+}
+
+func newBufferedBody(b []byte) *bufferedBody {
+	return &bufferedBody{Reader: bytes.NewReader(b), b: b}
+}
+
+// Close 实现io.Closer接口.
+func (*bufferedBody) Close() error { return nil }
+
+// unread 返回尚未读取的数据.
+func (b *bufferedBody) unread() []byte {
+	return b.b[len(b.b)-b.Len():]
+}
+
+// readBody 读取请求报文尚未读取的数据, 并用bufferedBody替换原报文, 使其可以再次读取.
+// 已经读入内存的报文不会重复读取. 读取失败时返回的PluginError保留底层错误的状态码,
+// 例如报文超过最大字节数时返回413.
+func readBody(request *proxy.Request) ([]byte, error) {
+	if bb, ok := request.Body.(*bufferedBody); ok {
+		b := bb.unread()
+		request.Body = newBufferedBody(b)
+		return b, nil
+	}
+	b, err := io.ReadAll(request.Body)
+	request.Body.Close()
+	if err != nil {
+		var be *proxy.BodyTooLargeError
+		if errors.As(err, &be) {
+			return nil, WrapPluginError(err, be.StatusCode(), ErrCodeBodyTooLarge, proxy.ViidStatusOtherError)
+		}
+		return nil, WrapPluginError(err, http.StatusBadRequest, ErrCodeInvalidBody, proxy.ViidStatusOtherError)
+	}
+	request.Body = newBufferedBody(b)
+	return b, nil
+}
+
+// DecodeViidObjects 解析GA/T 1400报文, 返回按对象类型分组的对象列表.
+// 数值保留为json.Number, 避免丢失精度.
+func DecodeViidObjects(b []byte) (map[string][]map[string]interface{}, error) {
+	envelope := map[string]json.RawMessage{}
+	if err := unmarshalUseNumber(b, &envelope); err != nil {
+		if json.Valid(b) {
+			return nil, invalidBody(proxy.ViidStatusInvalidJSONContent, "the body must be an object")
+		}
+		return nil, invalidBody(proxy.ViidStatusInvalidJSONFormat, "invalid JSON: %s", err.Error())
+	}
+
+	data := map[string][]map[string]interface{}{}
+	for key, raw := range envelope {
+		switch {
+		case strings.HasSuffix(key, listObjectSuffix):
+			dataType := strings.TrimSuffix(key, listObjectSuffix)
+			list := map[string]json.RawMessage{}
+			if err := unmarshalUseNumber(raw, &list); err != nil {
+				return nil, invalidBody(proxy.ViidStatusInvalidJSONContent, "'%s' must be an object", key)
+			}
+			itemsKey := dataType + objectSuffix
+			rawItems, ok := list[itemsKey]
+			if !ok {
+				return nil, invalidBody(proxy.ViidStatusInvalidJSONContent, "'%s' must contain '%s'", key, itemsKey)
+			}
+			items := []map[string]interface{}{}
+			if err := unmarshalUseNumber(rawItems, &items); err != nil {
+				return nil, invalidBody(proxy.ViidStatusInvalidJSONContent, "'%s.%s' must be a list of objects", key, itemsKey)
+			}
+			data[dataType] = append(data[dataType], items...)
+		case strings.HasSuffix(key, objectSuffix):
+			dataType := strings.TrimSuffix(key, objectSuffix)
+			item := map[string]interface{}{}
+			if err := unmarshalUseNumber(raw, &item); err != nil || item == nil {
+				return nil, invalidBody(proxy.ViidStatusInvalidJSONContent, "'%s' must be an object", key)
+			}
+			data[dataType] = append(data[dataType], item)
+		}
+	}
+	return data, nil
+}
+
+// EncodeViidObjects 按原报文envelope的结构将按对象类型分组的对象重新编码为GA/T 1400报文.
+// 原报文中的列表对象和单个对象保持原来的形式, 无法识别的键原样保留; 单个对象变为多个,
+// 或者原报文中没有的类型编码为列表对象: Data["Face"] = [{...}] => {"FaceListObject":{"FaceObject":[{...}]}}.
+// Data中已经删除的类型从报文中删除. envelope为空或者不是JSON对象时所有类型都编码为列表对象.
+func EncodeViidObjects(envelope []byte, data map[string][]map[string]interface{}) ([]byte, error) {
+	original := map[string]json.RawMessage{}
+	if len(bytes.TrimSpace(envelope)) > 0 {
+		if err := unmarshalUseNumber(envelope, &original); err != nil {
+			original = map[string]json.RawMessage{}
+		}
+	}
+
+	res := make(map[string]interface{}, len(original)+len(data))
+	encoded := map[string]bool{}
+	for key, raw := range original {
+		switch {
+		case strings.HasSuffix(key, listObjectSuffix):
+			dataType := strings.TrimSuffix(key, listObjectSuffix)
+			items, ok := data[dataType]
+			if !ok || encoded[dataType] {
+				continue
+			}
+			list := map[string]json.RawMessage{}
+			if err := unmarshalUseNumber(raw, &list); err != nil {
+				list = map[string]json.RawMessage{}
+			}
+			b, err := json.Marshal(items)
+			if err != nil {
+				return nil, err
+			}
+			list[dataType+objectSuffix] = b
+			res[key] = list
+			encoded[dataType] = true
+		case strings.HasSuffix(key, objectSuffix):
+			dataType := strings.TrimSuffix(key, objectSuffix)
+			items, ok := data[dataType]
+			if !ok || encoded[dataType] {
+				continue
+			}
+			if _, list := original[dataType+listObjectSuffix]; list || len(items) != 1 {
+				// 由列表对象或者下面的默认形式编码
+				continue
+			}
+			res[key] = items[0]
+			encoded[dataType] = true
+		default:
+			res[key] = raw
+		}
+	}
+	for dataType, items := range data {
+		if !encoded[dataType] {
+			res[dataType+listObjectSuffix] = map[string]interface{}{dataType + objectSuffix: items}
+		}
+	}
+	return json.Marshal(res)
+}
+
+// EncodeRequest 按照Request.Data重新编码请求报文, 原报文的结构和无法识别的键保持不变.
+// 编码后的报文替换Request.Body, 并更新ContentLength.
+func EncodeRequest(request *proxy.Request) error {
+	var envelope []byte
+	if request.Body != nil {
+		b, err := readBody(request)
+		if err != nil {
+			return err
+		}
+		envelope = b
+	}
+	b, err := EncodeViidObjects(envelope, request.Data)
+	if err != nil {
+		return err
+	}
+	request.Body = newBufferedBody(b)
+	request.ContentLength = int64(len(b))
+	return nil
+}
+
+func unmarshalUseNumber(b []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if d.More() {
+		return fmt.Errorf("unexpected data after the top-level value")
+	}
+	return nil
+}
+
+func invalidBody(viidCode int, format string, a ...interface{}) error {
+	return NewPluginError(http.StatusBadRequest, ErrCodeInvalidBody, viidCode, fmt.Sprintf(format, a...))
+}
+
+// isJSONContent 只解析Content-Type声明为JSON的报文.
+func isJSONContent(contentType string) bool {
+	return strings.Contains(strings.ToLower(contentType), "json")
+}
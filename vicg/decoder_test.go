@@ -0,0 +1,238 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package vicg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/proxy"
+)
+
+func TestDecodeViidObjects(t *testing.T) {
+	data, err := DecodeViidObjects([]byte(`{
+		"FaceListObject": {"FaceObject": [{"FaceID": "1", "LeftTopX": 12345678901234567}, {"FaceID": "2"}]},
+		"MotorVehicleListObject": {"MotorVehicleObject": []},
+		"RegisterObject": {"DeviceID": "31010000001190000001"},
+		"Other": 1
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 3 || len(data["Face"]) != 2 || len(data["MotorVehicle"]) != 0 || len(data["Register"]) != 1 {
+		t.Errorf("unexpected data: %v", data)
+	}
+	if n, ok := data["Face"][0]["LeftTopX"].(json.Number); !ok || n.String() != "12345678901234567" {
+		t.Errorf("unexpected number: %v", data["Face"][0]["LeftTopX"])
+	}
+
+	for body, code := range map[string]int{
+		`{"FaceListObject":`:                         proxy.ViidStatusInvalidJSONFormat,
+		`[1, 2]`:                                     proxy.ViidStatusInvalidJSONContent,
+		`{"FaceListObject": []}`:                     proxy.ViidStatusInvalidJSONContent,
+		`{"FaceListObject": {}}`:                     proxy.ViidStatusInvalidJSONContent,
+		`{"FaceListObject": {"FacesObject": []}}`:    proxy.ViidStatusInvalidJSONContent,
+		`{"FaceListObject": {"FaceObject": {}}}`:     proxy.ViidStatusInvalidJSONContent,
+		`{"FaceListObject": {"FaceObject": [1]}}`:    proxy.ViidStatusInvalidJSONContent,
+		`{"RegisterObject": "31010000001190000001"}`: proxy.ViidStatusInvalidJSONContent,
+	} {
+		_, err := DecodeViidObjects([]byte(body))
+		var pe *PluginError
+		if !errors.As(err, &pe) || pe.ViidCode != code || pe.StatusCode() != http.StatusBadRequest {
+			t.Errorf("%s: unexpected error: %v", body, err)
+		}
+	}
+}
+
+func TestEncodeViidObjects(t *testing.T) {
+	b, err := EncodeViidObjects(nil, map[string][]map[string]interface{}{
+		"Face": {{"FaceID": "1", "LeftTopX": json.Number("12345678901234567")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"FaceListObject":{"FaceObject":[{"FaceID":"1","LeftTopX":12345678901234567}]}}` {
+		t.Errorf("unexpected body: %s", b)
+	}
+	data, err := DecodeViidObjects(b)
+	if err != nil || len(data["Face"]) != 1 {
+		t.Errorf("unexpected data: %v %v", data, err)
+	}
+}
+
+func TestEncodeViidObjects_envelope(t *testing.T) {
+	envelope := []byte(`{"RegisterObject":{"DeviceID":"1"},"FaceListObject":{"FaceObject":[{"FaceID":"1"}],"Count":1},"MotorVehicleObject":{"ID":"1"},"Extra":{"a":1}}`)
+	for _, tc := range []struct {
+		data     map[string][]map[string]interface{}
+		expected string
+	}{
+		{
+			data: map[string][]map[string]interface{}{
+				"Register":     {{"DeviceID": "2"}},
+				"Face":         {{"FaceID": "2"}},
+				"MotorVehicle": {{"ID": "1"}, {"ID": "2"}},
+			},
+			expected: `{"Extra":{"a":1},"FaceListObject":{"Count":1,"FaceObject":[{"FaceID":"2"}]},"MotorVehicleListObject":{"MotorVehicleObject":[{"ID":"1"},{"ID":"2"}]},"RegisterObject":{"DeviceID":"2"}}`,
+		},
+		{
+			data: map[string][]map[string]interface{}{
+				"Register": {{"DeviceID": "1"}},
+				"Person":   {{"PersonID": "1"}},
+			},
+			expected: `{"Extra":{"a":1},"PersonListObject":{"PersonObject":[{"PersonID":"1"}]},"RegisterObject":{"DeviceID":"1"}}`,
+		},
+	} {
+		b, err := EncodeViidObjects(envelope, tc.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tc.expected {
+			t.Errorf("unexpected body. have: %s, want: %s", b, tc.expected)
+		}
+	}
+}
+
+func TestEncodeRequest(t *testing.T) {
+	request := &proxy.Request{
+		Headers: map[string][]string{"Content-Type": {proxy.ViidContentType}},
+		Body:    io.NopCloser(strings.NewReader(`{"APEObject":{"ApeID":"1"},"Extra":true}`)),
+	}
+	if err := decodeRequest(request); err != nil {
+		t.Fatal(err)
+	}
+	request.Data["APE"][0]["Name"] = "gate"
+	if err := EncodeRequest(request); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(request.Body)
+	if have, want := string(b), `{"APEObject":{"ApeID":"1","Name":"gate"},"Extra":true}`; have != want {
+		t.Errorf("unexpected body. have: %s, want: %s", have, want)
+	}
+	if request.ContentLength != int64(len(b)) {
+		t.Errorf("unexpected content length: %d", request.ContentLength)
+	}
+}
+
+func TestIsJSONContent(t *testing.T) {
+	for ct, expected := range map[string]bool{
+		"":                                false,
+		"application/VIID+JSON":           true,
+		"application/json; charset=UTF-8": true,
+		"image/jpeg":                      false,
+	} {
+		if isJSONContent(ct) != expected {
+			t.Errorf("unexpected result for '%s'", ct)
+		}
+	}
+}
+
+func TestDefaultVicgFactory_decode(t *testing.T) {
+	recorder := &testRecorder{}
+	var faces int
+	var body string
+	p := newTestProxy(t,
+		map[string]VicgPlugin{
+			"face": &testPlugin{index: 1, recorder: recorder, handle: func(_ context.Context, request *proxy.Request, _ *proxy.Response) error {
+				faces = len(request.Data["Face"])
+				b, _ := io.ReadAll(request.Body)
+				body = string(b)
+				return nil
+			}},
+		},
+		&config.PluginConfig{Name: "face", Index: 1, Match: &config.PluginMatch{DataType: []string{"Face"}}},
+	)
+
+	payload := `{"FaceListObject":{"FaceObject":[{"FaceID":"1"}]}}`
+	_, err := p(context.Background(), &proxy.Request{
+		Headers: map[string][]string{"Content-Type": {proxy.ViidContentType}},
+		Body:    io.NopCloser(strings.NewReader(payload)),
+	})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if faces != 1 || body != payload {
+		t.Errorf("unexpected request. faces: %d, body: %s", faces, body)
+	}
+
+	resp, err := p(context.Background(), &proxy.Request{
+		Path:    "/VIID/Faces",
+		Headers: map[string][]string{"Content-Type": {proxy.ViidContentType}},
+		Body:    io.NopCloser(strings.NewReader(`{"FaceListObject":`)),
+	})
+	if err == nil {
+		t.Error("expecting an error")
+	}
+	if resp.Metadata.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status code: %d", resp.Metadata.StatusCode)
+	}
+	if have, want := recorder.String(), "[handle-1]"; have != want {
+		t.Errorf("unexpected execution order. have: %s, want: %s", have, want)
+	}
+}
+
+func TestDecodeRequest_bodyTooLarge(t *testing.T) {
+	request := &proxy.Request{
+		Headers: map[string][]string{"Content-Type": {proxy.ViidContentType}},
+		Body:    proxy.LimitBody(io.NopCloser(strings.NewReader(`{"FaceListObject":{}}`)), 4),
+	}
+	err := decodeRequest(request)
+	var pe *PluginError
+	if !errors.As(err, &pe) || pe.StatusCode() != http.StatusRequestEntityTooLarge || pe.Code != ErrCodeBodyTooLarge {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDefaultVicgFactory_timedPluginBodyTooLarge(t *testing.T) {
+	recorder := &testRecorder{}
+	p := newTestProxy(t,
+		map[string]VicgPlugin{"timed": &testPlugin{index: 1, recorder: recorder}},
+		&config.PluginConfig{Name: "timed", Index: 1, Timeout: time.Second},
+	)
+	// 不是JSON的报文不做解析, 由带超时的插件第一次读取
+	resp, err := p(context.Background(), &proxy.Request{
+		Path:    "/VIID/Images",
+		Headers: map[string][]string{"Content-Type": {"image/jpeg"}},
+		Body:    proxy.LimitBody(io.NopCloser(strings.NewReader("0123456789")), 4),
+	})
+	var pe *PluginError
+	if !errors.As(err, &pe) || pe.Code != ErrCodeBodyTooLarge {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if resp.Metadata.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("unexpected status code: %d", resp.Metadata.StatusCode)
+	}
+	if have, want := recorder.String(), "[]"; have != want {
+		t.Errorf("unexpected execution order. have: %s, want: %s", have, want)
+	}
+}
+
+func TestDefaultVicgFactory_decodeErrorFinalizer(t *testing.T) {
+	recorder := &testRecorder{}
+	audit := &testFinalizerPlugin{testPlugin: testPlugin{index: 1, recorder: recorder}}
+	p := newTestProxy(t,
+		map[string]VicgPlugin{"audit": audit},
+		&config.PluginConfig{Name: "audit", Index: 1},
+	)
+
+	resp, err := p(context.Background(), &proxy.Request{
+		Path:    "/VIID/Faces",
+		Headers: map[string][]string{"Content-Type": {proxy.ViidContentType}},
+		Body:    io.NopCloser(strings.NewReader(`{"FaceListObject":`)),
+	})
+	if err == nil || audit.finalErr != err {
+		t.Errorf("unexpected error: %v, finalizer: %v", err, audit.finalErr)
+	}
+	if resp.Metadata.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status code: %d", resp.Metadata.StatusCode)
+	}
+	if have, want := recorder.String(), "[finally-1]"; have != want {
+		t.Errorf("unexpected execution order. have: %s, want: %s", have, want)
+	}
+}
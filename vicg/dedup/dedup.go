@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+Package dedup 提供带有效期的键存储, 用于识别设备重复上传的对象.
+*/
+package dedup
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store 带有效期的键存储. 多个网关实例共享去重结果时, 可以基于Redis等实现该接口.
+type Store interface {
+	// Add 记录key, 有效期为ttl. key已存在且未过期时返回false.
+	Add(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Remove 删除key, 使其可以再次被记录.
+	Remove(ctx context.Context, key string) error
+}
+
+// pruneInterval 内存存储清理过期键的最小间隔.
+const pruneInterval = time.Minute
+
+// NewInMemoryStore 创建基于内存的存储, 过期的键在后续的Add中被清理.
+func NewInMemoryStore() Store {
+	return &inMemoryStore{keys: map[string]time.Time{}, now: time.Now}
+}
+
+type inMemoryStore struct {
+	mu        sync.Mutex
+	keys      map[string]time.Time
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func (m *inMemoryStore) Add(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastPrune) >= pruneInterval {
+		for k, expiry := range m.keys {
+			if !now.Before(expiry) {
+				delete(m.keys, k)
+			}
+		}
+		m.lastPrune = now
+	}
+	if expiry, ok := m.keys[key]; ok && now.Before(expiry) {
+		return false, nil
+	}
+	m.keys[key] = now.Add(ttl)
+	return true, nil
+}
+
+func (m *inMemoryStore) Remove(_ context.Context, key string) error {
+	m.mu.Lock()
+	delete(m.keys, key)
+	m.mu.Unlock()
+	return nil
+}
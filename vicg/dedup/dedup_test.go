@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package dedup
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInMemoryStore(t *testing.T) {
+	now := time.Now()
+	s := NewInMemoryStore().(*inMemoryStore)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if ok, _ := s.Add(ctx, "a", time.Minute); !ok {
+		t.Error("the key should be added")
+	}
+	if ok, _ := s.Add(ctx, "a", time.Minute); ok {
+		t.Error("the key should be a duplicate")
+	}
+	s.Remove(ctx, "a")
+	if ok, _ := s.Add(ctx, "a", time.Minute); !ok {
+		t.Error("the removed key should be added")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if ok, _ := s.Add(ctx, "a", time.Minute); !ok {
+		t.Error("the expired key should be added")
+	}
+	s.Add(ctx, "b", time.Second)
+	now = now.Add(2 * time.Minute)
+	s.Add(ctx, "c", time.Minute)
+	if len(s.keys) != 1 {
+		t.Errorf("the expired keys were not pruned: %v", s.keys)
+	}
+}
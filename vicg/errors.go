@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package vicg
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/luraproject/lura/v2/proxy"
+)
+
+// ErrorCodeHeader 应答中携带机器可读错误码的HTTP头.
+const ErrorCodeHeader = "X-Vicg-Error-Code"
+
+// PluginError 插件返回的结构化错误.
+// 它携带HTTP状态码、GA/T 1400应答状态码以及机器可读的错误码,
+// 网关会将其渲染为ResponseStatusObject应答.
+type PluginError struct {
+	// Status HTTP状态码
+	Status int
+	// Code 机器可读的错误码, 如"IDENTIFY_CHECK_FAILED"
+	Code string
+	// ViidCode GA/T 1400应答状态码
+	ViidCode int
+	// Message 错误描述, 作为应答的StatusString
+	Message string
+	// Err 原始错误, 可以为nil
+	Err error
+}
+
+// NewPluginError 创建插件错误.
+func NewPluginError(status int, code string, viidCode int, message string) *PluginError {
+	return &PluginError{
+		Status:   status,
+		Code:     code,
+		ViidCode: viidCode,
+		Message:  message,
+	}
+}
+
+// WrapPluginError 用插件错误包装原始错误, 错误描述取自原始错误.
+func WrapPluginError(err error, status int, code string, viidCode int) *PluginError {
+	return &PluginError{
+		Status:   status,
+		Code:     code,
+		ViidCode: viidCode,
+		Message:  err.Error(),
+		Err:      err,
+	}
+}
+
+// Error 实现error接口.
+func (e *PluginError) Error() string {
+	if e.Err != nil && e.Err.Error() != e.Message {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap 返回原始错误.
+func (e *PluginError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode 返回HTTP状态码.
+func (e *PluginError) StatusCode() int {
+	if e.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return e.Status
+}
+
+// ErrorCode 返回机器可读的错误码.
+func (e *PluginError) ErrorCode() string {
+	return e.Code
+}
+
+// Apply 将错误写入应答: 设置状态码、错误码头以及ResponseStatusObject.
+// 应答中已有的其他HTTP头会被保留, 已记录的对象应答状态会被丢弃.
+func (e *PluginError) Apply(response *proxy.Response, requestURL string) {
+	if response.Metadata.Headers == nil {
+		response.Metadata.Headers = map[string][]string{}
+	}
+	response.Metadata.Headers["Content-Type"] = []string{proxy.ViidContentType}
+	if e.Code != "" {
+		response.Metadata.Headers[ErrorCodeHeader] = []string{e.Code}
+	}
+	response.Metadata.StatusCode = e.StatusCode()
+	response.IsComplete = false
+	response.Io = nil
+	response.StatusList = nil
+	response.SetResponseStatus(proxy.NewResponseStatus(requestURL, "", e.ViidCode, e.Message))
+}
+
+// ToResponse 根据错误创建应答.
+func (e *PluginError) ToResponse(requestURL string) *proxy.Response {
+	response := &proxy.Response{}
+	e.Apply(response, requestURL)
+	return response
+}
+
+// MultiError 同一优先级并行执行的插件返回的多个错误.
+type MultiError struct {
+	errs []error
+}
+
+// Error 实现error接口.
+func (m *MultiError) Error() string {
+	msgs := make([]string, len(m.errs))
+	for i, err := range m.errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Errors 返回所有的错误.
+func (m *MultiError) Errors() []error {
+	return m.errs
+}
+
+// asPluginError 返回err中的插件错误. 对于MultiError, 返回第一个插件错误.
+func asPluginError(err error) (*PluginError, bool) {
+	var pe *PluginError
+	if errors.As(err, &pe) {
+		return pe, true
+	}
+	var me *MultiError
+	if errors.As(err, &me) {
+		for _, e := range me.errs {
+			if errors.As(e, &pe) {
+				return pe, true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package vicg
+
+import (
+	"fmt"
+	"plugin"
+	"strings"
+
+	"github.com/luraproject/lura/v2/logging"
+	luraplugin "github.com/luraproject/lura/v2/plugin"
+)
+
+/* ***************************************************************************
+* 代码功能: 从Go插件(.so)中加载插件工厂
+* 	插件需要导出如下函数, 加载器调用它将插件工厂按名称注册到工厂集合中:
+*
+* 	func RegisterVicgPlugins(register func(name string, factory vicg.VicgPluginFactory)) {
+* 		register("IdentifyCheck", identifycheck.Factory{})
+* 	}
+*
+* 	插件需要与网关使用相同版本的Go和依赖库编译: go build -buildmode=plugin
+*************************************************************************** */
+
+// RegisterVicgPluginsSymbol 加载器在插件中查找的符号.
+const RegisterVicgPluginsSymbol = "RegisterVicgPlugins"
+
+// LoadPlugins 扫描目录下名称包含pattern的Go插件, 将其中的插件工厂注册到factory中.
+// 返回成功加载的插件数量, 加载失败的插件会被跳过, 其错误信息汇总在返回的error中.
+// 与已有名称重复的插件工厂不会覆盖原有的工厂.
+func LoadPlugins(path, pattern string, factory map[string]VicgPluginFactory, logger logging.Logger) (int, error) {
+	plugins, err := luraplugin.Scan(path, pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	errs := []string{}
+	loaded := 0
+	for k, pluginName := range plugins {
+		names, err := openPlugin(pluginName, factory)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("plugin #%d (%s): %s", k, pluginName, err.Error()))
+			continue
+		}
+		if logger != nil {
+			logger.Info(fmt.Sprintf("[VICG] Plugin %s loaded: %s", pluginName, strings.Join(names, ", ")))
+		}
+		loaded++
+	}
+
+	if len(errs) > 0 {
+		return loaded, fmt.Errorf("vicg plugin loader found %d error(s): \n%s", len(errs), strings.Join(errs, "\n"))
+	}
+	return loaded, nil
+}
+
+// openPlugin 打开单个插件并注册其中的插件工厂, 返回注册的插件名称.
+func openPlugin(pluginName string, factory map[string]VicgPluginFactory) (names []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var ok bool
+			err, ok = r.(error)
+			if !ok {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+
+	p, err := pluginOpener(pluginName)
+	if err != nil {
+		return nil, err
+	}
+	s, err := p.Lookup(RegisterVicgPluginsSymbol)
+	if err != nil {
+		return nil, err
+	}
+	register, ok := s.(func(func(string, VicgPluginFactory)))
+	if !ok {
+		return nil, fmt.Errorf("the symbol '%s' has an unexpected type %T", RegisterVicgPluginsSymbol, s)
+	}
+
+	// 先收集, 全部合法时才注册, 避免注册一半的插件
+	registered := map[string]VicgPluginFactory{}
+	var duplicated []string
+	register(func(name string, f VicgPluginFactory) {
+		if _, ok := factory[name]; ok {
+			duplicated = append(duplicated, name)
+			return
+		}
+		if _, ok := registered[name]; ok {
+			duplicated = append(duplicated, name)
+			return
+		}
+		registered[name] = f
+		names = append(names, name)
+	})
+	if len(duplicated) > 0 {
+		return nil, fmt.Errorf("duplicated plugin name(s): %s", strings.Join(duplicated, ", "))
+	}
+	for name, f := range registered {
+		factory[name] = f
+	}
+	return names, nil
+}
+
+// Plugin is the interface of the loaded plugins
+type Plugin interface {
+	Lookup(name string) (plugin.Symbol, error)
+}
+
+// pluginOpener keeps the plugin open function in a var for easy testing
+var pluginOpener = defaultPluginOpener
+
+func defaultPluginOpener(name string) (Plugin, error) {
+	return plugin.Open(name)
+}
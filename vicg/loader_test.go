@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package vicg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"plugin"
+	"testing"
+)
+
+type fakePlugin map[string]plugin.Symbol
+
+func (p fakePlugin) Lookup(name string) (plugin.Symbol, error) {
+	s, ok := p[name]
+	if !ok {
+		return nil, errors.New("symbol not found")
+	}
+	return s, nil
+}
+
+func TestLoadPlugins(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.so", "b.so", "c.so", "d.so", "e.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte{}, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugins := map[string]Plugin{
+		"a.so": fakePlugin{RegisterVicgPluginsSymbol: func(register func(string, VicgPluginFactory)) {
+			register("A", testPluginFactory{})
+			register("B", testPluginFactory{})
+		}},
+		"b.so": fakePlugin{RegisterVicgPluginsSymbol: func(register func(string, VicgPluginFactory)) {
+			register("C", testPluginFactory{})
+			register("Compiled", testPluginFactory{})
+		}},
+		"c.so": fakePlugin{RegisterVicgPluginsSymbol: "wrong type"},
+		"d.so": fakePlugin{},
+	}
+	defer func(o func(string) (Plugin, error)) { pluginOpener = o }(pluginOpener)
+	pluginOpener = func(name string) (Plugin, error) {
+		return plugins[filepath.Base(name)], nil
+	}
+
+	compiled := testPluginFactory{}
+	factory := map[string]VicgPluginFactory{"Compiled": compiled}
+	total, err := LoadPlugins(dir, ".so", factory, nil)
+	if err == nil {
+		t.Error("expecting an error")
+	}
+	if total != 1 {
+		t.Errorf("unexpected number of loaded plugins. have %d, want 1", total)
+	}
+	if len(factory) != 3 {
+		t.Errorf("unexpected factories: %v", factory)
+	}
+	for _, name := range []string{"A", "B", "Compiled"} {
+		if _, ok := factory[name]; !ok {
+			t.Errorf("the factory '%s' not registered", name)
+		}
+	}
+}
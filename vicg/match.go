@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package vicg
+
+import (
+	"net/textproto"
+	"strings"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/proxy"
+)
+
+// matchRequest 判断请求是否满足插件的执行条件.
+func matchRequest(m *config.PluginMatch, request *proxy.Request) bool {
+	if m == nil {
+		return true
+	}
+	if len(m.Method) != 0 && !matchMethod(m.Method, request.Method) {
+		return false
+	}
+	for k, v := range m.Header {
+		h, ok := request.Headers[textproto.CanonicalMIMEHeaderKey(k)]
+		if !ok || !matchValue(v, h...) {
+			return false
+		}
+	}
+	for k, v := range m.Query {
+		q, ok := request.Query[k]
+		if !ok || !matchValue(v, q...) {
+			return false
+		}
+	}
+	for k, v := range m.Param {
+		p, ok := request.Params[canonicalParam(k)]
+		if !ok || !matchValue(v, p) {
+			return false
+		}
+	}
+	if len(m.DataType) != 0 && !matchDataType(m.DataType, request.Data) {
+		return false
+	}
+	return true
+}
+
+func matchMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchValue 期望值为空时总是满足, 否则任一取值与其相等即可.
+func matchValue(expected string, values ...string) bool {
+	if expected == "" {
+		return true
+	}
+	for _, v := range values {
+		if v == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func matchDataType(types []string, data map[string][]map[string]interface{}) bool {
+	for _, t := range types {
+		if _, ok := data[t]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalParam 路由器将路径参数的首字母转为大写, 这里保持一致.
+func canonicalParam(key string) string {
+	if key == "" {
+		return key
+	}
+	return strings.ToUpper(key[:1]) + key[1:]
+}
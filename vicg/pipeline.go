@@ -0,0 +1,349 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package vicg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/proxy"
+)
+
+// ErrCodePluginTimeout 插件执行超时的错误码.
+const ErrCodePluginTimeout = "PLUGIN_TIMEOUT"
+
+// pluginEntry 插件及其配置.
+type pluginEntry struct {
+	VicgPlugin
+	cfg *config.PluginConfig
+}
+
+// checkTimeoutPolicy 校验插件的超时策略.
+func checkTimeoutPolicy(cfg *config.PluginConfig) error {
+	switch cfg.OnTimeout {
+	case "", config.PluginTimeoutFail, config.PluginTimeoutSkip:
+		return nil
+	}
+	return fmt.Errorf("the plugin '%s' has an unknown timeout policy '%s'", cfg.Name, cfg.OnTimeout)
+}
+
+// groupByPriority 将已排序的插件按优先级分组.
+func groupByPriority(plugins []pluginEntry) [][]pluginEntry {
+	groups := [][]pluginEntry{}
+	for i, p := range plugins {
+		if i == 0 || p.Priority() != plugins[i-1].Priority() {
+			groups = append(groups, []pluginEntry{p})
+			continue
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], p)
+	}
+	return groups
+}
+
+// executeGroup 执行同一优先级的插件.
+// 同一优先级的多个插件并行执行, 各自使用请求和应答的副本. 每个插件结束时在互斥锁的保护下,
+// 将它在副本上相对于执行前的修改合并到共享的请求和应答中, 同一个值被多个插件修改时以最后结束的插件为准.
+// 所有的错误按配置顺序汇总为MultiError. 副本中的应答数据只是浅拷贝, 插件应替换而不是原地修改已有的值.
+func (pf defaultVicgFactory) executeGroup(ctx context.Context, group []pluginEntry, request *proxy.Request, response *proxy.Response) error {
+	if len(group) == 1 {
+		return pf.execute(ctx, group[0], request, response)
+	}
+
+	requests := make([]*proxy.Request, len(group))
+	bodies := make([]io.ReadCloser, len(group))
+	for i := range group {
+		r, err := cloneRequest(request)
+		if err != nil {
+			return err
+		}
+		requests[i], bodies[i] = r, r.Body
+	}
+	baseRequest := snapshotRequest(request)
+	baseResponse := cloneResponse(response)
+
+	var mu sync.Mutex
+	errs := make([]error, len(group))
+	var wg sync.WaitGroup
+	for i, p := range group {
+		scratch := cloneResponse(response)
+		wg.Add(1)
+		go func(i int, p pluginEntry) {
+			defer wg.Done()
+			err := pf.execute(ctx, p, requests[i], scratch)
+			mu.Lock()
+			defer mu.Unlock()
+			mergeRequest(request, baseRequest, requests[i], bodies[i])
+			mergeResponse(response, baseResponse, scratch)
+			errs[i] = err
+		}(i, p)
+	}
+	wg.Wait()
+
+	var me []error
+	for _, err := range errs {
+		if err != nil {
+			me = append(me, err)
+		}
+	}
+	switch len(me) {
+	case 0:
+		return nil
+	case 1:
+		return me[0]
+	}
+	return &MultiError{errs: me}
+}
+
+// execute 执行单个插件.
+// 配置了超时的插件在派生的上下文中执行, 并写入请求和应答的副本: 按时完成才会提交副本,
+// 超时则丢弃副本并按照OnTimeout策略跳过或中止. 超时后仍在运行的插件只会修改被丢弃的副本.
+func (pf defaultVicgFactory) execute(ctx context.Context, p pluginEntry, request *proxy.Request, response *proxy.Response) error {
+	if p.cfg.Timeout <= 0 {
+		return p.HandleHTTPMessage(ctx, request, response)
+	}
+
+	localCtx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+
+	localRequest, err := cloneRequest(request)
+	if err != nil {
+		return err
+	}
+	scratch := cloneResponse(response)
+	done := make(chan error, 1)
+	go func() {
+		done <- p.HandleHTTPMessage(localCtx, localRequest, scratch)
+	}()
+
+	select {
+	case err := <-done:
+		*request = *localRequest
+		*response = *scratch
+		return err
+	case <-localCtx.Done():
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.cfg.OnTimeout == config.PluginTimeoutSkip {
+		pf.logger.Warnf("The '%s' plugin timed out after %v on %s '%s'. Skipping it.", p.cfg.Name, p.cfg.Timeout, request.Method, request.Path)
+		return nil
+	}
+	return NewPluginError(
+		http.StatusGatewayTimeout,
+		ErrCodePluginTimeout,
+		proxy.ViidStatusDeviceBusy,
+		fmt.Sprintf("the '%s' plugin timed out after %v", p.cfg.Name, p.cfg.Timeout),
+	)
+}
+
+// cloneRequest 深拷贝请求, 使插件对副本的修改不影响原请求.
+// 原请求和副本各自持有一份可以读取的报文: 已经解析过的报文直接共享, 不会重复读取.
+func cloneRequest(request *proxy.Request) (*proxy.Request, error) {
+	clone := *request
+	clone.Headers = proxy.CloneRequestHeaders(request.Headers)
+	clone.Params = proxy.CloneRequestParams(request.Params)
+	if request.Query != nil {
+		clone.Query = make(url.Values, len(request.Query))
+		for k, vs := range request.Query {
+			clone.Query[k] = append([]string(nil), vs...)
+		}
+	}
+	if request.URL != nil {
+		u := *request.URL
+		clone.URL = &u
+	}
+	clone.Private = copyMap(request.Private)
+	clone.Reserved = copyMap(request.Reserved)
+	if request.Data != nil {
+		clone.Data = make(map[string][]map[string]interface{}, len(request.Data))
+		for t, objects := range request.Data {
+			list := make([]map[string]interface{}, len(objects))
+			for i, o := range objects {
+				list[i], _ = DeepCopy(o).(map[string]interface{})
+			}
+			clone.Data[t] = list
+		}
+	}
+	if request.Body != nil {
+		b, err := readBody(request)
+		if err != nil {
+			return nil, err
+		}
+		clone.Body = newBufferedBody(b)
+	}
+	return &clone, nil
+}
+
+// snapshotRequest 记录请求中可以被插件修改的部分, 作为合并时比较的基准.
+// 插件只会修改请求的副本, 因此Data中的对象不必深拷贝.
+func snapshotRequest(request *proxy.Request) *proxy.Request {
+	snapshot := &proxy.Request{
+		Headers:  proxy.CloneRequestHeaders(request.Headers),
+		Private:  copyMap(request.Private),
+		Reserved: copyMap(request.Reserved),
+	}
+	if request.Data != nil {
+		snapshot.Data = make(map[string][]map[string]interface{}, len(request.Data))
+		for t, objects := range request.Data {
+			snapshot.Data[t] = objects
+		}
+	}
+	return snapshot
+}
+
+// mergeRequest 将插件在请求副本上相对于base的修改合并到请求中.
+// body为副本执行前的报文, 插件替换了报文时一并替换请求的报文.
+func mergeRequest(request, base, scratch *proxy.Request, body io.ReadCloser) {
+	request.Private = mergeMap(request.Private, base.Private, scratch.Private)
+	request.Reserved = mergeMap(request.Reserved, base.Reserved, scratch.Reserved)
+	for k, v := range scratch.Headers {
+		if old, ok := base.Headers[k]; !ok || !reflect.DeepEqual(old, v) {
+			if request.Headers == nil {
+				request.Headers = map[string][]string{}
+			}
+			request.Headers[k] = v
+		}
+	}
+	for k := range base.Headers {
+		if _, ok := scratch.Headers[k]; !ok {
+			delete(request.Headers, k)
+		}
+	}
+	for t, objects := range scratch.Data {
+		if old, ok := base.Data[t]; !ok || !reflect.DeepEqual(old, objects) {
+			if request.Data == nil {
+				request.Data = map[string][]map[string]interface{}{}
+			}
+			request.Data[t] = objects
+		}
+	}
+	for t := range base.Data {
+		if _, ok := scratch.Data[t]; !ok {
+			delete(request.Data, t)
+		}
+	}
+	if scratch.Body != body {
+		request.Body = scratch.Body
+		request.ContentLength = scratch.ContentLength
+	}
+}
+
+// mergeMap 将scratch相对于base的修改合并到m中, 返回合并后的map.
+func mergeMap(m, base, scratch map[string]interface{}) map[string]interface{} {
+	for k, v := range scratch {
+		if old, ok := base[k]; !ok || !reflect.DeepEqual(old, v) {
+			if m == nil {
+				m = map[string]interface{}{}
+			}
+			m[k] = v
+		}
+	}
+	for k := range base {
+		if _, ok := scratch[k]; !ok {
+			delete(m, k)
+		}
+	}
+	return m
+}
+
+// copyMap 复制map的第一层.
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
+
+// DeepCopy 深拷贝JSON解码得到的值: map、数组以及其中的基本类型, 其他类型的值原样返回.
+// 插件可以用它复制共享的数据, 避免修改原数据.
+func DeepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			res[k] = DeepCopy(e)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(t))
+		for i, e := range t {
+			res[i] = DeepCopy(e)
+		}
+		return res
+	case []map[string]interface{}:
+		res := make([]map[string]interface{}, len(t))
+		for i, e := range t {
+			res[i], _ = DeepCopy(e).(map[string]interface{})
+		}
+		return res
+	default:
+		return v
+	}
+}
+
+// cloneResponse 复制应答, 使插件对副本的修改不影响原应答.
+func cloneResponse(response *proxy.Response) *proxy.Response {
+	clone := *response
+	clone.Data = make(map[string]interface{}, len(response.Data))
+	for k, v := range response.Data {
+		clone.Data[k] = v
+	}
+	clone.Metadata.Headers = proxy.CloneRequestHeaders(response.Metadata.Headers)
+	clone.StatusList = append([]proxy.ResponseStatus(nil), response.StatusList...)
+	return &clone
+}
+
+// mergeResponse 将插件在副本上相对于base的修改合并到应答中.
+func mergeResponse(response, base, scratch *proxy.Response) {
+	if response.Data == nil {
+		response.Data = map[string]interface{}{}
+	}
+	if response.Metadata.Headers == nil {
+		response.Metadata.Headers = map[string][]string{}
+	}
+	for k, v := range scratch.Data {
+		if old, ok := base.Data[k]; !ok || !reflect.DeepEqual(old, v) {
+			response.Data[k] = v
+		}
+	}
+	for k := range base.Data {
+		if _, ok := scratch.Data[k]; !ok {
+			delete(response.Data, k)
+		}
+	}
+	for k, v := range scratch.Metadata.Headers {
+		if old, ok := base.Metadata.Headers[k]; !ok || !reflect.DeepEqual(old, v) {
+			response.Metadata.Headers[k] = v
+		}
+	}
+	for k := range base.Metadata.Headers {
+		if _, ok := scratch.Metadata.Headers[k]; !ok {
+			delete(response.Metadata.Headers, k)
+		}
+	}
+	if scratch.Metadata.StatusCode != base.Metadata.StatusCode {
+		response.Metadata.StatusCode = scratch.Metadata.StatusCode
+	}
+	if scratch.IsComplete != base.IsComplete {
+		response.IsComplete = scratch.IsComplete
+	}
+	// 应答状态只会追加
+	if len(scratch.StatusList) > len(base.StatusList) {
+		response.StatusList = append(response.StatusList, scratch.StatusList[len(base.StatusList):]...)
+	}
+	if scratch.Io != base.Io {
+		response.Io = scratch.Io
+	}
+}
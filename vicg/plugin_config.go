@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package vicg
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/* ***************************************************************************
+* 代码功能: 类型化的插件配置
+* 	插件工厂实现ConfigurableFactory接口以声明配置结构, 网关注册接口时将
+* 	PluginConfig.Config解码到该结构并校验, 结果保存在PluginConfig.Parsed中.
+* 	字段名称取自json标签, 匹配时不区分大小写; 校验规则写在validate标签中:
+*
+* 	type Config struct {
+* 		Length int    `json:"Length" validate:"min=1,max=64"`
+* 		Mode   string `json:"Mode" validate:"required,oneof=strict loose"`
+* 	}
+*
+* 	支持的规则: required(不能为零值, 如""或0; 有默认值时可以省略), min/max(数值的大小或字符串、数组的长度),
+* 	oneof(取值之一, 以空格分隔). 配置结构还可以实现Validate() error进行额外的校验.
+*************************************************************************** */
+
+// ConfigurableFactory 插件工厂可选实现的接口, 声明插件的配置结构.
+type ConfigurableFactory interface {
+	VicgPluginFactory
+	// NewConfig 返回填充了默认值的配置结构的指针.
+	NewConfig() interface{}
+}
+
+// configValidator 配置结构可选实现的接口.
+type configValidator interface {
+	Validate() error
+}
+
+// DecodePluginConfig 将原始配置解码到target指向的结构体中并校验, 返回所有不合法的字段.
+func DecodePluginConfig(raw map[string]interface{}, target interface{}) []error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return []error{fmt.Errorf("the config must be a pointer to a struct, got %T", target)}
+	}
+	rv = rv.Elem()
+
+	fields := map[string]int{}
+	names := make([]string, rv.NumField())
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[i] = name
+		fields[strings.ToLower(name)] = i
+	}
+
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	failed := map[int]bool{}
+	for _, k := range keys {
+		i, ok := fields[strings.ToLower(k)]
+		if !ok {
+			errs = append(errs, fmt.Errorf("field '%s': unknown field", k))
+			continue
+		}
+		b, err := json.Marshal(raw[k])
+		if err == nil {
+			err = json.Unmarshal(b, rv.Field(i).Addr().Interface())
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("field '%s': %s", names[i], decodeErrorString(err)))
+			failed[i] = true
+		}
+	}
+
+	for i, name := range names {
+		if name == "" || failed[i] {
+			continue
+		}
+		for _, rule := range strings.Split(rv.Type().Field(i).Tag.Get("validate"), ",") {
+			if err := checkRule(rule, rv.Field(i)); err != nil {
+				errs = append(errs, fmt.Errorf("field '%s': %s", name, err.Error()))
+			}
+		}
+	}
+
+	if v, ok := target.(configValidator); ok && len(errs) == 0 {
+		if err := v.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func decodeErrorString(err error) string {
+	if e, ok := err.(*json.UnmarshalTypeError); ok {
+		return fmt.Sprintf("expected %s, got %s", e.Type.String(), e.Value)
+	}
+	return err.Error()
+}
+
+// checkRule 按照单条校验规则检查字段.
+func checkRule(rule string, v reflect.Value) error {
+	rule = strings.TrimSpace(rule)
+	if rule == "" {
+		return nil
+	}
+	name, arg := rule, ""
+	if i := strings.Index(rule, "="); i != -1 {
+		name, arg = rule[:i], rule[i+1:]
+	}
+
+	switch name {
+	case "required":
+		if v.IsZero() {
+			return fmt.Errorf("is required")
+		}
+		return nil
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Errorf("invalid rule '%s'", rule)
+		}
+		n, ok := measure(v)
+		if !ok {
+			return fmt.Errorf("invalid rule '%s' for %s", rule, v.Type())
+		}
+		if name == "min" && n < limit {
+			return fmt.Errorf("must be at least %s", arg)
+		}
+		if name == "max" && n > limit {
+			return fmt.Errorf("must be at most %s", arg)
+		}
+		return nil
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, o := range strings.Fields(arg) {
+			if s == o {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of [%s], got '%s'", arg, s)
+	}
+	return fmt.Errorf("unknown rule '%s'", rule)
+}
+
+// measure 返回数值的大小或字符串、数组的长度.
+func measure(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true
+	}
+	return 0, false
+}
@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+Package session 管理通过注册、保活、注销接口接入的设备会话.
+*/
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+)
+
+// Namespace 会话管理在ServiceConfig.ExtraConfig中的配置键.
+const Namespace = "github_com/luraproject/lura/vicg/session"
+
+// 默认配置.
+const (
+	// DefaultExpiry 超过该时间没有保活的会话视为过期
+	DefaultExpiry = 3 * time.Minute
+	// DefaultSweepInterval 清理过期会话的间隔
+	DefaultSweepInterval = time.Minute
+)
+
+// Session 设备会话.
+type Session struct {
+	DeviceID      string    `json:"DeviceID"`
+	RemoteAddr    string    `json:"RemoteAddr"`
+	RegisteredAt  time.Time `json:"RegisteredAt"`
+	LastKeepalive time.Time `json:"LastKeepalive"`
+	ExpiresAt     time.Time `json:"ExpiresAt"`
+}
+
+// Config 会话管理的配置.
+type Config struct {
+	// Expiry 会话的有效期, 如"3m"
+	Expiry string `json:"expiry"`
+	// SweepInterval 清理过期会话的间隔, 如"1m"
+	SweepInterval string `json:"sweep_interval"`
+}
+
+// ConfigGetter 从ExtraConfig中解析会话管理的配置, 未配置的字段使用默认值.
+func ConfigGetter(e config.ExtraConfig) (expiry, sweep time.Duration, err error) {
+	expiry, sweep = DefaultExpiry, DefaultSweepInterval
+	v, ok := e[Namespace]
+	if !ok {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	cfg := Config{}
+	if err = json.Unmarshal(b, &cfg); err != nil {
+		return
+	}
+	if cfg.Expiry != "" {
+		if expiry, err = time.ParseDuration(cfg.Expiry); err != nil {
+			return
+		}
+	}
+	if cfg.SweepInterval != "" {
+		sweep, err = time.ParseDuration(cfg.SweepInterval)
+	}
+	return
+}
+
+// Manager 设备会话管理器, 可以并发使用.
+type Manager struct {
+	mu       sync.RWMutex
+	expiry   time.Duration
+	sessions map[string]*Session
+	now      func() time.Time
+}
+
+// NewManager 创建会话管理器.
+func NewManager(expiry time.Duration) *Manager {
+	if expiry <= 0 {
+		expiry = DefaultExpiry
+	}
+	return &Manager{
+		expiry:   expiry,
+		sessions: map[string]*Session{},
+		now:      time.Now,
+	}
+}
+
+// Register 注册设备, 已有的会话会被替换.
+func (m *Manager) Register(deviceID, remoteAddr string) Session {
+	now := m.now()
+	s := &Session{
+		DeviceID:      deviceID,
+		RemoteAddr:    remoteAddr,
+		RegisteredAt:  now,
+		LastKeepalive: now,
+		ExpiresAt:     now.Add(m.expiry),
+	}
+	m.mu.Lock()
+	m.sessions[deviceID] = s
+	m.mu.Unlock()
+	return *s
+}
+
+// Keepalive 延长设备会话的有效期, 设备未注册或会话已过期时返回false.
+func (m *Manager) Keepalive(deviceID string) bool {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[deviceID]
+	if !ok {
+		return false
+	}
+	if now.After(s.ExpiresAt) {
+		delete(m.sessions, deviceID)
+		return false
+	}
+	s.LastKeepalive = now
+	s.ExpiresAt = now.Add(m.expiry)
+	return true
+}
+
+// Unregister 注销设备, 设备未注册时返回false.
+func (m *Manager) Unregister(deviceID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.sessions[deviceID]
+	delete(m.sessions, deviceID)
+	return ok
+}
+
+// Get 查询设备的有效会话.
+func (m *Manager) Get(deviceID string) (Session, bool) {
+	now := m.now()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[deviceID]
+	if !ok || now.After(s.ExpiresAt) {
+		return Session{}, false
+	}
+	return *s, true
+}
+
+// List 返回所有有效的会话, 按设备编码排序.
+func (m *Manager) List() []Session {
+	now := m.now()
+	m.mu.RLock()
+	list := make([]Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		if !now.After(s.ExpiresAt) {
+			list = append(list, *s)
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].DeviceID < list[j].DeviceID })
+	return list
+}
+
+// Sweep 清理过期的会话, 返回清理的数量.
+func (m *Manager) Sweep() int {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	total := 0
+	for id, s := range m.sessions {
+		if now.After(s.ExpiresAt) {
+			delete(m.sessions, id)
+			total++
+		}
+	}
+	return total
+}
+
+// Run 周期性地清理过期的会话, 直到ctx结束.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultSweepInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Sweep()
+		}
+	}
+}
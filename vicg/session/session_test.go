@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+)
+
+func TestManager(t *testing.T) {
+	now := time.Now()
+	m := NewManager(time.Minute)
+	m.now = func() time.Time { return now }
+
+	m.Register("1", "127.0.0.1:1234")
+	m.Register("2", "127.0.0.1:1235")
+	if _, ok := m.Get("1"); !ok {
+		t.Error("the session 1 not found")
+	}
+	if m.Keepalive("3") {
+		t.Error("unexpected keepalive of an unregistered device")
+	}
+
+	now = now.Add(50 * time.Second)
+	if !m.Keepalive("1") {
+		t.Error("unexpected keepalive failure")
+	}
+	now = now.Add(50 * time.Second)
+	if _, ok := m.Get("2"); ok {
+		t.Error("the session 2 should be expired")
+	}
+	if m.Keepalive("2") {
+		t.Error("unexpected keepalive of an expired session")
+	}
+	if list := m.List(); len(list) != 1 || list[0].DeviceID != "1" {
+		t.Errorf("unexpected sessions: %v", list)
+	}
+
+	if !m.Unregister("1") || m.Unregister("1") {
+		t.Error("unexpected unregister result")
+	}
+	if len(m.List()) != 0 {
+		t.Errorf("unexpected sessions: %v", m.List())
+	}
+
+	m.Register("4", "")
+	now = now.Add(2 * time.Minute)
+	if n := m.Sweep(); n != 1 {
+		t.Errorf("unexpected number of swept sessions: %d", n)
+	}
+}
+
+func TestConfigGetter(t *testing.T) {
+	expiry, sweep, err := ConfigGetter(config.ExtraConfig{Namespace: map[string]interface{}{"expiry": "90s"}})
+	if err != nil || expiry != 90*time.Second || sweep != DefaultSweepInterval {
+		t.Errorf("unexpected config: %v %v %v", expiry, sweep, err)
+	}
+	if _, _, err := ConfigGetter(config.ExtraConfig{Namespace: map[string]interface{}{"expiry": "soon"}}); err == nil {
+		t.Error("expecting an error")
+	}
+}
@@ -0,0 +1,301 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package subscribe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/luraproject/lura/v2/backoff"
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/proxy"
+)
+
+// Namespace 通知分发在ServiceConfig.ExtraConfig中的配置键.
+const Namespace = "github_com/luraproject/lura/vicg/subscribe"
+
+const logPrefix = "[VICG: Subscribe]"
+
+// 默认配置.
+const (
+	DefaultMaxRetries = 3
+	DefaultTimeout    = 5 * time.Second
+	DefaultWorkers    = 4
+	DefaultQueueSize  = 1024
+)
+
+// Config 通知分发的配置.
+type Config struct {
+	// MaxRetries 通知失败后的最大重试次数
+	MaxRetries int `json:"max_retries"`
+	// BackoffStrategy 重试的退避策略, 见backoff.GetByName
+	BackoffStrategy string `json:"backoff_strategy"`
+	// Timeout 单次通知的超时时间
+	Timeout time.Duration `json:"-"`
+	// Workers 发送通知的并发数
+	Workers int `json:"workers"`
+	// QueueSize 待发送通知的队列长度, 队列满时丢弃新的通知
+	QueueSize int `json:"queue_size"`
+	// AllowedReceivers 允许接收通知的主机名、IP或CIDR, 为空时允许除回环、链路本地等以外的任意地址
+	AllowedReceivers []string `json:"allowed_receivers"`
+}
+
+// ConfigGetter 从ExtraConfig中解析通知分发的配置, 未配置的字段使用默认值.
+func ConfigGetter(e config.ExtraConfig) (Config, error) {
+	cfg := Config{
+		MaxRetries: DefaultMaxRetries,
+		Timeout:    DefaultTimeout,
+		Workers:    DefaultWorkers,
+		QueueSize:  DefaultQueueSize,
+	}
+	v, ok := e[Namespace]
+	if !ok {
+		return cfg, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return cfg, err
+	}
+	aux := struct {
+		*Config
+		Timeout string `json:"timeout"`
+	}{Config: &cfg}
+	if err = json.Unmarshal(b, &aux); err != nil {
+		return cfg, err
+	}
+	if aux.Timeout != "" {
+		if cfg.Timeout, err = time.ParseDuration(aux.Timeout); err != nil {
+			return cfg, err
+		}
+	}
+	if _, err = newReceiverPolicy(cfg.AllowedReceivers); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Notification GA/T 1400订阅通知对象.
+type Notification struct {
+	NotificationID string `json:"NotificationID"`
+	SubscribeID    string `json:"SubscribeID"`
+	Title          string `json:"Title"`
+	TriggerTime    string `json:"TriggerTime"`
+	InfoIDs        string `json:"InfoIDs"`
+	// Objects 按对象类型分组的对象, 序列化为FaceObjectList等字段
+	Objects map[string][]map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON 将对象列表展开为"<类型>ObjectList":{"<类型>Object":[...]}.
+func (n Notification) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{
+		"NotificationID": n.NotificationID,
+		"SubscribeID":    n.SubscribeID,
+		"Title":          n.Title,
+		"TriggerTime":    n.TriggerTime,
+		"InfoIDs":        n.InfoIDs,
+	}
+	for t, objects := range n.Objects {
+		m[t+"ObjectList"] = map[string]interface{}{t + "Object": objects}
+	}
+	return json.Marshal(m)
+}
+
+// delivery 待发送的通知, body在入队前编码, 发送时不再访问请求中的对象.
+type delivery struct {
+	url         string
+	subscribeID string
+	body        []byte
+}
+
+// Dispatcher 将上传的对象匹配有效的订阅, 并向订阅者发送SubscribeNotificationList.
+type Dispatcher struct {
+	store   Store
+	cfg     Config
+	backoff backoff.TimeToWaitBeforeRetry
+	client  *http.Client
+	policy  *receiverPolicy
+	logger  logging.Logger
+	queue   chan delivery
+	seq     uint64
+	now     func() time.Time
+}
+
+// NewDispatcher 创建通知分发器, 需要调用Run才会发送通知.
+func NewDispatcher(store Store, cfg Config, logger logging.Logger) *Dispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if logger == nil {
+		logger = logging.NoOp
+	}
+	policy, err := newReceiverPolicy(cfg.AllowedReceivers)
+	if err != nil {
+		logger.Error(logPrefix, "Ignoring the allowed receivers:", err.Error())
+		policy, _ = newReceiverPolicy(nil)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// 经过代理时连接的是代理服务器, 绕过了对订阅者地址的检查, 因此不使用环境变量中的代理
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   policy.control,
+	}).DialContext
+	return &Dispatcher{
+		store:   store,
+		cfg:     cfg,
+		backoff: backoff.GetByName(cfg.BackoffStrategy),
+		client:  &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		policy:  policy,
+		logger:  logger,
+		queue:   make(chan delivery, cfg.QueueSize),
+		now:     time.Now,
+	}
+}
+
+// CheckReceiver 校验订阅的ReceiveAddr是否在允许接收通知的地址中.
+func (d *Dispatcher) CheckReceiver(addr string) error {
+	return d.policy.checkURL(addr)
+}
+
+// Run 启动发送通知的协程, 直到ctx结束.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for i := 0; i < d.cfg.Workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-d.queue:
+					d.send(ctx, job)
+				}
+			}
+		}()
+	}
+	<-ctx.Done()
+}
+
+// Dispatch 为每个匹配的订阅生成一条通知并放入发送队列, 返回入队的通知数量.
+// 订阅指定了ResourceURI时, 只通知DeviceID在其中的对象. 通知在返回前编码完毕,
+// 调用方之后可以继续修改data.
+func (d *Dispatcher) Dispatch(data map[string][]map[string]interface{}) int {
+	if len(data) == 0 {
+		return 0
+	}
+	now := d.now()
+	total := 0
+	for _, s := range d.store.List() {
+		if !s.Active(now) {
+			continue
+		}
+		n := d.match(s, data, now)
+		if n == nil {
+			continue
+		}
+		body, err := json.Marshal(map[string]interface{}{
+			"SubscribeNotificationListObject": map[string]interface{}{
+				"SubscribeNotificationObject": []Notification{*n},
+			},
+		})
+		if err != nil {
+			d.logger.Error(logPrefix, "Encoding the notification for", s.SubscribeID+":", err.Error())
+			continue
+		}
+		select {
+		case d.queue <- delivery{url: s.ReceiveAddr, subscribeID: s.SubscribeID, body: body}:
+			total++
+		default:
+			d.logger.Warning(logPrefix, "The notification queue is full. Dropping the notification for", s.SubscribeID)
+		}
+	}
+	return total
+}
+
+// match 返回订阅匹配的对象组成的通知, 没有匹配的对象时返回nil.
+func (d *Dispatcher) match(s Subscription, data map[string][]map[string]interface{}, now time.Time) *Notification {
+	resources := map[string]struct{}{}
+	for _, r := range splitList(s.ResourceURI) {
+		resources[r] = struct{}{}
+	}
+
+	objects := map[string][]map[string]interface{}{}
+	ids := []string{}
+	for _, t := range s.DataTypes() {
+		for _, o := range data[t] {
+			if len(resources) > 0 {
+				if _, ok := resources[fmt.Sprint(o["DeviceID"])]; !ok {
+					continue
+				}
+			}
+			objects[t] = append(objects[t], o)
+			if id, ok := o[t+"ID"]; ok {
+				ids = append(ids, fmt.Sprint(id))
+			}
+		}
+	}
+	if len(objects) == 0 {
+		return nil
+	}
+	seq := atomic.AddUint64(&d.seq, 1)
+	return &Notification{
+		NotificationID: fmt.Sprintf("%s%s%05d", s.SubscribeID, now.Format(proxy.ViidTimeLayout), seq%100000),
+		SubscribeID:    s.SubscribeID,
+		Title:          s.Title,
+		TriggerTime:    now.Format(proxy.ViidTimeLayout),
+		InfoIDs:        strings.Join(ids, ","),
+		Objects:        objects,
+	}
+}
+
+// send 发送通知, 失败时按照退避策略重试.
+func (d *Dispatcher) send(ctx context.Context, job delivery) {
+	var err error
+	for i := 0; ; i++ {
+		if err = d.post(ctx, job.url, job.body); err == nil {
+			return
+		}
+		if i >= d.cfg.MaxRetries {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.backoff(i + 1)):
+		}
+	}
+	d.logger.Error(logPrefix, "Notifying", job.subscribeID, "at", job.url, "failed:", err.Error())
+}
+
+func (d *Dispatcher) post(ctx context.Context, url string, body []byte) error {
+	if err := d.policy.checkURL(url); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", proxy.ViidContentType)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package subscribe
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// receiverPolicy 限制通知可以发送到的地址, 避免订阅者借助网关访问内部服务.
+//
+// 允许列表中的每一项是主机名、IP或CIDR. 配置了允许列表时, ReceiveAddr的主机名必须在列表中,
+// 或者是列表中的CIDR包含的IP. 回环、链路本地、未指定和组播地址总是被拒绝,
+// 除非被允许列表中的CIDR或IP明确包含; 建立连接时还会校验解析得到的IP.
+type receiverPolicy struct {
+	hosts map[string]struct{}
+	nets  []*net.IPNet
+}
+
+// newReceiverPolicy 解析允许列表.
+func newReceiverPolicy(allowed []string) (*receiverPolicy, error) {
+	p := &receiverPolicy{hosts: map[string]struct{}{}}
+	for _, a := range allowed {
+		a = strings.TrimSpace(a)
+		switch {
+		case a == "":
+			continue
+		case strings.Contains(a, "/"):
+			_, n, err := net.ParseCIDR(a)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed receiver '%s': %s", a, err.Error())
+			}
+			p.nets = append(p.nets, n)
+		case net.ParseIP(a) != nil:
+			ip := net.ParseIP(a)
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			p.nets = append(p.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		default:
+			p.hosts[strings.ToLower(a)] = struct{}{}
+		}
+	}
+	return p, nil
+}
+
+// checkURL 校验订阅的ReceiveAddr.
+func (p *receiverPolicy) checkURL(addr string) error {
+	u, err := url.Parse(addr)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("invalid ReceiveAddr: '%s'", addr)
+	}
+	host := strings.ToLower(u.Hostname())
+	if ip := net.ParseIP(host); ip != nil {
+		if err := p.checkIP(ip); err != nil {
+			return err
+		}
+		if len(p.hosts) > 0 && !p.contains(ip) {
+			return fmt.Errorf("the receiver '%s' is not allowed", host)
+		}
+		return nil
+	}
+	if _, ok := p.hosts[host]; ok || len(p.hosts) == 0 {
+		// 只配置了CIDR时由建立连接时的校验决定
+		return nil
+	}
+	return fmt.Errorf("the receiver '%s' is not allowed", host)
+}
+
+// checkIP 校验IP是否可以接收通知. 主机名的校验由checkURL完成.
+func (p *receiverPolicy) checkIP(ip net.IP) error {
+	if p.contains(ip) {
+		return nil
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("the receiver '%s' is not allowed", ip)
+	}
+	if len(p.nets) > 0 && len(p.hosts) == 0 {
+		return fmt.Errorf("the receiver '%s' is not allowed", ip)
+	}
+	return nil
+}
+
+// control 在建立连接前校验解析得到的IP, 用作net.Dialer.Control.
+func (p *receiverPolicy) control(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("the receiver '%s' is not an IP", host)
+	}
+	return p.checkIP(ip)
+}
+
+func (p *receiverPolicy) contains(ip net.IP) bool {
+	for _, n := range p.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
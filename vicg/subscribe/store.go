@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+Package subscribe 实现GA/T 1400的订阅与通知: 保存订阅, 并将上传的对象通知给订阅者.
+*/
+package subscribe
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luraproject/lura/v2/proxy"
+)
+
+// 订阅状态.
+const (
+	StatusSubscribing = 0
+	StatusCancelled   = 1
+	StatusExpired     = 2
+)
+
+// 订阅的操作类型.
+const (
+	OperateSubscribe = 0
+	OperateCancel    = 1
+)
+
+// subscribeDetails 订阅类别与Request.Data中对象类型的对应关系.
+var subscribeDetails = map[string]string{
+	"11": "Person",
+	"12": "Face",
+	"13": "MotorVehicle",
+	"14": "NonMotorVehicle",
+	"15": "Thing",
+	"16": "File",
+}
+
+// ErrNotFound 订阅不存在.
+var ErrNotFound = errors.New("subscription not found")
+
+// Subscription GA/T 1400订阅对象.
+type Subscription struct {
+	SubscribeID     string `json:"SubscribeID"`
+	Title           string `json:"Title"`
+	SubscribeDetail string `json:"SubscribeDetail"`
+	ResourceURI     string `json:"ResourceURI,omitempty"`
+	ApplicantName   string `json:"ApplicantName,omitempty"`
+	ApplicantOrg    string `json:"ApplicantOrg,omitempty"`
+	BeginTime       string `json:"BeginTime,omitempty"`
+	EndTime         string `json:"EndTime,omitempty"`
+	ReceiveAddr     string `json:"ReceiveAddr"`
+	OperateType     int    `json:"OperateType"`
+	SubscribeStatus int    `json:"SubscribeStatus"`
+}
+
+// Validate 校验订阅对象.
+func (s *Subscription) Validate() error {
+	if s.SubscribeID == "" {
+		return fmt.Errorf("missing SubscribeID")
+	}
+	if len(s.DataTypes()) == 0 {
+		return fmt.Errorf("the subscription '%s' has no supported SubscribeDetail: '%s'", s.SubscribeID, s.SubscribeDetail)
+	}
+	u, err := url.Parse(s.ReceiveAddr)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("the subscription '%s' has an invalid ReceiveAddr: '%s'", s.SubscribeID, s.ReceiveAddr)
+	}
+	for _, t := range []string{s.BeginTime, s.EndTime} {
+		if t == "" {
+			continue
+		}
+		if _, err := time.ParseInLocation(proxy.ViidTimeLayout, t, time.Local); err != nil {
+			return fmt.Errorf("the subscription '%s' has an invalid time: '%s'", s.SubscribeID, t)
+		}
+	}
+	return nil
+}
+
+// DataTypes 返回订阅的对象类型.
+func (s *Subscription) DataTypes() []string {
+	types := []string{}
+	for _, d := range splitList(s.SubscribeDetail) {
+		if t, ok := subscribeDetails[d]; ok {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// Active 判断订阅在now时是否有效.
+func (s *Subscription) Active(now time.Time) bool {
+	if s.SubscribeStatus != StatusSubscribing {
+		return false
+	}
+	if s.BeginTime != "" {
+		if t, err := time.ParseInLocation(proxy.ViidTimeLayout, s.BeginTime, time.Local); err == nil && now.Before(t) {
+			return false
+		}
+	}
+	if s.EndTime != "" {
+		if t, err := time.ParseInLocation(proxy.ViidTimeLayout, s.EndTime, time.Local); err == nil && now.After(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Store 订阅的存储.
+type Store interface {
+	// Create 保存订阅, 同一个SubscribeID的订阅会被替换.
+	Create(s Subscription) error
+	// Cancel 取消订阅, 订阅不存在时返回ErrNotFound.
+	Cancel(id string) error
+	// List 返回所有的订阅.
+	List() []Subscription
+}
+
+// NewInMemoryStore 创建基于内存的订阅存储.
+func NewInMemoryStore() Store {
+	return &inMemoryStore{subscriptions: map[string]Subscription{}}
+}
+
+type inMemoryStore struct {
+	mu            sync.RWMutex
+	subscriptions map[string]Subscription
+}
+
+func (m *inMemoryStore) Create(s Subscription) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	s.SubscribeStatus = StatusSubscribing
+	m.mu.Lock()
+	m.subscriptions[s.SubscribeID] = s
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *inMemoryStore) Cancel(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.subscriptions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	s.SubscribeStatus = StatusCancelled
+	m.subscriptions[id] = s
+	return nil
+}
+
+func (m *inMemoryStore) List() []Subscription {
+	m.mu.RLock()
+	list := make([]Subscription, 0, len(m.subscriptions))
+	for _, s := range m.subscriptions {
+		list = append(list, s)
+	}
+	m.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].SubscribeID < list[j].SubscribeID })
+	return list
+}
+
+// splitList 解析以逗号分隔的列表.
+func splitList(s string) []string {
+	list := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package subscribe
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+)
+
+func TestInMemoryStore(t *testing.T) {
+	store := NewInMemoryStore()
+	for _, s := range []Subscription{
+		{SubscribeID: "a", SubscribeDetail: "99", ReceiveAddr: "http://127.0.0.1/notify"},
+		{SubscribeID: "a", SubscribeDetail: "12", ReceiveAddr: "ftp://127.0.0.1/notify"},
+		{SubscribeID: "a", SubscribeDetail: "12", ReceiveAddr: "http://127.0.0.1/notify", EndTime: "tomorrow"},
+		{SubscribeDetail: "12", ReceiveAddr: "http://127.0.0.1/notify"},
+	} {
+		if err := store.Create(s); err == nil {
+			t.Errorf("expecting an error for %+v", s)
+		}
+	}
+
+	if err := store.Create(Subscription{SubscribeID: "b", SubscribeDetail: "12,13", ReceiveAddr: "http://127.0.0.1/notify"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(Subscription{SubscribeID: "a", SubscribeDetail: "11", ReceiveAddr: "http://127.0.0.1/notify"}); err != nil {
+		t.Fatal(err)
+	}
+	list := store.List()
+	if len(list) != 2 || list[0].SubscribeID != "a" || list[1].SubscribeID != "b" {
+		t.Errorf("unexpected subscriptions: %+v", list)
+	}
+	if types := list[1].DataTypes(); len(types) != 2 || types[0] != "Face" || types[1] != "MotorVehicle" {
+		t.Errorf("unexpected data types: %v", types)
+	}
+
+	if err := store.Cancel("a"); err != nil {
+		t.Error(err)
+	}
+	if err := store.Cancel("c"); err != ErrNotFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if list = store.List(); list[0].SubscribeStatus != StatusCancelled || list[0].Active(time.Now()) {
+		t.Errorf("unexpected subscription: %+v", list[0])
+	}
+}
+
+func TestSubscription_Active(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.Local)
+	for _, tc := range []struct {
+		begin, end string
+		want       bool
+	}{
+		{"", "", true},
+		{"20210601000000", "20210602000000", true},
+		{"20210602000000", "", false},
+		{"", "20210601000000", false},
+	} {
+		s := Subscription{BeginTime: tc.begin, EndTime: tc.end}
+		if got := s.Active(now); got != tc.want {
+			t.Errorf("%s-%s: unexpected result %v", tc.begin, tc.end, got)
+		}
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	var calls int32
+	received := make(chan map[string]interface{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Error(err)
+		}
+		received <- body
+	}))
+	defer ts.Close()
+
+	store := NewInMemoryStore()
+	for _, s := range []Subscription{
+		{SubscribeID: "face", SubscribeDetail: "12", ReceiveAddr: ts.URL, ResourceURI: "dev1"},
+		{SubscribeID: "person", SubscribeDetail: "11", ReceiveAddr: ts.URL},
+		{SubscribeID: "other", SubscribeDetail: "12", ReceiveAddr: ts.URL, ResourceURI: "dev2"},
+	} {
+		if err := store.Create(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewDispatcher(store, Config{MaxRetries: 3, BackoffStrategy: "linear", AllowedReceivers: []string{"127.0.0.1"}}, logging.NoOp)
+	d.backoff = func(int) time.Duration { return time.Millisecond }
+	go d.Run(ctx)
+
+	data := map[string][]map[string]interface{}{
+		"Face": {{"FaceID": "f1", "DeviceID": "dev1"}, {"FaceID": "f2", "DeviceID": "dev3"}},
+	}
+	n := d.Dispatch(data)
+	if n != 1 {
+		t.Fatalf("unexpected number of notifications: %d", n)
+	}
+	// 后续的插件继续修改对象, 不影响已经入队的通知
+	data["Face"][0]["FaceID"] = "changed"
+
+	select {
+	case body := <-received:
+		list := body["SubscribeNotificationListObject"].(map[string]interface{})["SubscribeNotificationObject"].([]interface{})
+		notification := list[0].(map[string]interface{})
+		if notification["SubscribeID"] != "face" || notification["InfoIDs"] != "f1" {
+			t.Errorf("unexpected notification: %v", notification)
+		}
+		faces := notification["FaceObjectList"].(map[string]interface{})["FaceObject"].([]interface{})
+		if len(faces) != 1 || faces[0].(map[string]interface{})["FaceID"] != "f1" {
+			t.Errorf("unexpected faces: %v", faces)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the notification was not delivered")
+	}
+	if c := atomic.LoadInt32(&calls); c != 3 {
+		t.Errorf("unexpected number of attempts: %d", c)
+	}
+}
+
+func TestConfigGetter(t *testing.T) {
+	cfg, err := ConfigGetter(config.ExtraConfig{})
+	if err != nil || cfg.MaxRetries != DefaultMaxRetries || cfg.Timeout != DefaultTimeout {
+		t.Errorf("unexpected config: %+v %v", cfg, err)
+	}
+	cfg, err = ConfigGetter(config.ExtraConfig{Namespace: map[string]interface{}{
+		"max_retries":      5,
+		"backoff_strategy": "exponential",
+		"timeout":          "2s",
+	}})
+	if err != nil || cfg.MaxRetries != 5 || cfg.BackoffStrategy != "exponential" || cfg.Timeout != 2*time.Second || cfg.Workers != DefaultWorkers {
+		t.Errorf("unexpected config: %+v %v", cfg, err)
+	}
+	if _, err = ConfigGetter(config.ExtraConfig{Namespace: map[string]interface{}{"timeout": "soon"}}); err == nil {
+		t.Error("expecting an error")
+	}
+	if _, err = ConfigGetter(config.ExtraConfig{Namespace: map[string]interface{}{"allowed_receivers": []interface{}{"10.0.0.0/33"}}}); err == nil {
+		t.Error("expecting an error")
+	}
+}
+
+func TestReceiverPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		allowed []string
+		addr    string
+		ok      bool
+	}{
+		{addr: "http://receiver.example/notify", ok: true},
+		{addr: "https://203.0.113.1:8443/notify", ok: true},
+		{addr: "ftp://receiver.example/notify"},
+		{addr: "http://127.0.0.1/notify"},
+		{addr: "http://[::1]/notify"},
+		{addr: "http://169.254.169.254/latest"},
+		{addr: "http://0.0.0.0/notify"},
+		{allowed: []string{"127.0.0.1"}, addr: "http://127.0.0.1:8080/notify", ok: true},
+		{allowed: []string{"receiver.example"}, addr: "http://Receiver.example/notify", ok: true},
+		{allowed: []string{"receiver.example"}, addr: "http://other.example/notify"},
+		{allowed: []string{"receiver.example"}, addr: "http://203.0.113.1/notify"},
+		{allowed: []string{"203.0.113.0/24"}, addr: "http://203.0.113.1/notify", ok: true},
+		{allowed: []string{"203.0.113.0/24"}, addr: "http://198.51.100.1/notify"},
+		{allowed: []string{"203.0.113.0/24"}, addr: "http://receiver.example/notify", ok: true},
+	} {
+		p, err := newReceiverPolicy(tc.allowed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = p.checkURL(tc.addr); (err == nil) != tc.ok {
+			t.Errorf("%v %s: unexpected result: %v", tc.allowed, tc.addr, err)
+		}
+	}
+
+	// 主机名解析得到的IP在建立连接时校验
+	p, _ := newReceiverPolicy([]string{"203.0.113.0/24"})
+	if err := p.control("tcp4", "198.51.100.1:80", nil); err == nil {
+		t.Error("expecting an error")
+	}
+	p, _ = newReceiverPolicy(nil)
+	if err := p.control("tcp4", "127.0.0.1:80", nil); err == nil {
+		t.Error("expecting an error")
+	}
+	if err := p.control("tcp4", "203.0.113.1:80", nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDispatcher_blockedReceiver(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer ts.Close()
+
+	// localhost通过了主机名的校验, 但解析得到的回环地址在建立连接时被拒绝
+	d := NewDispatcher(NewInMemoryStore(), Config{}, logging.NoOp)
+	addr := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	if err := d.CheckReceiver(addr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := d.post(context.Background(), addr, []byte("{}")); err == nil {
+		t.Error("expecting an error")
+	}
+	if c := atomic.LoadInt32(&calls); c != 0 {
+		t.Errorf("the blocked receiver was called %d times", c)
+	}
+	// 经过环境变量中的代理时连接的是代理服务器, 无法检查订阅者的地址
+	if d.client.Transport.(*http.Transport).Proxy != nil {
+		t.Error("the dispatcher should not use a proxy")
+	}
+}
@@ -7,12 +7,16 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/health"
 	logger "github.com/luraproject/lura/v2/logging"
 	"github.com/luraproject/lura/v2/proxy"
-	"github.com/luraproject/lura/v2/router/gin"
+	"github.com/luraproject/lura/v2/router"
+	"github.com/luraproject/lura/v2/vicg/session"
+	"github.com/luraproject/lura/v2/vicg/subscribe"
 )
 
 /* ***************************************************************************
@@ -22,7 +26,7 @@ import (
 *************************************************************************** */
 
 // DefaultFactory 创建默认的代理工厂.
-func DefaultVicgFactory(logger logger.Logger, factory map[string]VicgPluginFactory) gin.VicgFactory {
+func DefaultVicgFactory(logger logger.Logger, factory map[string]VicgPluginFactory) router.VicgFactory {
 	return defaultVicgFactory{
 		logger:        logger,
 		pluginFactory: factory,
@@ -41,31 +45,113 @@ func (pf defaultVicgFactory) createNewPlugin(cfg *config.PluginConfig, infra int
 	if !ok {
 		return nil, fmt.Errorf("the plugin '%s' not found", cfg.Name)
 	}
+	if errs := parsePluginConfig(cfg, f); len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		return nil, fmt.Errorf("the plugin '%s' has an invalid config: %s", cfg.Name, strings.Join(msgs, "; "))
+	}
 	return f.New(cfg, infra)
 }
 
+// ValidateConfig 解码并校验接口中所有插件的配置, 返回所有不合法的字段.
+// 同时补全接口需要传递的请求头, 使热加载时计算的配置指纹与创建接口后一致.
+func (pf defaultVicgFactory) ValidateConfig(cfg *config.EndpointConfig) []error {
+	pf.appendRequestHeaders(cfg)
+	var errs []error
+	for _, c := range cfg.Plugins {
+		f, ok := pf.pluginFactory[c.Name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("the plugin '%s' not found", c.Name))
+			continue
+		}
+		if err := checkTimeoutPolicy(c); err != nil {
+			errs = append(errs, err)
+		}
+		for _, err := range parsePluginConfig(c, f) {
+			errs = append(errs, fmt.Errorf("plugin '%s': %s", c.Name, err.Error()))
+		}
+	}
+	return errs
+}
+
+// appendRequestHeaders 将解析报文需要的Content-Type和插件读取的请求头加入cfg.HeadersToPass.
+func (pf defaultVicgFactory) appendRequestHeaders(cfg *config.EndpointConfig) {
+	headers := []string{"Content-Type"}
+	for _, c := range cfg.Plugins {
+		if hf, ok := pf.pluginFactory[c.Name].(HeadersFactory); ok {
+			headers = append(headers, hf.RequestHeaders()...)
+		}
+	}
+	cfg.HeadersToPass = config.AppendHeaders(cfg.HeadersToPass, headers...)
+}
+
+// parsePluginConfig 插件工厂声明了配置结构时, 解码并校验插件的配置, 保存到cfg.Parsed中.
+func parsePluginConfig(cfg *config.PluginConfig, f VicgPluginFactory) []error {
+	cf, ok := f.(ConfigurableFactory)
+	if !ok {
+		return nil
+	}
+	target := cf.NewConfig()
+	if errs := DecodePluginConfig(cfg.Config, target); len(errs) > 0 {
+		return errs
+	}
+	cfg.Parsed = target
+	return nil
+}
+
+// SessionsHealthKey 设备会话在健康检查接口中的键.
+const SessionsHealthKey = "sessions"
+
 // Infra 用户自定义结构示例.
 type Infra struct {
 	ExtraConfig map[string]interface{}
+	// Sessions 设备会话管理
+	Sessions *session.Manager
+	// Subscriptions 订阅的存储
+	Subscriptions subscribe.Store
+	// Notifier 订阅通知的分发
+	Notifier *subscribe.Dispatcher
 }
 
 // BuildInfra 创建用户自定义结构.
 func (pf defaultVicgFactory) BuildInfra(ctx context.Context, cfg config.ExtraConfig) (infra interface{}, err error) {
-	return &Infra{ExtraConfig: cfg}, nil
+	expiry, sweep, err := session.ConfigGetter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sessions := session.NewManager(expiry)
+	go sessions.Run(ctx, sweep)
+	health.Register(SessionsHealthKey, func() interface{} { return sessions.List() })
+
+	subscribeCfg, err := subscribe.ConfigGetter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	subscriptions := subscribe.NewInMemoryStore()
+	notifier := subscribe.NewDispatcher(subscriptions, subscribeCfg, pf.logger)
+	go notifier.Run(ctx)
+
+	return &Infra{ExtraConfig: cfg, Sessions: sessions, Subscriptions: subscriptions, Notifier: notifier}, nil
 }
 
 // New 创建HTTP接口代理.
 func (pf defaultVicgFactory) New(cfg *config.EndpointConfig, infra interface{}) (proxy.Proxy, error) {
-	plugins := make([]VicgPlugin, len(cfg.Plugins))
+	plugins := make([]pluginEntry, len(cfg.Plugins))
 	for i, c := range cfg.Plugins {
+		if err := checkTimeoutPolicy(c); err != nil {
+			return nil, err
+		}
 		p, err := pf.createNewPlugin(c, infra)
 		if err != nil {
 			return nil, err
 		}
-		plugins[i] = p
+		plugins[i] = pluginEntry{VicgPlugin: p, cfg: c}
 	}
-	// 从小到大进行排序
-	sort.Slice(plugins, func(i, j int) bool {
+	pf.appendRequestHeaders(cfg)
+	// 从小到大进行排序, 相同优先级的插件保持配置顺序
+	sort.SliceStable(plugins, func(i, j int) bool {
 		return plugins[i].Priority() < plugins[j].Priority()
 	})
 
@@ -74,21 +160,42 @@ func (pf defaultVicgFactory) New(cfg *config.EndpointConfig, infra interface{})
 			Data:       make(map[string]interface{}),
 			IsComplete: true,
 			Metadata: proxy.Metadata{
-				Headers:    map[string][]string{"Content-Type": {"application/VIID+JSON"}},
+				Headers:    map[string][]string{"Content-Type": {proxy.ViidContentType}},
 				StatusCode: http.StatusOK,
 			},
 		}
-		var err error
-		var sec = 5 * time.Second
+		// 报文解析失败时不执行插件, 但满足条件的插件依然会收到收尾通知
+		err := decodeRequest(request)
+		// 只执行满足条件的插件
+		active := make([]pluginEntry, 0, len(plugins))
 		for _, p := range plugins {
+			if matchRequest(p.cfg.Match, request) {
+				active = append(active, p)
+			}
+		}
+		var sec = 5 * time.Second
+		for _, group := range groupByPriority(active) {
+			if err != nil {
+				break
+			}
 			tick := time.Now()
-			err = p.HandleHTTPMessage(ctx, request, response)
+			err = pf.executeGroup(ctx, group, request, response)
 			if err != nil {
-				pf.logger.Infof("plugin index %d: %s", p.Priority(), err.Error())
+				pf.logger.Infof("plugin index %d: %s", group[0].Priority(), err.Error())
 				break
 			}
 			if span := time.Since(tick); span > sec {
-				pf.logger.Infof("The '%d' plugin cost %v on %s '%s'.", p.Priority(), span, request.Method, request.Path)
+				pf.logger.Infof("The '%d' plugin cost %v on %s '%s'.", group[0].Priority(), span, request.Method, request.Path)
+			}
+		}
+		// 结构化的插件错误渲染为VIID应答
+		if pe, ok := asPluginError(err); ok {
+			pe.Apply(response, request.Path)
+		}
+		// 逆序执行收尾阶段
+		for i := len(active) - 1; i >= 0; i-- {
+			if f, ok := active[i].VicgPlugin.(Finalizer); ok {
+				f.Finally(ctx, request, response, err)
 			}
 		}
 		return response, err
@@ -0,0 +1,585 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package vicg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luraproject/lura/v2/config"
+	"github.com/luraproject/lura/v2/logging"
+	"github.com/luraproject/lura/v2/proxy"
+	"github.com/luraproject/lura/v2/router"
+)
+
+// testRecorder 记录插件的执行顺序.
+type testRecorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *testRecorder) add(s string) {
+	r.mu.Lock()
+	r.calls = append(r.calls, s)
+	r.mu.Unlock()
+}
+
+func (r *testRecorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return fmt.Sprint(r.calls)
+}
+
+type testPlugin struct {
+	index    int
+	err      error
+	recorder *testRecorder
+	handle   func(ctx context.Context, request *proxy.Request, response *proxy.Response) error
+}
+
+func (p *testPlugin) HandleHTTPMessage(ctx context.Context, request *proxy.Request, response *proxy.Response) error {
+	p.recorder.add(fmt.Sprintf("handle-%d", p.index))
+	if p.handle != nil {
+		return p.handle(ctx, request, response)
+	}
+	return p.err
+}
+
+func (p *testPlugin) Priority() int {
+	return p.index
+}
+
+type testFinalizerPlugin struct {
+	testPlugin
+	finalErr error
+}
+
+func (p *testFinalizerPlugin) Finally(_ context.Context, _ *proxy.Request, _ *proxy.Response, err error) {
+	p.finalErr = err
+	p.recorder.add(fmt.Sprintf("finally-%d", p.index))
+}
+
+// testPluginFactory 按插件名称返回预先创建好的插件.
+type testPluginFactory map[string]VicgPlugin
+
+func (f testPluginFactory) New(cfg *config.PluginConfig, _ interface{}) (VicgPlugin, error) {
+	return f[cfg.Name], nil
+}
+
+func newTestProxy(t *testing.T, plugins map[string]VicgPlugin, cfgs ...*config.PluginConfig) proxy.Proxy {
+	t.Helper()
+	factories := map[string]VicgPluginFactory{}
+	for name := range plugins {
+		factories[name] = testPluginFactory(plugins)
+	}
+	p, err := DefaultVicgFactory(logging.NoOp, factories).New(&config.EndpointConfig{Plugins: cfgs}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestDefaultVicgFactory_finalizer(t *testing.T) {
+	recorder := &testRecorder{}
+	expectedErr := errors.New("plugin 2 failed")
+	first := &testFinalizerPlugin{testPlugin: testPlugin{index: 1, recorder: recorder}}
+	third := &testFinalizerPlugin{testPlugin: testPlugin{index: 3, recorder: recorder}}
+	p := newTestProxy(t,
+		map[string]VicgPlugin{
+			"first":  first,
+			"second": &testPlugin{index: 2, recorder: recorder, err: expectedErr},
+			"third":  third,
+		},
+		&config.PluginConfig{Name: "third", Index: 3},
+		&config.PluginConfig{Name: "first", Index: 1},
+		&config.PluginConfig{Name: "second", Index: 2},
+	)
+
+	resp, err := p(context.Background(), &proxy.Request{})
+	if err != expectedErr {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if resp == nil {
+		t.Error("nil response")
+	}
+	if have, want := recorder.String(), "[handle-1 handle-2 finally-3 finally-1]"; have != want {
+		t.Errorf("unexpected execution order. have: %s, want: %s", have, want)
+	}
+	if first.finalErr != expectedErr || third.finalErr != expectedErr {
+		t.Errorf("the finalizers did not receive the error: %v, %v", first.finalErr, third.finalErr)
+	}
+}
+
+func TestDefaultVicgFactory_pluginError(t *testing.T) {
+	recorder := &testRecorder{}
+	p := newTestProxy(t,
+		map[string]VicgPlugin{
+			"check": &testPlugin{index: 1, recorder: recorder, err: NewPluginError(http.StatusUnauthorized, "CHECK_FAILED", proxy.ViidStatusInvalidOperation, "check failed")},
+		},
+		&config.PluginConfig{Name: "check", Index: 1},
+	)
+
+	resp, err := p(context.Background(), &proxy.Request{Path: "/VIID/Faces"})
+	var pe *PluginError
+	if !errors.As(err, &pe) || pe.ErrorCode() != "CHECK_FAILED" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if resp.Metadata.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unexpected status code: %d", resp.Metadata.StatusCode)
+	}
+	if h := resp.Metadata.Headers[ErrorCodeHeader]; len(h) != 1 || h[0] != "CHECK_FAILED" {
+		t.Errorf("unexpected error code header: %v", h)
+	}
+	status, ok := resp.Data[proxy.ResponseStatusObjectKey].(proxy.ResponseStatus)
+	if !ok {
+		t.Errorf("unexpected data: %v", resp.Data)
+		return
+	}
+	if status.RequestURL != "/VIID/Faces" || status.StatusCode != proxy.ViidStatusInvalidOperation || status.StatusString != "check failed" {
+		t.Errorf("unexpected response status: %+v", status)
+	}
+}
+
+func TestPluginError(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := WrapPluginError(cause, http.StatusServiceUnavailable, "DB_UNAVAILABLE", proxy.ViidStatusDeviceBusy)
+	if !errors.Is(err, cause) {
+		t.Error("the plugin error does not wrap the cause")
+	}
+	if err.Error() != "connection refused" {
+		t.Errorf("unexpected message: %s", err.Error())
+	}
+	if (&PluginError{}).StatusCode() != http.StatusInternalServerError {
+		t.Error("unexpected default status code")
+	}
+}
+
+func TestDefaultVicgFactory_timeout(t *testing.T) {
+	slow := func(ctx context.Context, request *proxy.Request, response *proxy.Response) error {
+		response.Data["slow"] = true
+		request.Private["slow"] = true
+		<-ctx.Done()
+		// 超时后继续修改请求
+		request.Private["late"] = true
+		request.Headers["X-Late"] = []string{"true"}
+		return ctx.Err()
+	}
+
+	for _, tc := range []struct {
+		policy      string
+		expectedErr bool
+	}{
+		{policy: "", expectedErr: true},
+		{policy: config.PluginTimeoutFail, expectedErr: true},
+		{policy: config.PluginTimeoutSkip},
+	} {
+		recorder := &testRecorder{}
+		p := newTestProxy(t,
+			map[string]VicgPlugin{
+				"slow": &testPlugin{index: 1, recorder: recorder, handle: slow},
+				"next": &testPlugin{index: 2, recorder: recorder},
+			},
+			&config.PluginConfig{Name: "slow", Index: 1, Timeout: 10 * time.Millisecond, OnTimeout: tc.policy},
+			&config.PluginConfig{Name: "next", Index: 2},
+		)
+
+		request := &proxy.Request{
+			Path:    "/VIID/Faces",
+			Headers: map[string][]string{},
+			Private: map[string]interface{}{},
+		}
+		resp, err := p(context.Background(), request)
+		if _, ok := resp.Data["slow"]; ok {
+			t.Errorf("[%s] the timed out plugin modified the response", tc.policy)
+		}
+		if len(request.Private) != 0 || len(request.Headers) != 0 {
+			t.Errorf("[%s] the timed out plugin modified the request: %v %v", tc.policy, request.Private, request.Headers)
+		}
+		if !tc.expectedErr {
+			if err != nil {
+				t.Errorf("[%s] unexpected error: %v", tc.policy, err)
+			}
+			if have, want := recorder.String(), "[handle-1 handle-2]"; have != want {
+				t.Errorf("[%s] unexpected execution order. have: %s, want: %s", tc.policy, have, want)
+			}
+			continue
+		}
+		var pe *PluginError
+		if !errors.As(err, &pe) || pe.ErrorCode() != ErrCodePluginTimeout {
+			t.Errorf("[%s] unexpected error: %v", tc.policy, err)
+		}
+		if resp.Metadata.StatusCode != http.StatusGatewayTimeout {
+			t.Errorf("[%s] unexpected status code: %d", tc.policy, resp.Metadata.StatusCode)
+		}
+		if have, want := recorder.String(), "[handle-1]"; have != want {
+			t.Errorf("[%s] unexpected execution order. have: %s, want: %s", tc.policy, have, want)
+		}
+	}
+}
+
+func TestDefaultVicgFactory_unknownTimeoutPolicy(t *testing.T) {
+	factories := map[string]VicgPluginFactory{"x": testPluginFactory{"x": &testPlugin{}}}
+	cfg := &config.EndpointConfig{Plugins: []*config.PluginConfig{{Name: "x", OnTimeout: "retry"}}}
+	if _, err := DefaultVicgFactory(logging.NoOp, factories).New(cfg, nil); err == nil {
+		t.Error("expecting an error")
+	}
+}
+
+func TestDefaultVicgFactory_match(t *testing.T) {
+	recorder := &testRecorder{}
+	p := newTestProxy(t,
+		map[string]VicgPlugin{
+			"always": &testPlugin{index: 1, recorder: recorder},
+			"face":   &testFinalizerPlugin{testPlugin: testPlugin{index: 2, recorder: recorder}},
+			"put":    &testPlugin{index: 3, recorder: recorder},
+			"header": &testPlugin{index: 4, recorder: recorder},
+			"query":  &testPlugin{index: 5, recorder: recorder},
+			"param":  &testPlugin{index: 6, recorder: recorder},
+		},
+		&config.PluginConfig{Name: "always", Index: 1},
+		&config.PluginConfig{Name: "face", Index: 2, Match: &config.PluginMatch{DataType: []string{"Face", "Person"}}},
+		&config.PluginConfig{Name: "put", Index: 3, Match: &config.PluginMatch{Method: []string{"PUT"}}},
+		&config.PluginConfig{Name: "header", Index: 4, Match: &config.PluginMatch{Header: map[string]string{"user-identify": ""}}},
+		&config.PluginConfig{Name: "query", Index: 5, Match: &config.PluginMatch{Query: map[string]string{"mode": "full"}}},
+		&config.PluginConfig{Name: "param", Index: 6, Match: &config.PluginMatch{Method: []string{"post"}, Param: map[string]string{"id": "1"}}},
+	)
+
+	_, err := p(context.Background(), &proxy.Request{
+		Method:  "POST",
+		Headers: map[string][]string{"User-Identify": {"31000000001190000001"}},
+		Query:   map[string][]string{"mode": {"short"}},
+		Params:  map[string]string{"Id": "1"},
+		Data:    map[string][]map[string]interface{}{"Face": {{"FaceID": "1"}}},
+	})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if have, want := recorder.String(), "[handle-1 handle-2 handle-4 handle-6 finally-2]"; have != want {
+		t.Errorf("unexpected execution order. have: %s, want: %s", have, want)
+	}
+
+	recorder.calls = nil
+	if _, err := p(context.Background(), &proxy.Request{Method: "PUT", Query: map[string][]string{"mode": {"full"}}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if have, want := recorder.String(), "[handle-1 handle-3 handle-5]"; have != want {
+		t.Errorf("unexpected execution order. have: %s, want: %s", have, want)
+	}
+}
+
+func TestDefaultVicgFactory_parallel(t *testing.T) {
+	recorder := &testRecorder{}
+	// 两个插件都开始执行后才返回, 串行执行时会超时
+	started := make(chan struct{}, 2)
+	wait := func(ctx context.Context) {
+		started <- struct{}{}
+		for deadline := time.Now().Add(time.Second); len(started) < 2; time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Error("the plugins are not running concurrently")
+				return
+			}
+		}
+	}
+	dbErr := errors.New("db failed")
+	p := newTestProxy(t,
+		map[string]VicgPlugin{
+			"db": &testPlugin{index: 2, recorder: recorder, handle: func(ctx context.Context, request *proxy.Request, response *proxy.Response) error {
+				wait(ctx)
+				request.Private["db"] = true
+				response.Data["db"] = true
+				return dbErr
+			}},
+			"mq": &testPlugin{index: 2, recorder: recorder, handle: func(ctx context.Context, request *proxy.Request, response *proxy.Response) error {
+				wait(ctx)
+				request.Private["mq"] = true
+				response.Data["mq"] = true
+				response.Metadata.Headers["X-Mq"] = []string{"1"}
+				return NewPluginError(http.StatusBadGateway, "MQ_FAILED", proxy.ViidStatusDeviceError, "mq failed")
+			}},
+			"next": &testPlugin{index: 3, recorder: recorder},
+		},
+		&config.PluginConfig{Name: "db", Index: 2},
+		&config.PluginConfig{Name: "mq", Index: 2},
+		&config.PluginConfig{Name: "next", Index: 3},
+	)
+
+	request := &proxy.Request{Path: "/VIID/Faces", Private: map[string]interface{}{}}
+	resp, err := p(context.Background(), request)
+	me, ok := err.(*MultiError)
+	if !ok || len(me.Errors()) != 2 || me.Errors()[0] != dbErr {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if resp.Metadata.StatusCode != http.StatusBadGateway {
+		t.Errorf("unexpected status code: %d", resp.Metadata.StatusCode)
+	}
+	if have, want := recorder.String(), "[handle-2 handle-2]"; have != want {
+		t.Errorf("unexpected execution order. have: %s, want: %s", have, want)
+	}
+	if have, want := fmt.Sprint(request.Private), "map[db:true mq:true]"; have != want {
+		t.Errorf("unexpected request: %s", have)
+	}
+}
+
+func TestDefaultVicgFactory_sameIndexMerge(t *testing.T) {
+	recorder := &testRecorder{}
+	p := newTestProxy(t,
+		map[string]VicgPlugin{
+			"dedup": &testFinalizerPlugin{testPlugin: testPlugin{index: 0, recorder: recorder, handle: func(_ context.Context, request *proxy.Request, _ *proxy.Response) error {
+				request.Private["dedup"] = []string{"1"}
+				delete(request.Private, "stale")
+				return nil
+			}}},
+			"offload": &testPlugin{index: 0, recorder: recorder, handle: func(_ context.Context, request *proxy.Request, response *proxy.Response) error {
+				request.Data["Face"][0]["Data"] = "blob://1"
+				request.Headers["X-Offload"] = []string{"1"}
+				request.Body = io.NopCloser(strings.NewReader("offloaded"))
+				response.Metadata.Headers["X-Offload"] = []string{"1"}
+				return errors.New("offload failed")
+			}},
+		},
+		&config.PluginConfig{Name: "dedup"},
+		&config.PluginConfig{Name: "offload"},
+	)
+
+	request := &proxy.Request{
+		Path:    "/VIID/Faces",
+		Headers: map[string][]string{},
+		Private: map[string]interface{}{"stale": true},
+		Data:    map[string][]map[string]interface{}{"Face": {{"FaceID": "1", "Data": "..."}}},
+		Body:    io.NopCloser(strings.NewReader("body")),
+	}
+	resp, err := p(context.Background(), request)
+	if err == nil || err.Error() != "offload failed" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if have, want := recorder.String(), "[handle-0 handle-0 finally-0]"; have != want {
+		t.Errorf("unexpected execution order. have: %s, want: %s", have, want)
+	}
+	if have, want := fmt.Sprint(request.Private, request.Data, request.Headers), "map[dedup:[1]] map[Face:[map[Data:blob://1 FaceID:1]]] map[X-Offload:[1]]"; have != want {
+		t.Errorf("the changes to the request were not merged. have: %s, want: %s", have, want)
+	}
+	if b, _ := io.ReadAll(request.Body); string(b) != "offloaded" {
+		t.Errorf("unexpected body: %q", b)
+	}
+	if resp.Metadata.Headers["X-Offload"] == nil {
+		t.Errorf("the changes to the response were not merged: %v", resp.Metadata.Headers)
+	}
+}
+
+func TestMergeResponse(t *testing.T) {
+	response := &proxy.Response{
+		Data:     map[string]interface{}{"a": 1, "b": 2},
+		Metadata: proxy.Metadata{Headers: map[string][]string{"X-A": {"1"}}, StatusCode: http.StatusOK},
+	}
+	base := cloneResponse(response)
+	first, second := cloneResponse(response), cloneResponse(response)
+	first.Data["a"] = 10
+	first.Data["c"] = 3
+	delete(second.Data, "b")
+	second.Metadata.Headers["X-B"] = []string{"2"}
+	second.Metadata.StatusCode = http.StatusCreated
+
+	mergeResponse(response, base, first)
+	mergeResponse(response, base, second)
+
+	if have, want := fmt.Sprint(response.Data), "map[a:10 c:3]"; have != want {
+		t.Errorf("unexpected data. have: %s, want: %s", have, want)
+	}
+	if have, want := fmt.Sprint(response.Metadata.Headers), "map[X-A:[1] X-B:[2]]"; have != want {
+		t.Errorf("unexpected headers. have: %s, want: %s", have, want)
+	}
+	if response.Metadata.StatusCode != http.StatusCreated {
+		t.Errorf("unexpected status code: %d", response.Metadata.StatusCode)
+	}
+}
+
+func TestCloneRequest(t *testing.T) {
+	request := &proxy.Request{
+		Headers: map[string][]string{"X-A": {"1"}},
+		Params:  map[string]string{"id": "1"},
+		Private: map[string]interface{}{"a": 1},
+		Data: map[string][]map[string]interface{}{
+			"Face": {{"FaceID": "1", "SubImageList": map[string]interface{}{"SubImageInfoObject": []interface{}{
+				map[string]interface{}{"ImageID": "1"},
+			}}}},
+		},
+		Body: io.NopCloser(strings.NewReader("body")),
+	}
+	clone, err := cloneRequest(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone.Headers["X-A"][0] = "2"
+	clone.Params["id"] = "2"
+	clone.Private["a"] = 2
+	clone.Data["Face"][0]["FaceID"] = "2"
+	clone.Data["Face"][0]["SubImageList"].(map[string]interface{})["SubImageInfoObject"].([]interface{})[0].(map[string]interface{})["ImageID"] = "2"
+
+	if have, want := fmt.Sprint(request.Headers, request.Params, request.Private, request.Data), "map[X-A:[1]] map[id:1] map[a:1] map[Face:[map[FaceID:1 SubImageList:map[SubImageInfoObject:[map[ImageID:1]]]]]]"; have != want {
+		t.Errorf("the original request was modified. have: %s, want: %s", have, want)
+	}
+	for _, body := range []io.Reader{request.Body, clone.Body} {
+		if b, _ := io.ReadAll(body); string(b) != "body" {
+			t.Errorf("unexpected body: %q", b)
+		}
+	}
+
+	// 已经读入内存的报文直接共享尚未读取的数据, 不会再次读取
+	buffered := newBufferedBody([]byte("body"))
+	buffered.ReadByte()
+	clone, err = cloneRequest(&proxy.Request{Body: buffered})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := clone.Body.(*bufferedBody).b; string(b) != "ody" || &b[0] != &buffered.b[1] {
+		t.Errorf("the body was not shared: %q", b)
+	}
+}
+
+type testConfig struct {
+	Length int      `json:"Length" validate:"min=1,max=64"`
+	Mode   string   `json:"Mode" validate:"required,oneof=strict loose"`
+	Tags   []string `json:"tags" validate:"max=2"`
+}
+
+type testConfigurableFactory struct {
+	testPluginFactory
+}
+
+func (testConfigurableFactory) NewConfig() interface{} {
+	return &testConfig{Length: 20}
+}
+
+func TestDefaultVicgFactory_ValidateConfig(t *testing.T) {
+	pf := DefaultVicgFactory(logging.NoOp, map[string]VicgPluginFactory{
+		"x": testConfigurableFactory{testPluginFactory{"x": &testPlugin{}}},
+	}).(defaultVicgFactory)
+
+	valid := &config.PluginConfig{Name: "x", Config: map[string]interface{}{"mode": "strict"}}
+	if errs := pf.ValidateConfig(&config.EndpointConfig{Plugins: []*config.PluginConfig{valid}}); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if c, ok := valid.Parsed.(*testConfig); !ok || c.Length != 20 || c.Mode != "strict" {
+		t.Errorf("unexpected parsed config: %+v", valid.Parsed)
+	}
+
+	invalid := &config.PluginConfig{Name: "x", Config: map[string]interface{}{
+		"Length":  "20",
+		"Tags":    []interface{}{"a", "b", "c"},
+		"Unknown": 1,
+	}}
+	errs := pf.ValidateConfig(&config.EndpointConfig{Plugins: []*config.PluginConfig{invalid, {Name: "y"}}})
+	want := []string{
+		"plugin 'x': field 'Length': expected int, got string",
+		"plugin 'x': field 'Unknown': unknown field",
+		"plugin 'x': field 'Mode': is required",
+		"plugin 'x': field 'Mode': must be one of [strict loose], got ''",
+		"plugin 'x': field 'tags': must be at most 2",
+		"the plugin 'y' not found",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Errorf("unexpected error #%d. have: %s, want: %s", i, err.Error(), want[i])
+		}
+	}
+	if invalid.Parsed != nil {
+		t.Error("the invalid config was parsed")
+	}
+	if _, err := pf.New(&config.EndpointConfig{Plugins: []*config.PluginConfig{invalid}}, nil); err == nil {
+		t.Error("expecting an error")
+	}
+}
+
+type testHeadersFactory struct {
+	testPluginFactory
+}
+
+func (testHeadersFactory) RequestHeaders() []string {
+	return []string{"authorization"}
+}
+
+func TestDefaultVicgFactory_requestHeaders(t *testing.T) {
+	pf := DefaultVicgFactory(logging.NoOp, map[string]VicgPluginFactory{
+		"auth": testHeadersFactory{testPluginFactory{"auth": &testPlugin{}}},
+		"x":    testPluginFactory{"x": &testPlugin{}},
+	})
+	for _, tc := range []struct {
+		headers []string
+		plugins []*config.PluginConfig
+		want    string
+	}{
+		{nil, []*config.PluginConfig{{Name: "x"}}, "[Content-Type]"},
+		{[]string{"User-Identify"}, []*config.PluginConfig{{Name: "auth"}, {Name: "x"}}, "[User-Identify Content-Type Authorization]"},
+		{[]string{"Authorization", "content-type"}, []*config.PluginConfig{{Name: "auth"}}, "[Authorization content-type]"},
+		{[]string{"*"}, []*config.PluginConfig{{Name: "auth"}}, "[*]"},
+	} {
+		cfg := &config.EndpointConfig{HeadersToPass: tc.headers, Plugins: tc.plugins}
+		if errs := pf.(router.ConfigValidator).ValidateConfig(cfg); len(errs) != 0 {
+			t.Fatal(errs)
+		}
+		validated := fmt.Sprint(cfg.HeadersToPass)
+		if _, err := pf.New(cfg, nil); err != nil {
+			t.Fatal(err)
+		}
+		if have := fmt.Sprint(cfg.HeadersToPass); have != tc.want || have != validated {
+			t.Errorf("unexpected headers to pass. have: %s (validated: %s), want: %s", have, validated, tc.want)
+		}
+	}
+}
+
+func TestMergeResponse_statusList(t *testing.T) {
+	response := &proxy.Response{Data: map[string]interface{}{}}
+	response.AddResponseStatus(proxy.ResponseStatus{ID: "0"})
+	base := cloneResponse(response)
+	first, second := cloneResponse(response), cloneResponse(response)
+	first.AddResponseStatus(proxy.ResponseStatus{ID: "1"})
+	second.AddResponseStatus(proxy.ResponseStatus{ID: "2"})
+	second.AddResponseStatus(proxy.ResponseStatus{ID: "3"})
+
+	mergeResponse(response, base, first)
+	mergeResponse(response, base, second)
+
+	ids := make([]string, len(response.StatusList))
+	for i, s := range response.StatusList {
+		ids[i] = s.ID
+	}
+	if have, want := fmt.Sprint(ids), "[0 1 2 3]"; have != want {
+		t.Errorf("unexpected status list. have: %s, want: %s", have, want)
+	}
+}
+
+func TestDecodePluginConfig_required(t *testing.T) {
+	type withDefault struct {
+		TTL string `json:"TTL" validate:"required"`
+	}
+	// 有默认值时可以省略
+	if errs := DecodePluginConfig(map[string]interface{}{}, &withDefault{TTL: "10m"}); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if errs := DecodePluginConfig(map[string]interface{}{}, &withDefault{}); len(errs) != 1 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if errs := DecodePluginConfig(map[string]interface{}{"TTL": "1m"}, &withDefault{}); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	// 显式配置的零值不满足required
+	if errs := DecodePluginConfig(map[string]interface{}{"TTL": ""}, &withDefault{TTL: "10m"}); len(errs) != 1 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	type count struct {
+		Max int `json:"Max" validate:"required"`
+	}
+	if errs := DecodePluginConfig(map[string]interface{}{"Max": 0}, &count{Max: 10}); len(errs) != 1 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
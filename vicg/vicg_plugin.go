@@ -13,7 +13,20 @@ type VicgPlugin interface {
 	Priority() int
 }
 
+// Finalizer 插件可选实现的收尾接口.
+// 插件链执行完毕后(无论成功或失败), 按优先级逆序调用每个实现了该接口的插件,
+// 传入最终的应答和错误. 适用于审计日志、指标统计、资源清理等场景.
+type Finalizer interface {
+	Finally(ctx context.Context, request *proxy.Request, response *proxy.Response, err error)
+}
+
 // VicgPluginFactory 插件工厂.
 type VicgPluginFactory interface {
 	New(cfg *config.PluginConfig, infra interface{}) (VicgPlugin, error)
 }
+
+// HeadersFactory 插件工厂可选实现的接口, 声明插件读取的请求头.
+// 接口只传递HeadersToPass中的请求头, 网关创建接口时自动将这些请求头加入HeadersToPass.
+type HeadersFactory interface {
+	RequestHeaders() []string
+}